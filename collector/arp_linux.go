@@ -38,6 +38,7 @@ var (
 type arpCollector struct {
 	fs           procfs.FS
 	deviceFilter deviceFilter
+	netlink      bool
 	entries      *prometheus.Desc
 	logger       log.Logger
 }
@@ -56,6 +57,7 @@ func NewARPCollector(logger log.Logger) (Collector, error) {
 	return &arpCollector{
 		fs:           fs,
 		deviceFilter: newDeviceFilter(*arpDeviceExclude, *arpDeviceInclude),
+		netlink:      *arpNetlink,
 		entries: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "arp", "entries"),
 			"ARP entries by device",
@@ -119,7 +121,7 @@ func getTotalArpEntriesRTNL() (map[string]uint32, error) {
 func (c *arpCollector) Update(ch chan<- prometheus.Metric) error {
 	var enumeratedEntry map[string]uint32
 
-	if *arpNetlink {
+	if c.netlink {
 		var err error
 
 		enumeratedEntry, err = getTotalArpEntriesRTNL()
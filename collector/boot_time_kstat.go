@@ -0,0 +1,60 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noboottime
+// +build !noboottime
+
+package collector
+
+import (
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type bootTimeKstatCollector struct {
+	boottime typedDesc
+	open     kstatOpener
+	logger   log.Logger
+}
+
+func newBootTimeKstatCollector(open kstatOpener, logger log.Logger) *bootTimeKstatCollector {
+	return &bootTimeKstatCollector{
+		boottime: typedDesc{
+			prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "", "boot_time_seconds"),
+				"Unix time of last boot, including microseconds.",
+				nil, nil,
+			), prometheus.GaugeValue},
+		open:   open,
+		logger: logger,
+	}
+}
+
+// Update pushes boot time onto ch
+func (c *bootTimeKstatCollector) Update(ch chan<- prometheus.Metric) error {
+	r, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	defer r.close()
+
+	v, err := readKstatValue(r, kstatID{"unix", 0, "system_misc"}, "boot_time")
+	if err != nil {
+		return err
+	}
+
+	ch <- c.boottime.mustNewConstMetric(v)
+
+	return nil
+}
@@ -18,52 +18,13 @@ package collector
 
 import (
 	"github.com/go-kit/log"
-	"github.com/illumos/go-kstat"
-	"github.com/prometheus/client_golang/prometheus"
 )
 
-type bootTimeCollector struct {
-	boottime typedDesc
-	logger   log.Logger
-}
-
 func init() {
 	registerCollector("boottime", defaultEnabled, newBootTimeCollector)
 }
 
-func newBootTimeCollector(logger log.Logger) (Collector, error) {
-	return &bootTimeCollector{
-		boottime: typedDesc{
-			prometheus.NewDesc(
-				prometheus.BuildFQName(namespace, "", "boot_time_seconds"),
-				"Unix time of last boot, including microseconds.",
-				nil, nil,
-			), prometheus.GaugeValue},
-		logger: logger,
-	}, nil
-}
-
 // newBootTimeCollector returns a new Collector exposing system boot time on Solaris systems.
-// Update pushes boot time onto ch
-func (c *bootTimeCollector) Update(ch chan<- prometheus.Metric) error {
-	tok, err := kstat.Open()
-	if err != nil {
-		return err
-	}
-
-	defer tok.Close()
-
-	ks, err := tok.Lookup("unix", 0, "system_misc")
-	if err != nil {
-		return err
-	}
-
-	v, err := ks.GetNamed("boot_time")
-	if err != nil {
-		return err
-	}
-
-	ch <- c.boottime.mustNewConstMetric(float64(v.UintVal))
-
-	return nil
+func newBootTimeCollector(logger log.Logger) (Collector, error) {
+	return newBootTimeKstatCollector(openKstatReader, logger), nil
 }
@@ -0,0 +1,197 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	backgroundCollectors = kingpin.Flag(
+		"collector.background",
+		"Run a collector in the background and serve its last result on scrape, in the form <collector>[=<interval>]. Can be repeated.",
+	).Strings()
+	backgroundInterval = kingpin.Flag(
+		"collector.background.interval",
+		"Default interval of collectors running in the background.",
+	).Default("1m").Duration()
+
+	cacheLastSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_last_success_timestamp_seconds"),
+		"node_exporter: Timestamp of the last successful background run of a collector.",
+		[]string{"collector"},
+		nil,
+	)
+	cacheAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_cache_age_seconds"),
+		"node_exporter: Age of the metrics served from the cache of a background collector.",
+		[]string{"collector"},
+		nil,
+	)
+)
+
+// cachedCollector runs a collector on its own interval and serves the
+// metrics of the last run on every Update.
+type cachedCollector struct {
+	name      string
+	collector Collector
+	interval  time.Duration
+	timeout   time.Duration
+	logger    log.Logger
+
+	// ready is closed once the first run has finished.
+	ready chan struct{}
+	// done stops the background runs when closed.
+	done chan struct{}
+
+	mtx         sync.RWMutex
+	metrics     []prometheus.Metric
+	err         error
+	lastRun     time.Time
+	lastSuccess time.Time
+}
+
+func newCachedCollector(name string, c Collector, interval, timeout time.Duration, logger log.Logger) *cachedCollector {
+	cc := &cachedCollector{
+		name:      name,
+		collector: c,
+		interval:  interval,
+		timeout:   timeout,
+		logger:    logger,
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go cc.loop()
+	return cc
+}
+
+func (c *cachedCollector) loop() {
+	c.run()
+	close(c.ready)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.run()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close stops the background runs. Update keeps serving the metrics of the
+// last run.
+func (c *cachedCollector) Close() error {
+	close(c.done)
+	if closer, ok := c.collector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// run updates the wrapped collector once and replaces the cached metrics
+// with its result. A timed out run keeps the previous metrics.
+func (c *cachedCollector) run() {
+	var metrics []prometheus.Metric
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+
+	begin := time.Now()
+	timedOut, err := update(c.collector, ch, c.timeout)
+	close(ch)
+	<-done
+	duration := time.Since(begin)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.err = err
+	if timedOut {
+		level.Error(c.logger).Log("msg", "background collector timed out, keeping previous metrics", "name", c.name, "timeout", c.timeout)
+		return
+	}
+	if err != nil && !IsNoDataError(err) {
+		level.Error(c.logger).Log("msg", "background collector failed", "name", c.name, "duration_seconds", duration.Seconds(), "err", err)
+	} else {
+		level.Debug(c.logger).Log("msg", "background collector succeeded", "name", c.name, "duration_seconds", duration.Seconds())
+	}
+	c.metrics = metrics
+	c.lastRun = begin
+	if err == nil {
+		c.lastSuccess = begin
+	}
+}
+
+// Update implements Collector by replaying the metrics of the last run.
+// Until the first run has finished, there is no data to replay.
+func (c *cachedCollector) Update(ch chan<- prometheus.Metric) error {
+	select {
+	case <-c.ready:
+	default:
+		return ErrNoData
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	for _, m := range c.metrics {
+		ch <- m
+	}
+	if !c.lastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(cacheLastSuccessDesc, prometheus.GaugeValue, float64(c.lastSuccess.UnixNano())/1e9, c.name)
+	}
+	if !c.lastRun.IsZero() {
+		ch <- prometheus.MustNewConstMetric(cacheAgeDesc, prometheus.GaugeValue, time.Since(c.lastRun).Seconds(), c.name)
+	}
+	return c.err
+}
+
+// parseBackgroundCollectors returns the run interval of every collector
+// configured to run in the background.
+func parseBackgroundCollectors(defaultInterval time.Duration, entries []string) (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration, len(entries))
+	for _, entry := range entries {
+		name, value, hasInterval := strings.Cut(entry, "=")
+		if _, exist := factories[name]; !exist {
+			return nil, fmt.Errorf("invalid background collector %q: missing collector: %s", entry, name)
+		}
+		interval := defaultInterval
+		if hasInterval {
+			var err error
+			if interval, err = time.ParseDuration(value); err != nil {
+				return nil, fmt.Errorf("invalid background collector %q: %w", entry, err)
+			}
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("invalid background collector %q: interval must be positive", entry)
+		}
+		intervals[name] = interval
+	}
+	return intervals, nil
+}
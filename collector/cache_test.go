@@ -0,0 +1,134 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type countingCollector struct {
+	runs atomic.Int32
+	err  error
+}
+
+func (c *countingCollector) Update(ch chan<- prometheus.Metric) error {
+	n := c.runs.Add(1)
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, float64(n))
+	return c.err
+}
+
+// blockingCollector blocks its updates until release is closed.
+type blockingCollector struct {
+	release chan struct{}
+}
+
+func (c blockingCollector) Update(ch chan<- prometheus.Metric) error {
+	<-c.release
+	return nil
+}
+
+func TestCachedCollector(t *testing.T) {
+	c := &countingCollector{}
+	cc := newCachedCollector("test", c, time.Hour, 0, log.NewNopLogger())
+	defer cc.Close()
+	<-cc.ready
+
+	for i := 0; i < 3; i++ {
+		nc := NodeCollector{
+			Collectors: map[string]Collector{"test": cc},
+			logger:     log.NewNopLogger(),
+		}
+		metrics := countMetrics(nc)
+		for _, name := range []string{
+			"node_test_value",
+			"node_scrape_collector_last_success_timestamp_seconds",
+			"node_scrape_collector_cache_age_seconds",
+		} {
+			if metrics[name] != 1 {
+				t.Errorf("scrape %d: expected one %s metric, got %d", i, name, metrics[name])
+			}
+		}
+	}
+
+	if runs := c.runs.Load(); runs != 1 {
+		t.Errorf("expected the wrapped collector to run once, ran %d times", runs)
+	}
+}
+
+func TestCachedCollectorError(t *testing.T) {
+	c := &countingCollector{err: errors.New("failed")}
+	cc := newCachedCollector("test", c, time.Hour, 0, log.NewNopLogger())
+	defer cc.Close()
+	<-cc.ready
+
+	ch := make(chan prometheus.Metric, 10)
+	if err := cc.Update(ch); err == nil {
+		t.Fatal("expected the error of the background run to be returned")
+	}
+	close(ch)
+
+	var names []string
+	for m := range ch {
+		names = append(names, m.Desc().String())
+	}
+	if len(names) != 2 {
+		t.Errorf("expected the collector metric and the cache age only, got %v", names)
+	}
+}
+
+func TestCachedCollectorFirstRun(t *testing.T) {
+	c := blockingCollector{release: make(chan struct{})}
+	cc := newCachedCollector("test", c, time.Millisecond, 0, log.NewNopLogger())
+
+	if err := cc.Update(make(chan prometheus.Metric, 10)); !IsNoDataError(err) {
+		t.Errorf("expected no data before the first run finished, got %v", err)
+	}
+
+	close(c.release)
+	<-cc.ready
+	if err := cc.Update(make(chan prometheus.Metric, 10)); err != nil {
+		t.Errorf("expected the result of the first run, got %v", err)
+	}
+	if err := cc.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseBackgroundCollectors(t *testing.T) {
+	intervals, err := parseBackgroundCollectors(time.Minute, []string{"textfile", "loadavg=15s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := time.Minute, intervals["textfile"]; want != got {
+		t.Errorf("want interval %s for textfile, got %s", want, got)
+	}
+	if want, got := 15*time.Second, intervals["loadavg"]; want != got {
+		t.Errorf("want interval %s for loadavg, got %s", want, got)
+	}
+	if len(intervals) != 2 {
+		t.Errorf("expected two background collectors, got %v", intervals)
+	}
+
+	for _, entry := range []string{"doesnotexist", "textfile=often", "textfile=0s"} {
+		if _, err := parseBackgroundCollectors(time.Minute, []string{entry}); err == nil {
+			t.Errorf("expected error for %q", entry)
+		}
+	}
+}
@@ -15,8 +15,12 @@
 package collector
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -42,6 +46,23 @@ var (
 		[]string{"collector"},
 		nil,
 	)
+	scrapeTimeoutDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_timeout"),
+		"node_exporter: Whether a collector ran into its scrape timeout.",
+		[]string{"collector"},
+		nil,
+	)
+)
+
+var (
+	scrapeTimeout = kingpin.Flag(
+		"collector.scrape-timeout",
+		"Maximum duration of a single collector update. Metrics of collectors exceeding it are dropped. 0 disables the timeout.",
+	).Default("0s").Duration()
+	collectorScrapeTimeouts = kingpin.Flag(
+		"collector.scrape-timeout.override",
+		"Per-collector scrape timeout in the form <collector>=<duration>, overriding --collector.scrape-timeout. Can be repeated.",
+	).Strings()
 )
 
 const (
@@ -49,12 +70,23 @@ const (
 	defaultDisabled = false
 )
 
+// defaultEnabledOnSolaris enables a collector by default only on Solaris and
+// illumos, for collectors running commands specific to them.
+var defaultEnabledOnSolaris = runtime.GOOS == "solaris" || runtime.GOOS == "illumos"
+
 var (
 	factories              = make(map[string]func(logger log.Logger) (Collector, error))
 	initiatedCollectorsMtx = sync.Mutex{}
 	initiatedCollectors    = make(map[string]Collector)
 	collectorState         = make(map[string]*bool)
 	forcedCollectors       = map[string]bool{} // collectors which have been explicitly enabled or disabled
+	// defaultCollectorsDisabled records DisableDefaultCollectors calls, so
+	// that the configuration file can be re-applied the same way.
+	defaultCollectorsDisabled bool
+
+	// initiatedTargetCollectors holds the collectors of each probe target,
+	// created on first use. It is protected by initiatedCollectorsMtx.
+	initiatedTargetCollectors = make(map[string]map[string]Collector)
 )
 
 func registerCollector(collector string, isDefaultEnabled bool, factory func(logger log.Logger) (Collector, error)) {
@@ -78,12 +110,16 @@ func registerCollector(collector string, isDefaultEnabled bool, factory func(log
 // NodeCollector implements the prometheus.Collector interface.
 type NodeCollector struct {
 	Collectors map[string]Collector
-	logger     log.Logger
+	timeouts   map[string]time.Duration
+	// relabelConfigs holds the metric relabeling rules of each collector.
+	relabelConfigs map[string][]*RelabelConfig
+	logger         log.Logger
 }
 
 // DisableDefaultCollectors sets the collector state to false for all collectors which
 // have not been explicitly enabled on the command line.
 func DisableDefaultCollectors() {
+	defaultCollectorsDisabled = true
 	for c := range collectorState {
 		if _, ok := forcedCollectors[c]; !ok {
 			*collectorState[c] = false
@@ -105,6 +141,25 @@ func collectorFlagAction(collector string) func(ctx *kingpin.ParseContext) error
 
 // NewNodeCollector creates a new NodeCollector.
 func NewNodeCollector(logger log.Logger, filters ...string) (*NodeCollector, error) {
+	return newNodeCollector("", nil, logger, filters)
+}
+
+// NewTargetCollector creates a NodeCollector reading from the paths of the
+// named target in the configuration file. The collectors of a target are
+// kept until the next reload.
+func NewTargetCollector(target string, logger log.Logger, filters ...string) (*NodeCollector, error) {
+	paths, ok := currentConfig().Targets[target]
+	if !ok {
+		return nil, fmt.Errorf("unknown target: %s", target)
+	}
+	return newNodeCollector(target, &paths, log.With(logger, "target", target), filters)
+}
+
+// newNodeCollector creates a NodeCollector for the given target, or for the
+// paths given by the flags if paths is nil.
+func newNodeCollector(target string, paths *Paths, logger log.Logger, filters []string) (*NodeCollector, error) {
+	flagsMtx.RLock()
+	defer flagsMtx.RUnlock()
 	f := make(map[string]bool)
 	for _, filter := range filters {
 		enabled, exist := collectorState[filter]
@@ -116,31 +171,223 @@ func NewNodeCollector(logger log.Logger, filters ...string) (*NodeCollector, err
 		}
 		f[filter] = true
 	}
+	timeouts, background, err := collectorSettings()
+	if err != nil {
+		return nil, err
+	}
 	collectors := make(map[string]Collector)
 	initiatedCollectorsMtx.Lock()
 	defer initiatedCollectorsMtx.Unlock()
+	initiated := initiatedCollectors
+	if paths != nil {
+		if initiatedTargetCollectors[target] == nil {
+			initiatedTargetCollectors[target] = make(map[string]Collector)
+		}
+		initiated = initiatedTargetCollectors[target]
+	}
 	for key, enabled := range collectorState {
 		if !*enabled || (len(f) > 0 && !f[key]) {
 			continue
 		}
-		if collector, ok := initiatedCollectors[key]; ok {
+		if collector, ok := initiated[key]; ok {
 			collectors[key] = collector
 		} else {
-			collector, err := factories[key](log.With(logger, "collector", key))
+			collector, err := newCollector(key, paths, timeouts, background, logger)
 			if err != nil {
 				return nil, err
 			}
 			collectors[key] = collector
-			initiatedCollectors[key] = collector
+			initiated[key] = collector
+		}
+	}
+	return &NodeCollector{
+		Collectors:     collectors,
+		timeouts:       timeouts,
+		relabelConfigs: currentConfig().relabelConfigs(),
+		logger:         logger,
+	}, nil
+}
+
+// Reload applies cfg, which may be nil if no configuration file is used,
+// and creates all enabled collectors anew from their factories, so that
+// they pick up changed flags and re-read their own configuration files.
+// Before the new collectors replace the previous ones, prepare is called, if
+// not nil, with a NodeCollector of all of them. NewNodeCollector returns the
+// new collectors afterwards, the collectors of probe targets are created
+// anew on first use. If applying cfg, creating any collector or prepare
+// fails, the previous configuration and collectors are kept.
+func Reload(cfg *Config, args []string, logger log.Logger, prepare func(*NodeCollector) error) error {
+	explicit, err := explicitFlagNames(args)
+	if err != nil {
+		return err
+	}
+	flagsMtx.Lock()
+	defer flagsMtx.Unlock()
+	initiatedCollectorsMtx.Lock()
+	defer initiatedCollectorsMtx.Unlock()
+
+	configMtx.RLock()
+	previous := loadedConfig
+	configMtx.RUnlock()
+
+	if err := setConfig(cfg, explicit); err != nil {
+		return err
+	}
+	restore := func() {
+		if rerr := setConfig(previous, explicit); rerr != nil {
+			level.Error(logger).Log("msg", "failed to restore previous configuration", "err", rerr)
+		}
+	}
+
+	collectors, err := newEnabledCollectors(logger)
+	if err != nil {
+		restore()
+		return err
+	}
+	if prepare != nil {
+		nc, err := newNodeCollectorFrom(collectors, logger)
+		if err == nil {
+			err = prepare(nc)
+		}
+		if err != nil {
+			closeCollectors(collectors, logger)
+			restore()
+			return err
+		}
+	}
+
+	closeCollectors(initiatedCollectors, logger)
+	for target, targetCollectors := range initiatedTargetCollectors {
+		closeCollectors(targetCollectors, log.With(logger, "target", target))
+	}
+	initiatedCollectors = collectors
+	initiatedTargetCollectors = make(map[string]map[string]Collector)
+	return nil
+}
+
+func closeCollectors(collectors map[string]Collector, logger log.Logger) {
+	for name, c := range collectors {
+		if closer, ok := c.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				level.Warn(logger).Log("msg", "failed to close replaced collector", "name", name, "err", err)
+			}
 		}
 	}
-	return &NodeCollector{Collectors: collectors, logger: logger}, nil
+}
+
+// newNodeCollectorFrom creates a NodeCollector of the given collectors with
+// the current settings. The caller holds flagsMtx.
+func newNodeCollectorFrom(collectors map[string]Collector, logger log.Logger) (*NodeCollector, error) {
+	timeouts, _, err := collectorSettings()
+	if err != nil {
+		return nil, err
+	}
+	return &NodeCollector{
+		Collectors:     collectors,
+		timeouts:       timeouts,
+		relabelConfigs: currentConfig().relabelConfigs(),
+		logger:         logger,
+	}, nil
+}
+
+// newEnabledCollectors creates all enabled collectors. The caller holds
+// flagsMtx.
+func newEnabledCollectors(logger log.Logger) (map[string]Collector, error) {
+	timeouts, background, err := collectorSettings()
+	if err != nil {
+		return nil, err
+	}
+	collectors := make(map[string]Collector)
+	for key, enabled := range collectorState {
+		if !*enabled {
+			continue
+		}
+		collector, err := newCollector(key, nil, timeouts, background, logger)
+		if err != nil {
+			for _, c := range collectors {
+				if closer, ok := c.(io.Closer); ok {
+					closer.Close()
+				}
+			}
+			return nil, fmt.Errorf("couldn't create collector %s: %w", key, err)
+		}
+		collectors[key] = collector
+	}
+	return collectors, nil
+}
+
+// newCollector creates the collector key, reading from paths if not nil. The
+// caller holds flagsMtx.
+func newCollector(key string, paths *Paths, timeouts, background map[string]time.Duration, logger log.Logger) (Collector, error) {
+	collectorLogger := log.With(logger, "collector", key)
+	var (
+		collector Collector
+		err       error
+	)
+	withPaths(paths, func() {
+		collector, err = factories[key](collectorLogger)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if interval, ok := background[key]; ok {
+		collector = newCachedCollector(key, collector, interval, timeouts[key], collectorLogger)
+	}
+	return collector, nil
+}
+
+// collectorSettings returns the scrape timeout of every collector and the
+// interval of the collectors running in the background. Entries from the
+// configuration file come first, so that the ones given as flags take
+// precedence.
+func collectorSettings() (map[string]time.Duration, map[string]time.Duration, error) {
+	cfg := currentConfig()
+	timeouts, err := parseScrapeTimeouts(*scrapeTimeout, append(cfg.scrapeTimeoutOverrides(), *collectorScrapeTimeouts...))
+	if err != nil {
+		return nil, nil, err
+	}
+	background, err := parseBackgroundCollectors(*backgroundInterval, append(cfg.backgroundCollectors(), *backgroundCollectors...))
+	if err != nil {
+		return nil, nil, err
+	}
+	return timeouts, background, nil
+}
+
+// parseScrapeTimeouts resolves the scrape timeout of every registered
+// collector from the global default and the per-collector overrides.
+func parseScrapeTimeouts(global time.Duration, overrides []string) (map[string]time.Duration, error) {
+	if global < 0 {
+		return nil, fmt.Errorf("invalid scrape timeout %s: must not be negative", global)
+	}
+	timeouts := make(map[string]time.Duration, len(factories))
+	for name := range factories {
+		timeouts[name] = global
+	}
+	for _, override := range overrides {
+		name, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid scrape timeout override %q: expected <collector>=<duration>", override)
+		}
+		if _, exist := factories[name]; !exist {
+			return nil, fmt.Errorf("invalid scrape timeout override %q: missing collector: %s", override, name)
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scrape timeout override %q: %w", override, err)
+		}
+		if timeout < 0 {
+			return nil, fmt.Errorf("invalid scrape timeout override %q: must not be negative", override)
+		}
+		timeouts[name] = timeout
+	}
+	return timeouts, nil
 }
 
 // Describe implements the prometheus.Collector interface.
 func (n NodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	ch <- scrapeTimeoutDesc
 }
 
 // Collect implements the prometheus.Collector interface.
@@ -149,32 +396,117 @@ func (n NodeCollector) Collect(ch chan<- prometheus.Metric) {
 	wg.Add(len(n.Collectors))
 	for name, c := range n.Collectors {
 		go func(name string, c Collector) {
-			execute(name, c, ch, n.logger)
+			execute(name, c, ch, n.timeouts[name], n.relabelConfigs[name], n.logger)
 			wg.Done()
 		}(name, c)
 	}
 	wg.Wait()
 }
 
-func execute(name string, c Collector, ch chan<- prometheus.Metric, logger log.Logger) {
+func execute(name string, c Collector, ch chan<- prometheus.Metric, timeout time.Duration, relabelConfigs []*RelabelConfig, logger log.Logger) {
+	out := ch
+	var relabelDone chan struct{}
+	if len(relabelConfigs) > 0 {
+		relabeled := make(chan prometheus.Metric)
+		relabelDone = make(chan struct{})
+		go func() {
+			relabelMetrics(name, relabeled, ch, relabelConfigs, logger)
+			close(relabelDone)
+		}()
+		out = relabeled
+	}
+
 	begin := time.Now()
-	err := c.Update(ch)
+	timedOut, err := update(c, out, timeout)
 	duration := time.Since(begin)
-	var success float64
+	if relabelDone != nil {
+		close(out)
+		<-relabelDone
+		ch <- relabelDroppedSeries.WithLabelValues(name)
+	}
+	var success, timeoutVal float64
 
-	if err != nil {
+	switch {
+	case timedOut:
+		level.Error(logger).Log("msg", "collector timed out, dropping its metrics", "name", name, "timeout", timeout, "duration_seconds", duration.Seconds())
+		success = 0
+		timeoutVal = 1
+	case err != nil:
 		if IsNoDataError(err) {
 			level.Debug(logger).Log("msg", "collector returned no data", "name", name, "duration_seconds", duration.Seconds(), "err", err)
 		} else {
 			level.Error(logger).Log("msg", "collector failed", "name", name, "duration_seconds", duration.Seconds(), "err", err)
 		}
 		success = 0
-	} else {
+	default:
 		level.Debug(logger).Log("msg", "collector succeeded", "name", name, "duration_seconds", duration.Seconds())
 		success = 1
 	}
 	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+	ch <- prometheus.MustNewConstMetric(scrapeTimeoutDesc, prometheus.GaugeValue, timeoutVal, name)
+}
+
+// relabelMetrics forwards the metrics of the named collector from in to out,
+// applying the relabeling rules. Metrics failing to be relabeled are
+// forwarded unchanged.
+func relabelMetrics(name string, in <-chan prometheus.Metric, out chan<- prometheus.Metric, cfgs []*RelabelConfig, logger log.Logger) {
+	dropped := relabelDroppedSeries.WithLabelValues(name)
+	for m := range in {
+		relabeled, keep, err := relabelMetric(m, cfgs)
+		switch {
+		case err != nil:
+			level.Error(logger).Log("msg", "failed to relabel metric", "name", name, "err", err)
+			out <- m
+		case keep:
+			out <- relabeled
+		default:
+			dropped.Inc()
+		}
+	}
+}
+
+// update runs a single collector update. With a positive timeout the
+// collector writes into an intermediate channel which is forwarded to ch
+// until the deadline passes; anything the collector sends afterwards is
+// discarded, as ch may already be closed by then.
+func update(c Collector, ch chan<- prometheus.Metric, timeout time.Duration) (bool, error) {
+	if timeout <= 0 {
+		return false, updateContext(context.Background(), c, ch)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	buf := make(chan prometheus.Metric)
+	done := make(chan error, 1)
+	go func() {
+		done <- updateContext(ctx, c, buf)
+		close(buf)
+	}()
+
+	for {
+		select {
+		case m, ok := <-buf:
+			if !ok {
+				return false, <-done
+			}
+			ch <- m
+		case <-ctx.Done():
+			go func() {
+				for range buf {
+				}
+			}()
+			return true, ctx.Err()
+		}
+	}
+}
+
+func updateContext(ctx context.Context, c Collector, ch chan<- prometheus.Metric) error {
+	if cc, ok := c.(ContextCollector); ok {
+		return cc.UpdateContext(ctx, ch)
+	}
+	return c.Update(ch)
 }
 
 // Collector is the interface a collector has to implement.
@@ -183,6 +515,13 @@ type Collector interface {
 	Update(ch chan<- prometheus.Metric) error
 }
 
+// ContextCollector is implemented by collectors which are able to stop
+// early once the scrape timeout passed. If a collector implements it,
+// UpdateContext is called instead of Update.
+type ContextCollector interface {
+	UpdateContext(ctx context.Context, ch chan<- prometheus.Metric) error
+}
+
 type typedDesc struct {
 	desc      *prometheus.Desc
 	valueType prometheus.ValueType
@@ -0,0 +1,162 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var testDesc = prometheus.NewDesc("node_test_value", "Test value.", nil, nil)
+
+type testCollector struct {
+	delay time.Duration
+}
+
+func (c testCollector) Update(ch chan<- prometheus.Metric) error {
+	time.Sleep(c.delay)
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, 1)
+	return nil
+}
+
+// testUpdateCollector adapts a Collector for a registry, failing the test
+// if its update fails.
+type testUpdateCollector struct {
+	t *testing.T
+	c Collector
+}
+
+func (c testUpdateCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.c.Update(ch); err != nil {
+		c.t.Errorf("update failed: %s", err)
+	}
+}
+
+func (c testUpdateCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+type testContextCollector struct {
+	stopped chan struct{}
+}
+
+func (c testContextCollector) Update(ch chan<- prometheus.Metric) error {
+	return c.UpdateContext(context.Background(), ch)
+}
+
+func (c testContextCollector) UpdateContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	<-ctx.Done()
+	close(c.stopped)
+	return ctx.Err()
+}
+
+func TestNodeCollectorTimeout(t *testing.T) {
+	nc := NodeCollector{
+		Collectors: map[string]Collector{
+			"fast": testCollector{},
+			"slow": testCollector{delay: time.Second},
+		},
+		timeouts: map[string]time.Duration{
+			"fast": 0,
+			"slow": 50 * time.Millisecond,
+		},
+		logger: log.NewNopLogger(),
+	}
+
+	begin := time.Now()
+	metrics := countMetrics(nc)
+	if d := time.Since(begin); d > 500*time.Millisecond {
+		t.Fatalf("collect took %s, expected the slow collector to be cut off", d)
+	}
+
+	if got := metrics["node_test_value"]; got != 1 {
+		t.Errorf("expected exactly one test metric from the fast collector, got %d", got)
+	}
+
+	expected := `
+# HELP node_scrape_collector_success node_exporter: Whether a collector succeeded.
+# TYPE node_scrape_collector_success gauge
+node_scrape_collector_success{collector="fast"} 1
+node_scrape_collector_success{collector="slow"} 0
+# HELP node_scrape_collector_timeout node_exporter: Whether a collector ran into its scrape timeout.
+# TYPE node_scrape_collector_timeout gauge
+node_scrape_collector_timeout{collector="fast"} 0
+node_scrape_collector_timeout{collector="slow"} 1
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(nc)
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"node_scrape_collector_success", "node_scrape_collector_timeout"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNodeCollectorTimeoutCancelsContext(t *testing.T) {
+	c := testContextCollector{stopped: make(chan struct{})}
+	nc := NodeCollector{
+		Collectors: map[string]Collector{"ctx": c},
+		timeouts:   map[string]time.Duration{"ctx": 10 * time.Millisecond},
+		logger:     log.NewNopLogger(),
+	}
+	countMetrics(nc)
+
+	select {
+	case <-c.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("context of the timed out collector was not cancelled")
+	}
+}
+
+func TestParseScrapeTimeouts(t *testing.T) {
+	name := "textfile"
+	timeouts, err := parseScrapeTimeouts(5*time.Second, []string{name + "=30s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 30*time.Second, timeouts[name]; want != got {
+		t.Errorf("want timeout %s for %s, got %s", want, name, got)
+	}
+	for c, timeout := range timeouts {
+		if c != name && timeout != 5*time.Second {
+			t.Errorf("want default timeout for %s, got %s", c, timeout)
+		}
+	}
+
+	for _, override := range []string{"textfile", "textfile=soon", "textfile=-1s", "doesnotexist=1s"} {
+		if _, err := parseScrapeTimeouts(0, []string{override}); err == nil {
+			t.Errorf("expected error for override %q", override)
+		}
+	}
+}
+
+func countMetrics(c prometheus.Collector) map[string]int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	counts := map[string]int{}
+	for m := range ch {
+		desc := m.Desc().String()
+		name := desc[strings.Index(desc, `"`)+1:]
+		counts[name[:strings.Index(name, `"`)]]++
+	}
+	return counts
+}
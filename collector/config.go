@@ -0,0 +1,516 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// flagsMtx guards the values of the flags, which ApplyConfig changes.
+	// Collectors read flags while they are created, which holds it for
+	// reading, and copy the values they need later. It is acquired before
+	// initiatedCollectorsMtx and configMtx.
+	flagsMtx  sync.RWMutex
+	configMtx sync.RWMutex
+	// loadedConfig is the configuration file applied last, nil if none.
+	loadedConfig *Config
+	// explicitFlags holds the flags given on the command line, which take
+	// precedence over the configuration file.
+	explicitFlags = map[string]bool{}
+
+	// baseFlags and baseCollectorStates hold the state of everything the
+	// applied configuration file changed from before it was applied, so
+	// that a different file can be applied on top of the command line.
+	baseFlags           = map[string]flagState{}
+	baseCollectorStates = map[string]collectorFlagState{}
+)
+
+type flagState struct {
+	value kingpin.Value
+	// str is the value of a single value flag.
+	str string
+	// slice is a copy of the values of a repeatable flag.
+	slice reflect.Value
+}
+
+type collectorFlagState struct {
+	enabled, forced bool
+}
+
+// Config is the format of the file passed via --config.file.
+type Config struct {
+	// Collectors maps collector names to their settings.
+	Collectors map[string]*CollectorConfig `yaml:"collectors"`
+	// Kstat replaces the file given by --path.kstatcfg.
+	Kstat *kstatConfig `yaml:"kstat"`
+	// Ps replaces the file given by --path.pscfg.
+	Ps *psConfig `yaml:"ps"`
+	// Profiles are named sets of collectors, selected with the profile
+	// URL parameter.
+	Profiles map[string]Profile `yaml:"profiles"`
+	// Targets are alternate filesystem views, such as chroots or container
+	// mount namespaces, scraped via /probe?target=<name>.
+	Targets map[string]Paths `yaml:"targets"`
+	// MetricRelabelConfigs are applied to the metrics of all collectors,
+	// after the collector specific ones.
+	MetricRelabelConfigs []*RelabelConfig `yaml:"metric_relabel_configs"`
+}
+
+// Profile selects collectors like the collect[] and exclude[] URL
+// parameters.
+type Profile struct {
+	Collect []string `yaml:"collect"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// CollectorConfig holds the settings of a single collector.
+type CollectorConfig struct {
+	Enabled *bool
+	// ScrapeTimeout and BackgroundInterval are durations as accepted by
+	// --collector.scrape-timeout.override and --collector.background.
+	ScrapeTimeout      string
+	BackgroundInterval string
+	// MetricRelabelConfigs are applied to the metrics of the collector.
+	MetricRelabelConfigs []*RelabelConfig
+	// Options are set on the collector's flags, keyed by the flag name
+	// without the "collector.<name>." prefix.
+	Options map[string]interface{}
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler. All keys besides the generic
+// collector settings are collected as options.
+func (c *CollectorConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw map[string]interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	c.Options = map[string]interface{}{}
+	for key, value := range raw {
+		switch key {
+		case "enabled":
+			enabled, ok := value.(bool)
+			if !ok {
+				return fmt.Errorf("enabled: expected a boolean, got %v", value)
+			}
+			c.Enabled = &enabled
+		case "scrape-timeout":
+			c.ScrapeTimeout = fmt.Sprint(value)
+		case "background-interval":
+			c.BackgroundInterval = fmt.Sprint(value)
+		case "metric_relabel_configs":
+			// Decode the raw value again to get the relabeling defaults.
+			data, err := yaml.Marshal(value)
+			if err != nil {
+				return err
+			}
+			if err := yaml.UnmarshalStrict(data, &c.MetricRelabelConfigs); err != nil {
+				return fmt.Errorf("metric_relabel_configs: %w", err)
+			}
+		default:
+			c.Options[key] = value
+		}
+	}
+	return nil
+}
+
+// LoadConfig reads and validates a configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration file %q: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func parseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+	for _, name := range cfg.collectorNames() {
+		if err := cfg.Collectors[name].validate(name); err != nil {
+			return nil, err
+		}
+	}
+	for name, profile := range cfg.Profiles {
+		for _, c := range append(profile.Collect, profile.Exclude...) {
+			if _, exist := factories[c]; !exist {
+				return nil, fmt.Errorf("profile %q: unknown collector %q", name, c)
+			}
+		}
+	}
+	for name, paths := range cfg.Targets {
+		if name == "" {
+			return nil, fmt.Errorf("target without name")
+		}
+		if paths == (Paths{}) {
+			return nil, fmt.Errorf("target %q: no paths set", name)
+		}
+	}
+	return cfg, nil
+}
+
+// SelectCollectors resolves a profile from the configuration file and the
+// collect[] and exclude[] URL parameters to the selected collectors, in a
+// stable order. Without any of them, nil is returned to select all enabled
+// collectors.
+func SelectCollectors(profile string, collect, exclude []string) ([]string, error) {
+	if profile == "" && len(collect) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	flagsMtx.RLock()
+	defer flagsMtx.RUnlock()
+	if profile != "" {
+		p, ok := currentConfig().Profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile: %s", profile)
+		}
+		collect = append(append([]string{}, p.Collect...), collect...)
+		exclude = append(append([]string{}, p.Exclude...), exclude...)
+	}
+
+	excluded := make(map[string]bool, len(exclude))
+	for _, name := range exclude {
+		if _, exist := collectorState[name]; !exist {
+			return nil, fmt.Errorf("missing collector: %s", name)
+		}
+		excluded[name] = true
+	}
+
+	selected := map[string]bool{}
+	if len(collect) == 0 {
+		for name, enabled := range collectorState {
+			if *enabled {
+				selected[name] = true
+			}
+		}
+	}
+	for _, name := range collect {
+		selected[name] = true
+	}
+
+	names := make([]string, 0, len(selected))
+	for name := range selected {
+		if !excluded[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no collectors selected")
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (c *CollectorConfig) validate(name string) error {
+	if _, exist := factories[name]; !exist {
+		return fmt.Errorf("unknown collector %q", name)
+	}
+	if c == nil {
+		return nil
+	}
+	if c.ScrapeTimeout != "" {
+		if _, err := time.ParseDuration(c.ScrapeTimeout); err != nil {
+			return fmt.Errorf("collector %q: invalid scrape-timeout: %w", name, err)
+		}
+	}
+	if c.BackgroundInterval != "" {
+		if _, err := time.ParseDuration(c.BackgroundInterval); err != nil {
+			return fmt.Errorf("collector %q: invalid background-interval: %w", name, err)
+		}
+	}
+	for key, value := range c.Options {
+		flag := kingpin.CommandLine.GetFlag(optionFlagName(name, key))
+		if flag == nil {
+			return fmt.Errorf("collector %q: unknown option %q", name, key)
+		}
+		values, err := optionValues(value)
+		if err != nil {
+			return fmt.Errorf("collector %q: option %q: %w", name, key, err)
+		}
+		if len(values) > 1 && !isCumulative(flag) {
+			return fmt.Errorf("collector %q: option %q does not accept a list", name, key)
+		}
+	}
+	return nil
+}
+
+// ApplyConfig sets the collector flags from cfg, skipping all flags which
+// were given explicitly in args. Settings of a previously applied
+// configuration are reverted first, cfg may be nil to only revert them. If
+// cfg cannot be applied, the previous configuration stays in effect. It waits
+// for collectors being created, as they read the flags.
+func ApplyConfig(cfg *Config, args []string) error {
+	explicit, err := explicitFlagNames(args)
+	if err != nil {
+		return err
+	}
+	flagsMtx.Lock()
+	defer flagsMtx.Unlock()
+	return setConfig(cfg, explicit)
+}
+
+// explicitFlagNames returns the names of the flags given in args.
+func explicitFlagNames(args []string) (map[string]bool, error) {
+	ctx, err := kingpin.CommandLine.ParseContext(args)
+	if err != nil {
+		return nil, err
+	}
+	explicit := map[string]bool{}
+	for _, element := range ctx.Elements {
+		if flag, ok := element.Clause.(*kingpin.FlagClause); ok {
+			explicit[flag.Model().Name] = true
+		}
+	}
+	return explicit, nil
+}
+
+// setConfig applies cfg like ApplyConfig, skipping the explicit flags. The
+// caller holds flagsMtx.
+func setConfig(cfg *Config, explicit map[string]bool) error {
+	configMtx.Lock()
+	defer configMtx.Unlock()
+
+	restoreBaseFlags()
+	if err := applyConfig(cfg, explicit); err != nil {
+		restoreBaseFlags()
+		if rerr := applyConfig(loadedConfig, explicitFlags); rerr != nil {
+			return fmt.Errorf("%w (restoring previous configuration failed: %s)", err, rerr)
+		}
+		return err
+	}
+	if defaultCollectorsDisabled {
+		DisableDefaultCollectors()
+	}
+	loadedConfig = cfg
+	explicitFlags = explicit
+	return nil
+}
+
+func applyConfig(cfg *Config, explicit map[string]bool) error {
+	if cfg == nil {
+		return nil
+	}
+	for _, name := range cfg.collectorNames() {
+		c := cfg.Collectors[name]
+		if c == nil {
+			continue
+		}
+		if c.Enabled != nil && !explicit["collector."+name] {
+			if _, saved := baseCollectorStates[name]; !saved {
+				baseCollectorStates[name] = collectorFlagState{enabled: *collectorState[name], forced: forcedCollectors[name]}
+			}
+			*collectorState[name] = *c.Enabled
+			forcedCollectors[name] = true
+		}
+		for key, value := range c.Options {
+			flagName := optionFlagName(name, key)
+			if explicit[flagName] {
+				continue
+			}
+			values, err := optionValues(value)
+			if err != nil {
+				return fmt.Errorf("collector %q: option %q: %w", name, key, err)
+			}
+			flag := kingpin.CommandLine.GetFlag(flagName)
+			if _, saved := baseFlags[flagName]; !saved {
+				state, err := saveFlag(flag)
+				if err != nil {
+					return fmt.Errorf("collector %q: option %q: %w", name, key, err)
+				}
+				baseFlags[flagName] = state
+			}
+			if isCumulative(flag) {
+				// Replace the default values instead of adding to them.
+				resetFlag(baseFlags[flagName])
+			}
+			for _, v := range values {
+				if err := flag.Model().Value.Set(v); err != nil {
+					return fmt.Errorf("collector %q: option %q: %w", name, key, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func saveFlag(flag *kingpin.FlagClause) (flagState, error) {
+	value := flag.Model().Value
+	if !isCumulative(flag) {
+		return flagState{value: value, str: value.String()}, nil
+	}
+	// Repeatable flags return a pointer to their slice of values.
+	getter, ok := value.(kingpin.Getter)
+	if !ok {
+		return flagState{}, fmt.Errorf("unsupported repeatable flag %s", flag.Model().Name)
+	}
+	ptr := reflect.ValueOf(getter.Get())
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Slice {
+		return flagState{}, fmt.Errorf("unsupported repeatable flag %s", flag.Model().Name)
+	}
+	slice := reflect.MakeSlice(ptr.Elem().Type(), ptr.Elem().Len(), ptr.Elem().Len())
+	reflect.Copy(slice, ptr.Elem())
+	return flagState{value: value, slice: slice}, nil
+}
+
+func resetFlag(state flagState) {
+	ptr := reflect.ValueOf(state.value.(kingpin.Getter).Get())
+	ptr.Elem().Set(reflect.Zero(ptr.Elem().Type()))
+}
+
+func restoreBaseFlags() {
+	for _, state := range baseFlags {
+		if state.slice.IsValid() {
+			ptr := reflect.ValueOf(state.value.(kingpin.Getter).Get())
+			slice := reflect.MakeSlice(state.slice.Type(), state.slice.Len(), state.slice.Len())
+			reflect.Copy(slice, state.slice)
+			ptr.Elem().Set(slice)
+		} else {
+			// Restoring a value which was valid before cannot fail.
+			state.value.Set(state.str)
+		}
+	}
+	for name, state := range baseCollectorStates {
+		*collectorState[name] = state.enabled
+		if state.forced {
+			forcedCollectors[name] = true
+		} else {
+			delete(forcedCollectors, name)
+		}
+	}
+	baseFlags = map[string]flagState{}
+	baseCollectorStates = map[string]collectorFlagState{}
+}
+
+// currentConfig returns the applied configuration file, or an empty
+// configuration if there is none.
+func currentConfig() *Config {
+	configMtx.RLock()
+	defer configMtx.RUnlock()
+	if loadedConfig == nil {
+		return &Config{}
+	}
+	return loadedConfig
+}
+
+// flagValue returns the value of flag for the few collectors that read a flag
+// while updating, as they cannot copy it when they are created.
+func flagValue[T any](flag *T) T {
+	flagsMtx.RLock()
+	defer flagsMtx.RUnlock()
+	return *flag
+}
+
+func isExplicitFlag(name string) bool {
+	configMtx.RLock()
+	defer configMtx.RUnlock()
+	return explicitFlags[name]
+}
+
+// collectorNames returns the configured collectors in a stable order.
+func (cfg *Config) collectorNames() []string {
+	names := make([]string, 0, len(cfg.Collectors))
+	for name := range cfg.Collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scrapeTimeoutOverrides returns the configured scrape timeouts in the
+// format of --collector.scrape-timeout.override.
+func (cfg *Config) scrapeTimeoutOverrides() []string {
+	var overrides []string
+	for _, name := range cfg.collectorNames() {
+		if c := cfg.Collectors[name]; c != nil && c.ScrapeTimeout != "" {
+			overrides = append(overrides, name+"="+c.ScrapeTimeout)
+		}
+	}
+	return overrides
+}
+
+// backgroundCollectors returns the configured background collectors in
+// the format of --collector.background.
+func (cfg *Config) backgroundCollectors() []string {
+	var entries []string
+	for _, name := range cfg.collectorNames() {
+		if c := cfg.Collectors[name]; c != nil && c.BackgroundInterval != "" {
+			entries = append(entries, name+"="+c.BackgroundInterval)
+		}
+	}
+	return entries
+}
+
+// relabelConfigs returns the relabeling rules of every collector which has
+// any, the collector specific ones first.
+func (cfg *Config) relabelConfigs() map[string][]*RelabelConfig {
+	relabelConfigs := map[string][]*RelabelConfig{}
+	for name := range factories {
+		var cfgs []*RelabelConfig
+		if c := cfg.Collectors[name]; c != nil {
+			cfgs = append(cfgs, c.MetricRelabelConfigs...)
+		}
+		cfgs = append(cfgs, cfg.MetricRelabelConfigs...)
+		if len(cfgs) > 0 {
+			relabelConfigs[name] = cfgs
+		}
+	}
+	return relabelConfigs
+}
+
+func optionFlagName(collector, option string) string {
+	return fmt.Sprintf("collector.%s.%s", collector, option)
+}
+
+// optionValues converts a YAML scalar or list into flag values.
+func optionValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, ok := item.([]interface{}); ok {
+				return nil, fmt.Errorf("nested lists are not supported")
+			}
+			if _, ok := item.(map[interface{}]interface{}); ok {
+				return nil, fmt.Errorf("maps are not supported")
+			}
+			values = append(values, fmt.Sprint(item))
+		}
+		return values, nil
+	case map[interface{}]interface{}:
+		return nil, fmt.Errorf("maps are not supported")
+	case nil:
+		return nil, fmt.Errorf("missing value")
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
+
+func isCumulative(flag *kingpin.FlagClause) bool {
+	r, ok := flag.Model().Value.(interface{ IsCumulative() bool })
+	return ok && r.IsCumulative()
+}
@@ -0,0 +1,431 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte(`
+collectors:
+  textfile:
+    enabled: false
+    scrape-timeout: 10s
+    background-interval: 1m
+    directory: /var/lib/node_exporter
+  loadavg:
+kstat:
+  kstat_modules:
+    - id: unix
+      kstat_names:
+        - id: system_pages
+          kstat_stats:
+            - id: freemem
+ps:
+  number_cpu: 20
+  number_mem: 15
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	textfile := cfg.Collectors["textfile"]
+	if textfile.Enabled == nil || *textfile.Enabled {
+		t.Errorf("expected textfile to be disabled, got %v", textfile.Enabled)
+	}
+	if want, got := map[string]interface{}{"directory": "/var/lib/node_exporter"}, textfile.Options; !reflect.DeepEqual(want, got) {
+		t.Errorf("want options %v, got %v", want, got)
+	}
+	if want, got := []string{"textfile=10s"}, cfg.scrapeTimeoutOverrides(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want scrape timeout overrides %v, got %v", want, got)
+	}
+	if want, got := []string{"textfile=1m"}, cfg.backgroundCollectors(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want background collectors %v, got %v", want, got)
+	}
+	if cfg.Kstat == nil || cfg.Kstat.KstatModules[0].KstatNames[0].KstatStats[0].ID != "freemem" {
+		t.Errorf("unexpected kstat section %+v", cfg.Kstat)
+	}
+	if cfg.Ps == nil || cfg.Ps.NumberCpu != 20 || cfg.Ps.NumberMem != 15 {
+		t.Errorf("unexpected ps section %+v", cfg.Ps)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{
+			config: "collector:\n  textfile:\n    enabled: true\n",
+			err:    "field collector not found",
+		},
+		{
+			config: "collectors:\n  doesnotexist:\n    enabled: true\n",
+			err:    `unknown collector "doesnotexist"`,
+		},
+		{
+			config: "collectors:\n  textfile:\n    dir: /tmp\n",
+			err:    `collector "textfile": unknown option "dir"`,
+		},
+		{
+			config: "collectors:\n  textfile:\n    enabled: yes please\n",
+			err:    "enabled: expected a boolean",
+		},
+		{
+			config: "collectors:\n  textfile:\n    scrape-timeout: soon\n",
+			err:    "invalid scrape-timeout",
+		},
+		{
+			config: "collectors:\n  textfile:\n    max-age: [1h, 2h]\n",
+			err:    `option "max-age" does not accept a list`,
+		},
+		{
+			config: "ps:\n  number_cpus: 10\n",
+			err:    "field number_cpus not found",
+		},
+		{
+			config: "collectors:\n  textfile:\n    metric_relabel_configs:\n      - action: hashmod\n",
+			err:    "metric_relabel_configs: relabel action hashmod requires a valid target_label",
+		},
+		{
+			config: "metric_relabel_configs:\n  - action: keep\n    regexp: .*\n",
+			err:    "field regexp not found",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := parseConfig([]byte(test.config))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("config %q: expected error containing %q, got %v", test.config, test.err, err)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	oldDirectory, oldEnabled := *textFileDirectory, *collectorState["textfile"]
+	defer func() {
+		ApplyConfig(nil, nil)
+		*textFileDirectory = oldDirectory
+		*collectorState["textfile"] = oldEnabled
+	}()
+
+	cfg, err := parseConfig([]byte(`
+collectors:
+  textfile:
+    enabled: false
+    directory: /from/config
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*textFileDirectory = []string{"/from/flag"}
+	if err := ApplyConfig(cfg, []string{"--collector.textfile.directory=/from/flag"}); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []string{"/from/flag"}, *textFileDirectory; !reflect.DeepEqual(want, got) {
+		t.Errorf("explicit flag should take precedence: want %q, got %q", want, got)
+	}
+	if *collectorState["textfile"] {
+		t.Error("expected textfile collector to be disabled by the configuration")
+	}
+
+	if err := ApplyConfig(cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []string{"/from/config"}, *textFileDirectory; !reflect.DeepEqual(want, got) {
+		t.Errorf("want directory %q from configuration, got %q", want, got)
+	}
+	if currentConfig() != cfg {
+		t.Error("expected the applied configuration to be current")
+	}
+}
+
+// startedCollector closes started once its update began.
+type startedCollector struct {
+	Collector
+	started chan struct{}
+}
+
+func (c startedCollector) Update(ch chan<- prometheus.Metric) error {
+	close(c.started)
+	return c.Collector.Update(ch)
+}
+
+func TestApplyConfigDuringUpdate(t *testing.T) {
+	defer ApplyConfig(nil, nil)
+
+	release := make(chan struct{})
+	defer close(release)
+	c := startedCollector{blockingCollector{release: release}, make(chan struct{})}
+	go update(c, make(chan prometheus.Metric), 0)
+	<-c.started
+
+	applied := make(chan error)
+	go func() {
+		applied <- ApplyConfig(&Config{}, nil)
+	}()
+	select {
+	case err := <-applied:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected ApplyConfig not to wait for a hanging update")
+	}
+}
+
+func TestReload(t *testing.T) {
+	oldStates := map[string]bool{}
+	for name, enabled := range collectorState {
+		oldStates[name] = *enabled
+		*enabled = false
+	}
+	oldDirectory := *textFileDirectory
+	initiatedCollectorsMtx.Lock()
+	oldCollectors := initiatedCollectors
+	initiatedCollectors = map[string]Collector{}
+	initiatedCollectorsMtx.Unlock()
+	defer func() {
+		ApplyConfig(nil, nil)
+		for name, enabled := range oldStates {
+			*collectorState[name] = enabled
+		}
+		*textFileDirectory = oldDirectory
+		initiatedCollectors = oldCollectors
+	}()
+
+	cfg, err := parseConfig([]byte(`
+collectors:
+  textfile:
+    enabled: true
+    directory: fixtures/textfile/two_metric_files
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(cfg, nil, log.NewNopLogger(), nil); err != nil {
+		t.Fatal(err)
+	}
+	nc, err := NewNodeCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	textfile, ok := nc.Collectors["textfile"].(*textFileCollector)
+	if !ok || len(nc.Collectors) != 1 {
+		t.Fatalf("expected only the textfile collector to be enabled, got %v", nc.Collectors)
+	}
+	if want, got := "fixtures/textfile/two_metric_files", textfile.directories[0].path; want != got {
+		t.Errorf("want textfile path %q, got %q", want, got)
+	}
+
+	// A configuration failing on collector creation keeps the previous one.
+	cfg, err = parseConfig([]byte(`
+collectors:
+  textfile:
+    enabled: true
+    scrape-timeout: -1s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(cfg, nil, log.NewNopLogger(), nil); err == nil {
+		t.Fatal("expected reload with negative scrape timeout to fail")
+	}
+	if currentConfig().Collectors["textfile"].Options["directory"] != "fixtures/textfile/two_metric_files" {
+		t.Error("expected the previous configuration to stay in effect")
+	}
+	nc, err = NewNodeCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nc.Collectors["textfile"] != textfile {
+		t.Error("expected the previous collectors to stay in use")
+	}
+
+	// So does a failure to prepare the new collectors.
+	cfg, err = parseConfig([]byte(`
+collectors:
+  textfile:
+    enabled: true
+    directory: fixtures/textfile/no_metric_files
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Reload(cfg, nil, log.NewNopLogger(), func(nc *NodeCollector) error {
+		if nc.Collectors["textfile"] == textfile {
+			t.Error("expected new collectors to be prepared")
+		}
+		return errors.New("prepare failed")
+	})
+	if err == nil || err.Error() != "prepare failed" {
+		t.Fatalf("expected reload to fail with the error of prepare, got %v", err)
+	}
+	if currentConfig().Collectors["textfile"].Options["directory"] != "fixtures/textfile/two_metric_files" {
+		t.Error("expected the previous configuration to stay in effect")
+	}
+	nc, err = NewNodeCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nc.Collectors["textfile"] != textfile {
+		t.Error("expected the previous collectors to stay in use")
+	}
+
+	// Reloading without configuration file reverts its settings.
+	if err := Reload(nil, nil, log.NewNopLogger(), nil); err != nil {
+		t.Fatal(err)
+	}
+	nc, err = NewNodeCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nc.Collectors) != 0 {
+		t.Errorf("expected no collectors after reverting the configuration, got %v", nc.Collectors)
+	}
+}
+
+// TestReloadConcurrentNodeCollectors is meant to be run with -race.
+func TestReloadConcurrentNodeCollectors(t *testing.T) {
+	oldStates := map[string]bool{}
+	for name, enabled := range collectorState {
+		oldStates[name] = *enabled
+		*enabled = false
+	}
+	oldDirectory := *textFileDirectory
+	initiatedCollectorsMtx.Lock()
+	oldCollectors := initiatedCollectors
+	initiatedCollectors = map[string]Collector{}
+	initiatedCollectorsMtx.Unlock()
+	defer func() {
+		ApplyConfig(nil, nil)
+		for name, enabled := range oldStates {
+			*collectorState[name] = enabled
+		}
+		*textFileDirectory = oldDirectory
+		initiatedCollectors = oldCollectors
+	}()
+
+	cfg, err := parseConfig([]byte(`
+collectors:
+  textfile:
+    enabled: true
+    directory: fixtures/textfile/two_metric_files
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const goroutines = 4
+	done := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func() {
+			for i := 0; i < 1000; i++ {
+				if _, err := NewNodeCollector(log.NewNopLogger()); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		if err := Reload(cfg, nil, log.NewNopLogger(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := Reload(nil, nil, log.NewNopLogger(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for g := 0; g < goroutines; g++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSelectCollectors(t *testing.T) {
+	oldStates := map[string]bool{}
+	for name, enabled := range collectorState {
+		oldStates[name] = *enabled
+		*enabled = name == "loadavg" || name == "textfile" || name == "meminfo"
+	}
+	defer func() {
+		ApplyConfig(nil, nil)
+		for name, enabled := range oldStates {
+			*collectorState[name] = enabled
+		}
+	}()
+
+	cfg, err := parseConfig([]byte(`
+profiles:
+  fast:
+    collect: [loadavg, meminfo]
+  slow:
+    exclude: [loadavg]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyConfig(cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		profile          string
+		collect, exclude []string
+		want             []string
+		err              string
+	}{
+		{},
+		{collect: []string{"textfile"}, want: []string{"textfile"}},
+		{exclude: []string{"textfile"}, want: []string{"loadavg", "meminfo"}},
+		{collect: []string{"loadavg", "textfile"}, exclude: []string{"textfile"}, want: []string{"loadavg"}},
+		{profile: "fast", want: []string{"loadavg", "meminfo"}},
+		{profile: "fast", exclude: []string{"meminfo"}, want: []string{"loadavg"}},
+		{profile: "slow", want: []string{"meminfo", "textfile"}},
+		{profile: "doesnotexist", err: "unknown profile: doesnotexist"},
+		{exclude: []string{"doesnotexist"}, err: "missing collector: doesnotexist"},
+		{collect: []string{"textfile"}, exclude: []string{"textfile"}, err: "no collectors selected"},
+	}
+	for _, test := range tests {
+		got, err := SelectCollectors(test.profile, test.collect, test.exclude)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%+v: expected error %q, got %v", test, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %s", test, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.want, got) {
+			t.Errorf("%+v: want %v, got %v", test, test.want, got)
+		}
+	}
+
+	if _, err := parseConfig([]byte("profiles:\n  broken:\n    exclude: [doesnotexist]\n")); err == nil {
+		t.Error("expected profile with unknown collector to be rejected")
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"slices"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
@@ -45,10 +46,14 @@ type cpuCollector struct {
 	cpuCoreThrottle    *prometheus.Desc
 	cpuPackageThrottle *prometheus.Desc
 	cpuIsolated        *prometheus.Desc
+	paths              Paths
 	logger             log.Logger
 	cpuStats           map[int64]procfs.CPUStat
 	cpuStatsMutex      sync.Mutex
 	isolatedCpus       []uint16
+	enableInfo         bool
+	enableGuest        bool
+	cpuFreqEnabled     *bool
 
 	cpuFlagsIncludeRegexp *regexp.Regexp
 	cpuBugsIncludeRegexp  *regexp.Regexp
@@ -90,8 +95,9 @@ func NewCPUCollector(logger log.Logger) (Collector, error) {
 	}
 
 	c := &cpuCollector{
-		fs:  fs,
-		cpu: nodeCPUSecondsDesc,
+		fs:    fs,
+		paths: currentPaths(),
+		cpu:   nodeCPUSecondsDesc,
 		cpuInfo: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, cpuCollectorSubsystem, "info"),
 			"CPU information from /proc/cpuinfo.",
@@ -135,6 +141,12 @@ func NewCPUCollector(logger log.Logger) (Collector, error) {
 		logger:       logger,
 		isolatedCpus: isolcpus,
 		cpuStats:     make(map[int64]procfs.CPUStat),
+		enableInfo:   *enableCPUInfo,
+		enableGuest:  *enableCPUGuest,
+	}
+	if cpuFreqEnabled, ok := collectorState["cpufreq"]; ok && cpuFreqEnabled != nil {
+		enabled := *cpuFreqEnabled
+		c.cpuFreqEnabled = &enabled
 	}
 	err = c.compileIncludeFlags(flagsInclude, bugsInclude)
 	if err != nil {
@@ -144,8 +156,8 @@ func NewCPUCollector(logger log.Logger) (Collector, error) {
 }
 
 func (c *cpuCollector) compileIncludeFlags(flagsIncludeFlag, bugsIncludeFlag *string) error {
-	if (*flagsIncludeFlag != "" || *bugsIncludeFlag != "") && !*enableCPUInfo {
-		*enableCPUInfo = true
+	if (*flagsIncludeFlag != "" || *bugsIncludeFlag != "") && !c.enableInfo {
+		c.enableInfo = true
 		level.Info(c.logger).Log("msg", "--collector.cpu.info has been set to `true` because you set the following flags, like --collector.cpu.info.flags-include and --collector.cpu.info.bugs-include")
 	}
 
@@ -167,7 +179,7 @@ func (c *cpuCollector) compileIncludeFlags(flagsIncludeFlag, bugsIncludeFlag *st
 
 // Update implements Collector and exposes cpu related metrics from /proc/stat and /sys/.../cpu/.
 func (c *cpuCollector) Update(ch chan<- prometheus.Metric) error {
-	if *enableCPUInfo {
+	if c.enableInfo {
 		if err := c.updateInfo(ch); err != nil {
 			return err
 		}
@@ -203,10 +215,9 @@ func (c *cpuCollector) updateInfo(ch chan<- prometheus.Metric) error {
 			cpu.CacheSize)
 	}
 
-	cpuFreqEnabled, ok := collectorState["cpufreq"]
-	if !ok || cpuFreqEnabled == nil {
+	if c.cpuFreqEnabled == nil {
 		level.Debug(c.logger).Log("msg", "cpufreq key missing or nil value in collectorState map")
-	} else if !*cpuFreqEnabled {
+	} else if !*c.cpuFreqEnabled {
 		for _, cpu := range info {
 			ch <- prometheus.MustNewConstMetric(c.cpuFrequencyHz,
 				prometheus.GaugeValue,
@@ -250,7 +261,7 @@ func updateFieldInfo(valueList []string, filter *regexp.Regexp, desc *prometheus
 
 // updateThermalThrottle reads /sys/devices/system/cpu/cpu* and expose thermal throttle statistics.
 func (c *cpuCollector) updateThermalThrottle(ch chan<- prometheus.Metric) error {
-	cpus, err := filepath.Glob(sysFilePath("devices/system/cpu/cpu[0-9]*"))
+	cpus, err := filepath.Glob(c.paths.sysFilePath("devices/system/cpu/cpu[0-9]*"))
 	if err != nil {
 		return err
 	}
@@ -343,24 +354,27 @@ func (c *cpuCollector) updateStat(ch chan<- prometheus.Metric) error {
 
 	c.updateCPUStats(stats.CPU)
 
+	// The counters of /proc/stat start at boot.
+	bootTime := time.Unix(int64(stats.BootTime), 0)
+
 	// Acquire a lock to read the stats.
 	c.cpuStatsMutex.Lock()
 	defer c.cpuStatsMutex.Unlock()
 	for cpuID, cpuStat := range c.cpuStats {
 		cpuNum := strconv.Itoa(int(cpuID))
-		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.User, cpuNum, "user")
-		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.Nice, cpuNum, "nice")
-		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.System, cpuNum, "system")
-		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.Idle, cpuNum, "idle")
-		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.Iowait, cpuNum, "iowait")
-		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.IRQ, cpuNum, "irq")
-		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.SoftIRQ, cpuNum, "softirq")
-		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.Steal, cpuNum, "steal")
-
-		if *enableCPUGuest {
+		ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.cpu, prometheus.CounterValue, cpuStat.User, bootTime, cpuNum, "user")
+		ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.cpu, prometheus.CounterValue, cpuStat.Nice, bootTime, cpuNum, "nice")
+		ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.cpu, prometheus.CounterValue, cpuStat.System, bootTime, cpuNum, "system")
+		ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.cpu, prometheus.CounterValue, cpuStat.Idle, bootTime, cpuNum, "idle")
+		ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.cpu, prometheus.CounterValue, cpuStat.Iowait, bootTime, cpuNum, "iowait")
+		ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.cpu, prometheus.CounterValue, cpuStat.IRQ, bootTime, cpuNum, "irq")
+		ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.cpu, prometheus.CounterValue, cpuStat.SoftIRQ, bootTime, cpuNum, "softirq")
+		ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.cpu, prometheus.CounterValue, cpuStat.Steal, bootTime, cpuNum, "steal")
+
+		if c.enableGuest {
 			// Guest CPU is also accounted for in cpuStat.User and cpuStat.Nice, expose these as separate metrics.
-			ch <- prometheus.MustNewConstMetric(c.cpuGuest, prometheus.CounterValue, cpuStat.Guest, cpuNum, "user")
-			ch <- prometheus.MustNewConstMetric(c.cpuGuest, prometheus.CounterValue, cpuStat.GuestNice, cpuNum, "nice")
+			ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.cpuGuest, prometheus.CounterValue, cpuStat.Guest, bootTime, cpuNum, "user")
+			ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.cpuGuest, prometheus.CounterValue, cpuStat.GuestNice, bootTime, cpuNum, "nice")
 		}
 	}
 
@@ -92,8 +92,8 @@ func ioctl(fd int, nr int64, typ byte, size uintptr, retptr unsafe.Pointer) erro
 	return nil
 }
 
-func readSysmonProperties() (sysmonProperties, error) {
-	fd, err := unix.Open(rootfsFilePath("/dev/sysmon"), unix.O_RDONLY, 0777)
+func readSysmonProperties(paths Paths) (sysmonProperties, error) {
+	fd, err := unix.Open(paths.rootfsFilePath("/dev/sysmon"), unix.O_RDONLY, 0777)
 	if err != nil {
 		return nil, err
 	}
@@ -142,12 +142,12 @@ func convertTemperatures(prop sysmonProperty, res map[int]float64) error {
 	return nil
 }
 
-func getCPUTemperatures() (map[int]float64, error) {
+func getCPUTemperatures(paths Paths) (map[int]float64, error) {
 
 	res := make(map[int]float64)
 
 	// Read all properties
-	props, err := readSysmonProperties()
+	props, err := readSysmonProperties(paths)
 	if err != nil {
 		return res, err
 	}
@@ -214,6 +214,7 @@ func getCPUTimes() ([]cputime, error) {
 type statCollector struct {
 	cpu    typedDesc
 	temp   typedDesc
+	paths  Paths
 	logger log.Logger
 }
 
@@ -230,6 +231,7 @@ func NewStatCollector(logger log.Logger) (Collector, error) {
 			"CPU temperature",
 			[]string{"cpu"}, nil,
 		), prometheus.GaugeValue},
+		paths:  currentPaths(),
 		logger: logger,
 	}, nil
 }
@@ -253,7 +255,7 @@ func (c *statCollector) Update(ch chan<- prometheus.Metric) error {
 		return err
 	}
 
-	cpuTemperatures, err := getCPUTemperatures()
+	cpuTemperatures, err := getCPUTemperatures(c.paths)
 	if err != nil {
 		return err
 	}
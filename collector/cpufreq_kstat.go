@@ -0,0 +1,80 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nocpu
+// +build !nocpu
+
+package collector
+
+import (
+	"strconv"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type cpuFreqKstatCollector struct {
+	open   kstatOpener
+	logger log.Logger
+}
+
+func newCPUFreqKstatCollector(open kstatOpener, logger log.Logger) *cpuFreqKstatCollector {
+	return &cpuFreqKstatCollector{
+		open:   open,
+		logger: logger,
+	}
+}
+
+func (c *cpuFreqKstatCollector) Update(ch chan<- prometheus.Metric) error {
+	r, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	defer r.close()
+
+	// Walk the kstat chain, as the IDs of online CPUs may have gaps.
+	for _, id := range r.list() {
+		if id.module != "cpu_info" || id.name != "cpu_info"+strconv.Itoa(id.instance) {
+			continue
+		}
+		stats, err := r.read(id)
+		if err != nil {
+			return err
+		}
+		cpuFreq, err := stats.value("current_clock_Hz")
+		if err != nil {
+			return err
+		}
+		cpuFreqMax, err := stats.value("clock_MHz")
+		if err != nil {
+			return err
+		}
+
+		lcpu := strconv.Itoa(id.instance)
+		ch <- prometheus.MustNewConstMetric(
+			cpuFreqHertzDesc,
+			prometheus.GaugeValue,
+			cpuFreq,
+			lcpu,
+		)
+		// Multiply by 1e+6 to convert MHz to Hz.
+		ch <- prometheus.MustNewConstMetric(
+			cpuFreqMaxDesc,
+			prometheus.GaugeValue,
+			cpuFreqMax*1e+6,
+			lcpu,
+		)
+	}
+	return nil
+}
@@ -17,70 +17,13 @@
 package collector
 
 import (
-	"fmt"
-	"strconv"
-
 	"github.com/go-kit/log"
-	"github.com/illumos/go-kstat"
-	"github.com/prometheus/client_golang/prometheus"
 )
 
-// #include <unistd.h>
-import "C"
-
-type cpuFreqCollector struct {
-	logger log.Logger
-}
-
 func init() {
 	registerCollector("cpufreq", defaultEnabled, NewCpuFreqCollector)
 }
 
 func NewCpuFreqCollector(logger log.Logger) (Collector, error) {
-	return &cpuFreqCollector{
-		logger: logger,
-	}, nil
-}
-
-func (c *cpuFreqCollector) Update(ch chan<- prometheus.Metric) error {
-	ncpus := C.sysconf(C._SC_NPROCESSORS_ONLN)
-
-	tok, err := kstat.Open()
-	if err != nil {
-		return err
-	}
-
-	defer tok.Close()
-
-	for cpu := 0; cpu < int(ncpus); cpu++ {
-		ksCPUInfo, err := tok.Lookup("cpu_info", cpu, fmt.Sprintf("cpu_info%d", cpu))
-		if err != nil {
-			return err
-		}
-		cpuFreqV, err := ksCPUInfo.GetNamed("current_clock_Hz")
-		if err != nil {
-			return err
-		}
-
-		cpuFreqMaxV, err := ksCPUInfo.GetNamed("clock_MHz")
-		if err != nil {
-			return err
-		}
-
-		lcpu := strconv.Itoa(cpu)
-		ch <- prometheus.MustNewConstMetric(
-			cpuFreqHertzDesc,
-			prometheus.GaugeValue,
-			float64(cpuFreqV.UintVal),
-			lcpu,
-		)
-		// Multiply by 1e+6 to convert MHz to Hz.
-		ch <- prometheus.MustNewConstMetric(
-			cpuFreqMaxDesc,
-			prometheus.GaugeValue,
-			float64(cpuFreqMaxV.IntVal)*1e+6,
-			lcpu,
-		)
-	}
-	return nil
+	return newCPUFreqKstatCollector(openKstatReader, logger), nil
 }
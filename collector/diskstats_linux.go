@@ -85,8 +85,9 @@ type diskstatsCollector struct {
 	filesystemInfoDesc      typedFactorDesc
 	deviceMapperInfoDesc    typedFactorDesc
 	ataDescs                map[string]typedFactorDesc
+	paths                   Paths
 	logger                  log.Logger
-	getUdevDeviceProperties func(uint32, uint32) (udevInfo, error)
+	getUdevDeviceProperties func(Paths, uint32, uint32) (udevInfo, error)
 }
 
 func init() {
@@ -257,6 +258,7 @@ func NewDiskstatsCollector(logger log.Logger) (Collector, error) {
 				), valueType: prometheus.GaugeValue,
 			},
 		},
+		paths:  currentPaths(),
 		logger: logger,
 	}
 
@@ -282,7 +284,7 @@ func (c *diskstatsCollector) Update(ch chan<- prometheus.Metric) error {
 			continue
 		}
 
-		info, err := getUdevDeviceProperties(stats.MajorNumber, stats.MinorNumber)
+		info, err := getUdevDeviceProperties(c.paths, stats.MajorNumber, stats.MinorNumber)
 		if err != nil {
 			level.Debug(c.logger).Log("msg", "Failed to parse udev info", "err", err)
 		}
@@ -370,8 +372,8 @@ func (c *diskstatsCollector) Update(ch chan<- prometheus.Metric) error {
 	return nil
 }
 
-func getUdevDeviceProperties(major, minor uint32) (udevInfo, error) {
-	filename := udevDataFilePath(fmt.Sprintf("b%d:%d", major, minor))
+func getUdevDeviceProperties(paths Paths, major, minor uint32) (udevInfo, error) {
+	filename := paths.udevDataFilePath(fmt.Sprintf("b%d:%d", major, minor))
 
 	data, err := os.Open(filename)
 	if err != nil {
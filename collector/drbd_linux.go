@@ -79,6 +79,7 @@ type drbdCollector struct {
 	numerical  map[string]drbdNumericalMetric
 	stringPair map[string]drbdStringPairMetric
 	connected  *prometheus.Desc
+	paths      Paths
 	logger     log.Logger
 }
 
@@ -182,12 +183,13 @@ func newDRBDCollector(logger log.Logger) (Collector, error) {
 			[]string{"device"},
 			nil,
 		),
+		paths:  currentPaths(),
 		logger: logger,
 	}, nil
 }
 
 func (c *drbdCollector) Update(ch chan<- prometheus.Metric) error {
-	statsFile := procFilePath("drbd")
+	statsFile := c.paths.procFilePath("drbd")
 	file, err := os.Open(statsFile)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
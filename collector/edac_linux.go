@@ -39,6 +39,7 @@ type edacCollector struct {
 	ueCount      *prometheus.Desc
 	csRowCECount *prometheus.Desc
 	csRowUECount *prometheus.Desc
+	paths        Paths
 	logger       log.Logger
 }
 
@@ -69,12 +70,13 @@ func NewEdacCollector(logger log.Logger) (Collector, error) {
 			"Total uncorrectable memory errors for this csrow.",
 			[]string{"controller", "csrow"}, nil,
 		),
+		paths:  currentPaths(),
 		logger: logger,
 	}, nil
 }
 
 func (c *edacCollector) Update(ch chan<- prometheus.Metric) error {
-	memControllers, err := filepath.Glob(sysFilePath("devices/system/edac/mc/mc[0-9]*"))
+	memControllers, err := filepath.Glob(c.paths.sysFilePath("devices/system/edac/mc/mc[0-9]*"))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,243 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	execTimeout = kingpin.Flag(
+		"collector.exec.timeout",
+		"Maximum duration of a command run by a collector, such as zpool or iostat. The command is killed when exceeding it. 0 disables the timeout.",
+	).Default("30s").Duration()
+	execTimeoutOverrides = kingpin.Flag(
+		"collector.exec.timeout.override",
+		"Per-command timeout in the form <command>=<duration>, overriding --collector.exec.timeout. Can be repeated.",
+	).Strings()
+	execPaths = kingpin.Flag(
+		"collector.exec.path",
+		"Path of a command run by collectors in the form <command>=<path>, e.g. zpool=/usr/sbin/zpool. Commands are looked up in $PATH by default. Can be repeated.",
+	).Strings()
+)
+
+// execCommands are the commands collectors are allowed to run.
+var execCommands = map[string]bool{
+	"dladm":  true,
+	"iostat": true,
+	"zfs":    true,
+	"zpool":  true,
+}
+
+// Reasons of a failed command.
+const (
+	execFailureStart   = "start"
+	execFailureExit    = "exit"
+	execFailureTimeout = "timeout"
+)
+
+// execStderrLimit bounds the stderr output kept in a commandError.
+const execStderrLimit = 1024
+
+// commandError describes a command which failed to start, exited with a
+// non-zero status or was killed after its timeout.
+type commandError struct {
+	Command  string
+	Args     []string
+	Reason   string
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (e *commandError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "command %q", strings.Join(append([]string{e.Command}, e.Args...), " "))
+	switch e.Reason {
+	case execFailureTimeout:
+		b.WriteString(" timed out")
+	case execFailureExit:
+		fmt.Fprintf(&b, " exited with status %d", e.ExitCode)
+	default:
+		fmt.Fprintf(&b, " failed: %s", e.Err)
+	}
+	if e.Stderr != "" {
+		fmt.Fprintf(&b, ": %s", e.Stderr)
+	}
+	return b.String()
+}
+
+func (e *commandError) Unwrap() error {
+	return e.Err
+}
+
+// commandRunner runs the commands of a collector with a timeout and keeps
+// track of their duration and failures.
+type commandRunner struct {
+	paths          map[string]string
+	defaultTimeout time.Duration
+	timeouts       map[string]time.Duration
+	duration       *prometheus.HistogramVec
+	failures       *prometheus.CounterVec
+}
+
+// newCommandRunner creates a commandRunner for the named collector from the
+// flags.
+func newCommandRunner(collector string) (*commandRunner, error) {
+	return newCommandRunnerFrom(collector, *execTimeout, *execTimeoutOverrides, *execPaths)
+}
+
+func newCommandRunnerFrom(collector string, timeout time.Duration, timeoutOverrides, paths []string) (*commandRunner, error) {
+	if timeout < 0 {
+		return nil, fmt.Errorf("invalid exec timeout %s: must not be negative", timeout)
+	}
+	r := &commandRunner{
+		paths:          make(map[string]string),
+		defaultTimeout: timeout,
+		timeouts:       make(map[string]time.Duration),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:   namespace,
+				Subsystem:   "exec",
+				Name:        "command_duration_seconds",
+				Help:        "node_exporter: Duration of the commands run by a collector.",
+				Buckets:     []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60},
+				ConstLabels: prometheus.Labels{"collector": collector},
+			},
+			[]string{"command"},
+		),
+		failures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "exec",
+				Name:        "command_failures_total",
+				Help:        "node_exporter: Number of commands run by a collector which failed to start, exited with a non-zero status or timed out.",
+				ConstLabels: prometheus.Labels{"collector": collector},
+			},
+			[]string{"command", "reason"},
+		),
+	}
+	for _, override := range timeoutOverrides {
+		name, value, err := parseExecSetting(override)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exec timeout override %q: %w", override, err)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exec timeout override %q: %w", override, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("invalid exec timeout override %q: must not be negative", override)
+		}
+		r.timeouts[name] = d
+	}
+	for _, path := range paths {
+		name, value, err := parseExecSetting(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exec path %q: %w", path, err)
+		}
+		r.paths[name] = value
+	}
+	return r, nil
+}
+
+// parseExecSetting splits a <command>=<value> setting.
+func parseExecSetting(setting string) (string, string, error) {
+	name, value, ok := strings.Cut(setting, "=")
+	if !ok || value == "" {
+		return "", "", errors.New("expected <command>=<value>")
+	}
+	if !execCommands[name] {
+		return "", "", fmt.Errorf("unknown command: %s", name)
+	}
+	return name, value, nil
+}
+
+// run runs the named command with args and returns its standard output. The
+// command is killed when ctx is done or its timeout passes.
+func (r *commandRunner) run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	timeout, ok := r.timeouts[name]
+	if !ok {
+		timeout = r.defaultTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	path, ok := r.paths[name]
+	if !ok {
+		path = name
+	}
+
+	for _, reason := range []string{execFailureStart, execFailureExit, execFailureTimeout} {
+		r.failures.WithLabelValues(name, reason)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait for children inheriting the output pipes of a killed command.
+	cmd.WaitDelay = time.Second
+
+	begin := time.Now()
+	err := cmd.Run()
+	r.duration.WithLabelValues(name).Observe(time.Since(begin).Seconds())
+	if err == nil {
+		return stdout.Bytes(), nil
+	}
+
+	cerr := &commandError{
+		Command: name,
+		Args:    args,
+		Reason:  execFailureStart,
+		Stderr:  truncateStderr(stderr.String()),
+		Err:     err,
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		cerr.Reason = execFailureTimeout
+		cerr.Err = ctx.Err()
+	case errors.As(err, &exitErr):
+		cerr.Reason = execFailureExit
+		cerr.ExitCode = exitErr.ExitCode()
+	}
+	r.failures.WithLabelValues(name, cerr.Reason).Inc()
+	return nil, cerr
+}
+
+func truncateStderr(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > execStderrLimit {
+		s = strings.ToValidUTF8(s[:execStderrLimit], "") + "..."
+	}
+	return s
+}
+
+// collect sends the duration and failures of the commands run so far.
+func (r *commandRunner) collect(ch chan<- prometheus.Metric) {
+	r.duration.Collect(ch)
+	r.failures.Collect(ch)
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// execScript writes an executable shell script with body and returns its path.
+func execScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCommandRunner(t *testing.T) {
+	r, err := newCommandRunnerFrom("test", time.Minute, []string{"zfs=100ms"}, []string{
+		"zpool=" + execScript(t, `echo "$@"; echo ignored >&2`),
+		"iostat=" + execScript(t, "echo broken pool >&2; exit 3"),
+		"zfs=" + execScript(t, "exec sleep 10"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := r.run(context.Background(), "zpool", "get", "-Hp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "get -Hp\n"; string(out) != want {
+		t.Errorf("want output %q, got %q", want, out)
+	}
+
+	_, err = r.run(context.Background(), "iostat", "-en")
+	var cerr *commandError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("want commandError, got %v", err)
+	}
+	if cerr.Reason != execFailureExit || cerr.ExitCode != 3 || cerr.Stderr != "broken pool" {
+		t.Errorf("unexpected error %+v", cerr)
+	}
+	if want := `command "iostat -en" exited with status 3: broken pool`; err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err)
+	}
+
+	begin := time.Now()
+	_, err = r.run(context.Background(), "zfs", "list")
+	if !errors.As(err, &cerr) || cerr.Reason != execFailureTimeout {
+		t.Errorf("want timeout, got %v", err)
+	}
+	if d := time.Since(begin); d > 5*time.Second {
+		t.Errorf("command wasn't killed after its timeout, took %s", d)
+	}
+
+	r.paths["zpool"] = filepath.Join(t.TempDir(), "missing")
+	_, err = r.run(context.Background(), "zpool", "status")
+	if !errors.As(err, &cerr) || cerr.Reason != execFailureStart || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("want start failure, got %v", err)
+	}
+
+	for _, f := range []struct {
+		command, reason string
+		want            float64
+	}{
+		{"zpool", execFailureStart, 1},
+		{"zpool", execFailureExit, 0},
+		{"iostat", execFailureExit, 1},
+		{"zfs", execFailureTimeout, 1},
+	} {
+		if got := testutil.ToFloat64(r.failures.WithLabelValues(f.command, f.reason)); got != f.want {
+			t.Errorf("want %v %s failures of %s, got %v", f.want, f.reason, f.command, got)
+		}
+	}
+	if got := testutil.CollectAndCount(r.duration); got != 3 {
+		t.Errorf("want durations of 3 commands, got %d", got)
+	}
+}
+
+func TestCommandRunnerSettings(t *testing.T) {
+	for _, tc := range []struct {
+		timeouts, paths []string
+		err             string
+	}{
+		{timeouts: []string{"zpool"}, err: "expected <command>=<value>"},
+		{timeouts: []string{"zpool=soon"}, err: "invalid duration"},
+		{timeouts: []string{"zpool=-1s"}, err: "must not be negative"},
+		{paths: []string{"ls=/bin/ls"}, err: "unknown command: ls"},
+		{paths: []string{"zfs="}, err: "expected <command>=<value>"},
+	} {
+		_, err := newCommandRunnerFrom("test", time.Second, tc.timeouts, tc.paths)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%v %v: want error containing %q, got %v", tc.timeouts, tc.paths, tc.err, err)
+		}
+	}
+}
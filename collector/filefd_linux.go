@@ -32,6 +32,7 @@ const (
 )
 
 type fileFDStatCollector struct {
+	paths  Paths
 	logger log.Logger
 }
 
@@ -41,11 +42,11 @@ func init() {
 
 // NewFileFDStatCollector returns a new Collector exposing file-nr stats.
 func NewFileFDStatCollector(logger log.Logger) (Collector, error) {
-	return &fileFDStatCollector{logger}, nil
+	return &fileFDStatCollector{paths: currentPaths(), logger: logger}, nil
 }
 
 func (c *fileFDStatCollector) Update(ch chan<- prometheus.Metric) error {
-	fileFDStat, err := parseFileFDStats(procFilePath("sys/fs/file-nr"))
+	fileFDStat, err := parseFileFDStats(c.paths.procFilePath("sys/fs/file-nr"))
 	if err != nil {
 		return fmt.Errorf("couldn't get file-nr: %w", err)
 	}
@@ -20,6 +20,7 @@ package collector
 import (
 	"errors"
 	"regexp"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
@@ -60,6 +61,13 @@ var (
 		"Regexp of filesystem types to ignore for filesystem collector.",
 	).Hidden().String()
 
+	mountTimeout = kingpin.Flag("collector.filesystem.mount-timeout",
+		"how long to wait for a mount to respond before marking it as stale").
+		Hidden().Default("5s").Duration()
+	statWorkerCount = kingpin.Flag("collector.filesystem.stat-workers",
+		"how many stat calls to process simultaneously").
+		Hidden().Default("4").Int()
+
 	filesystemLabelNames = []string{"device", "mountpoint", "fstype", "device_error"}
 )
 
@@ -69,6 +77,9 @@ type filesystemCollector struct {
 	sizeDesc, freeDesc, availDesc *prometheus.Desc
 	filesDesc, filesFreeDesc      *prometheus.Desc
 	roDesc, deviceErrorDesc       *prometheus.Desc
+	mountTimeout                  time.Duration
+	statWorkerCount               int
+	paths                         Paths
 	logger                        log.Logger
 }
 
@@ -165,6 +176,9 @@ func NewFilesystemCollector(logger log.Logger) (Collector, error) {
 		filesFreeDesc:              filesFreeDesc,
 		roDesc:                     roDesc,
 		deviceErrorDesc:            deviceErrorDesc,
+		mountTimeout:               *mountTimeout,
+		statWorkerCount:            *statWorkerCount,
+		paths:                      currentPaths(),
 		logger:                     logger,
 	}, nil
 }
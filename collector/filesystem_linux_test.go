@@ -37,7 +37,7 @@ func Test_parseFilesystemLabelsError(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if _, err := parseFilesystemLabels(strings.NewReader(tt.in)); err == nil {
+			if _, err := parseFilesystemLabels(strings.NewReader(tt.in), currentPaths()); err == nil {
 				t.Fatal("expected an error, but none occurred")
 			}
 		})
@@ -82,7 +82,7 @@ func TestMountPointDetails(t *testing.T) {
 		"/var/lib/kubelet/plugins/kubernetes.io/vsphere-volume/mounts/[vsanDatastore]	bafb9e5a-8856-7e6c-699c-801844e77a4a/kubernetes-dynamic-pvc-3eba5bba-48a3-11e8-89ab-005056b92113.vmdk": "",
 	}
 
-	filesystems, err := mountPointDetails(log.NewNopLogger())
+	filesystems, err := mountPointDetails(currentPaths(), log.NewNopLogger())
 	if err != nil {
 		t.Log(err)
 	}
@@ -103,7 +103,7 @@ func TestMountsFallback(t *testing.T) {
 		"/": "",
 	}
 
-	filesystems, err := mountPointDetails(log.NewNopLogger())
+	filesystems, err := mountPointDetails(currentPaths(), log.NewNopLogger())
 	if err != nil {
 		t.Log(err)
 	}
@@ -131,7 +131,7 @@ func TestPathRootfs(t *testing.T) {
 		"/sys/fs/cgroup": "",
 	}
 
-	filesystems, err := mountPointDetails(log.NewNopLogger())
+	filesystems, err := mountPointDetails(currentPaths(), log.NewNopLogger())
 	if err != nil {
 		t.Log(err)
 	}
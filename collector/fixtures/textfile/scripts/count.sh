@@ -0,0 +1,5 @@
+#!/bin/sh
+# Counts its runs in the file given as the first argument.
+runs=$(( $(cat "$1" 2>/dev/null || echo 0) + 1 ))
+echo $runs > "$1"
+echo "script_runs $runs"
@@ -0,0 +1,4 @@
+#!/bin/sh
+echo "script_failed 1"
+echo "broken backup" >&2
+exit 3
@@ -0,0 +1,6 @@
+#!/bin/sh
+i=0
+while [ $i -lt 100 ]; do
+	echo "script_large{i=\"$i\"} 1"
+	i=$((i + 1))
+done
@@ -0,0 +1,5 @@
+#!/bin/sh
+# Writes a metric labelled with the first argument.
+echo "# HELP script_info Information about the script."
+echo "# TYPE script_info gauge"
+echo "script_info{arg=\"$1\"} 1"
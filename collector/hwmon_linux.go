@@ -52,6 +52,7 @@ func init() {
 
 type hwMonCollector struct {
 	deviceFilter deviceFilter
+	paths        Paths
 	logger       log.Logger
 }
 
@@ -61,6 +62,7 @@ func NewHwMonCollector(logger log.Logger) (Collector, error) {
 
 	return &hwMonCollector{
 		logger:       logger,
+		paths:        currentPaths(),
 		deviceFilter: newDeviceFilter(*collectorHWmonChipExclude, *collectorHWmonChipInclude),
 	}, nil
 }
@@ -432,7 +434,7 @@ func (c *hwMonCollector) Update(ch chan<- prometheus.Metric) error {
 	// Step 1: scan /sys/class/hwmon, resolve all symlinks and call
 	//         updatesHwmon for each folder
 
-	hwmonPathName := filepath.Join(sysFilePath("class"), "hwmon")
+	hwmonPathName := filepath.Join(c.paths.sysFilePath("class"), "hwmon")
 
 	hwmonFiles, err := os.ReadDir(hwmonPathName)
 	if err != nil {
@@ -24,6 +24,7 @@ import (
 
 type interruptsCollector struct {
 	desc   typedDesc
+	paths  Paths
 	logger log.Logger
 }
 
@@ -39,6 +40,7 @@ func NewInterruptsCollector(logger log.Logger) (Collector, error) {
 			"Interrupt details.",
 			interruptLabelNames, nil,
 		), prometheus.CounterValue},
+		paths:  currentPaths(),
 		logger: logger,
 	}, nil
 }
@@ -7,10 +7,12 @@
 package collector
 
 import (
-	"os/exec"
+	"context"
+	"errors"
+	"fmt"
+	_ "net/http/pprof"
 	"strconv"
 	"strings"
-	_ "net/http/pprof"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -18,72 +20,92 @@ import (
 )
 
 func init() {
-	registerCollector("iostat", defaultEnabled, NewGZDiskErrorsExporter)
+	registerCollector("iostat", defaultEnabledOnSolaris, NewGZDiskErrorsExporter)
 }
 
-// GZDiskErrorsCollector declares the data type within the prometheus metrics package.
+// GZDiskErrorsCollector exports the error counters of disks reported by
+// iostat -en.
 type GZDiskErrorsCollector struct {
-	gzDiskErrors *prometheus.GaugeVec
-	logger                  log.Logger
+	gzDiskErrors typedDesc
+	runner       *commandRunner
+	logger       log.Logger
 }
 
 // NewGZDiskErrorsExporter returns a newly allocated exporter GZDiskErrorsCollector.
 // It exposes the number of hardware disk errors
 func NewGZDiskErrorsExporter(logger log.Logger) (Collector, error) {
+	runner, err := newCommandRunner("iostat")
+	if err != nil {
+		return nil, err
+	}
 
 	return &GZDiskErrorsCollector{
-		gzDiskErrors: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: "node_iostat_disk_errs_total",
-			Help: "Number of hardware disk errors.",
-		}, []string{"device", "error_type"}),
+		gzDiskErrors: typedDesc{prometheus.NewDesc(
+			"node_iostat_disk_errs_total",
+			"Number of hardware disk errors.",
+			[]string{"device", "error_type"}, nil,
+		), prometheus.CounterValue},
+		runner: runner,
 		logger: logger,
 	}, nil
 }
 
 // Describe describes all the metrics.
 func (e *GZDiskErrorsCollector) Describe(ch chan<- *prometheus.Desc) {
-	e.gzDiskErrors.Describe(ch)
+	ch <- e.gzDiskErrors.desc
 }
 
-// Collect fetches the stats.
+// Update fetches the stats.
 func (e *GZDiskErrorsCollector) Update(ch chan<- prometheus.Metric) error {
-	e.iostat()
-	e.gzDiskErrors.Collect(ch)
-	return nil;
+	return e.UpdateContext(context.Background(), ch)
+}
+
+// UpdateContext fetches the stats, killing iostat once ctx is done.
+func (e *GZDiskErrorsCollector) UpdateContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	err := e.iostat(ctx, ch)
+	e.runner.collect(ch)
+	return err
 }
 
-func (e *GZDiskErrorsCollector) iostat() {
-	out, eerr := exec.Command("iostat", "-en").Output()
-	if eerr != nil {
-		level.Error(e.logger).Log("error on executing iostat: %v", eerr)
+func (e *GZDiskErrorsCollector) iostat(ctx context.Context, ch chan<- prometheus.Metric) error {
+	out, err := e.runner.run(ctx, "iostat", "-en")
+	if err != nil {
+		return err
 	}
-	perr := e.parseIostatOutput(string(out))
-	if perr != nil {
-		level.Error(e.logger).Log("error on parsing iostat: %v", perr)
+	if err := e.parseIostatOutput(string(out), ch); err != nil {
+		return fmt.Errorf("couldn't parse iostat output: %w", err)
 	}
+	return nil
 }
 
-func (e *GZDiskErrorsCollector) parseIostatOutput(out string) error {
-	outlines := strings.Split(out, "\n")
-	l := len(outlines)
-	for _, line := range outlines[2 : l-1] {
+// iostatErrorTypes are the columns of iostat -en preceding the total and
+// the device name.
+var iostatErrorTypes = []string{"soft", "hard", "trn"}
+
+// parseIostatOutput parses the output of iostat -en, two header lines
+// followed by the soft, hard, transport and total errors of each device.
+func (e *GZDiskErrorsCollector) parseIostatOutput(out string, ch chan<- prometheus.Metric) error {
+	outlines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if len(outlines) < 2 {
+		return errors.New("missing header")
+	}
+	for _, line := range outlines[2:] {
 		parsedLine := strings.Fields(line)
-		deviceName := parsedLine[4]
-		softErr, err := strconv.ParseFloat(parsedLine[0], 64)
-		if err != nil {
-			return err
+		if len(parsedLine) == 0 {
+			continue
 		}
-		hardErr, err := strconv.ParseFloat(parsedLine[1], 64)
-		if err != nil {
-			return err
+		if len(parsedLine) < 5 {
+			level.Debug(e.logger).Log("msg", "skipping malformed iostat line", "line", line)
+			continue
 		}
-		trnErr, err := strconv.ParseFloat(parsedLine[2], 64)
-		if err != nil {
-			return err
+		deviceName := parsedLine[4]
+		for i, errorType := range iostatErrorTypes {
+			v, err := strconv.ParseFloat(parsedLine[i], 64)
+			if err != nil {
+				return err
+			}
+			ch <- e.gzDiskErrors.mustNewConstMetric(v, deviceName, errorType)
 		}
-		e.gzDiskErrors.With(prometheus.Labels{"device": deviceName, "error_type": "soft"}).Set(softErr)
-		e.gzDiskErrors.With(prometheus.Labels{"device": deviceName, "error_type": "hard"}).Set(hardErr)
-		e.gzDiskErrors.With(prometheus.Labels{"device": deviceName, "error_type": "trn"}).Set(trnErr)
 	}
 	return nil
 }
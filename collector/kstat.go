@@ -0,0 +1,263 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type kstatStat struct {
+	pattern     kstatPattern
+	help        string
+	suffix      string
+	scaleFactor float64
+	valueType   string
+}
+
+type kstatName struct {
+	pattern     kstatPattern
+	labelString string
+	stats       []kstatStat
+}
+
+type kstatModule struct {
+	pattern kstatPattern
+	names   []kstatName
+}
+
+type kstatCollector struct {
+	modules    []kstatModule
+	open       kstatOpener
+	descsMutex sync.Mutex
+	descs      map[string]*prometheus.Desc
+	logger     log.Logger
+}
+
+// newKstatCollector returns a collector exporting the kstats of cfg, read
+// with open.
+func newKstatCollector(cfg kstatConfig, open kstatOpener, logger log.Logger) (*kstatCollector, error) {
+	var err error
+	c := kstatCollector{
+		open:   open,
+		descs:  map[string]*prometheus.Desc{},
+		logger: logger,
+	}
+	for _, cfgModule := range cfg.KstatModules {
+		module := kstatModule{}
+		if module.pattern, err = newKstatPattern(cfgModule.ID); err != nil {
+			return nil, err
+		}
+		for _, cfgName := range cfgModule.KstatNames {
+			name := kstatName{labelString: cfgName.LabelString}
+			if name.pattern, err = newKstatPattern(cfgName.ID); err != nil {
+				return nil, err
+			}
+			for _, cfgStat := range cfgName.KstatStats {
+				stat := kstatStat{
+					help:        cfgStat.Help,
+					suffix:      cfgStat.Suffix,
+					scaleFactor: cfgStat.ScaleFactor,
+					valueType:   cfgStat.Type,
+				}
+				if stat.pattern, err = newKstatPattern(cfgStat.ID); err != nil {
+					return nil, err
+				}
+				name.stats = append(name.stats, stat)
+			}
+			module.names = append(module.names, name)
+		}
+		c.modules = append(c.modules, module)
+	}
+
+	return &c, nil
+}
+
+// desc returns the cached description of a metric of the kstats matched by
+// module and name, with the labels of kstatLabelNames followed by
+// extraLabels.
+func (c *kstatCollector) desc(module kstatModule, name kstatName, fqName, help, instanceLabel string, extraLabels ...string) *prometheus.Desc {
+	c.descsMutex.Lock()
+	defer c.descsMutex.Unlock()
+
+	key := strings.Join(append([]string{fqName}, extraLabels...), ",")
+	if desc, ok := c.descs[key]; ok {
+		return desc
+	}
+	labels := append(kstatLabelNames(instanceLabel, module.pattern, name.pattern), extraLabels...)
+	desc := prometheus.NewDesc(fqName, help, labels, nil)
+	c.descs[key] = desc
+	return desc
+}
+
+// kstatLabelValues returns the values of the labels of kstatLabelNames.
+func kstatLabelValues(id kstatID, module kstatModule, name kstatName) []string {
+	values := []string{strconv.Itoa(id.instance)}
+	if !module.pattern.literal() {
+		values = append(values, id.module)
+	}
+	if !name.pattern.literal() {
+		values = append(values, id.name)
+	}
+	return values
+}
+
+// stat returns the first statistic of name matching id.
+func (name kstatName) stat(id string) (kstatStat, bool) {
+	for _, stat := range name.stats {
+		if stat.pattern.match(id) {
+			return stat, true
+		}
+	}
+	return kstatStat{}, false
+}
+
+// metric returns the metric of a statistic of the kstat id with the given value,
+// typed as configured or else as given by valueType.
+func (c *kstatCollector) metric(id kstatID, module kstatModule, name kstatName, stat kstatStat, statID string, valueType prometheus.ValueType, value float64) prometheus.Metric {
+	switch stat.valueType {
+	case "counter":
+		valueType = prometheus.CounterValue
+	case "gauge":
+		valueType = prometheus.GaugeValue
+	}
+	suffix := stat.suffix
+	if suffix == "" && valueType == prometheus.CounterValue {
+		suffix = "total"
+	}
+	help := stat.help
+	if help == "" {
+		help = module.pattern.id + "::" + name.pattern.id + ":" + statID
+	}
+	desc := c.desc(module, name, kstatMetricName(module.pattern, name.pattern, statID, suffix), help, name.labelString)
+	return prometheus.MustNewConstMetric(desc, valueType, value*stat.scaleFactor, kstatLabelValues(id, module, name)...)
+}
+
+// infoMetric returns a metric with value 1 carrying the string statistics
+// of the kstat id as labels, nil if there are none.
+func (c *kstatCollector) infoMetric(id kstatID, module kstatModule, name kstatName, strs map[string]string) prometheus.Metric {
+	if len(strs) == 0 {
+		return nil
+	}
+	reserved := map[string]bool{}
+	for _, l := range kstatLabelNames(name.labelString, module.pattern, name.pattern) {
+		reserved[l] = true
+	}
+	values := map[string]string{}
+	for stat, value := range strs {
+		label := kstatLabelName(stat)
+		if reserved[label] {
+			level.Debug(c.logger).Log("msg", "kstat string statistic clashes with a label", "kstat", id, "stat", stat)
+			continue
+		}
+		values[label] = value
+	}
+	labels := make([]string, 0, len(values))
+	for label := range values {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	labelValues := kstatLabelValues(id, module, name)
+	for _, label := range labels {
+		labelValues = append(labelValues, values[label])
+	}
+
+	fqName := kstatMetricName(module.pattern, name.pattern, "info", "")
+	desc := c.desc(module, name, fqName, "String statistics of "+module.pattern.id+"::"+name.pattern.id+".", name.labelString, labels...)
+	return prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, labelValues...)
+}
+
+func (c *kstatCollector) Update(ch chan<- prometheus.Metric) error {
+	r, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	defer r.close()
+
+	// Walk the kstat chain, so that every instance of a kstat is found. A
+	// kstat failing to be read doesn't keep the others from being exported.
+	var errs []error
+	for _, id := range r.list() {
+		for _, module := range c.modules {
+			if !module.pattern.match(id.module) {
+				continue
+			}
+			for _, name := range module.names {
+				if !name.pattern.match(id.name) {
+					continue
+				}
+				if err := c.updateKstat(ch, r, id, module, name); err != nil {
+					errs = append(errs, fmt.Errorf("failed to read kstat %s: %w", id, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// updateKstat exports the statistics of the kstat id configured by name.
+func (c *kstatCollector) updateKstat(ch chan<- prometheus.Metric, r kstatReader, id kstatID, module kstatModule, name kstatName) error {
+	stats, err := r.read(id)
+	if err == errKstatUnsupported {
+		level.Debug(c.logger).Log("msg", "unsupported kstat type", "kstat", id)
+		return nil
+	}
+	if err == errKstatNotFound {
+		// The kstat was removed since the chain was walked.
+		level.Debug(c.logger).Log("msg", "kstat disappeared", "kstat", id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	found := map[string]bool{}
+	for _, v := range stats.values {
+		if stat, ok := name.stat(v.id); ok {
+			ch <- c.metric(id, module, name, stat, v.id, v.valueType, v.value)
+			found[v.id] = true
+		}
+	}
+	strs := map[string]string{}
+	for stat, value := range stats.strs {
+		if _, ok := name.stat(stat); ok {
+			strs[stat] = value
+			found[stat] = true
+		}
+	}
+	if m := c.infoMetric(id, module, name, strs); m != nil {
+		ch <- m
+	}
+	for _, stat := range name.stats {
+		if stat.pattern.literal() && !found[stat.pattern.id] {
+			level.Debug(c.logger).Log("msg", "kstat statistic not found", "kstat", id, "stat", stat.pattern.id)
+		}
+	}
+
+	//Snaptime is separate kind because of
+	//different way to retrieve this metric
+	fqName := kstatMetricName(module.pattern, name.pattern, "snaptime", "")
+	desc := c.desc(module, name, fqName, module.pattern.id+"::"+name.pattern.id+":snaptime", "inst")
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(stats.snaptime), kstatLabelValues(id, module, name)...)
+	return nil
+}
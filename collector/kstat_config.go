@@ -1,50 +1,159 @@
 package collector
 
 import (
-	"io/ioutil"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
 	"gopkg.in/yaml.v2"
 )
 
 type kstatConfig struct {
-	KstatModules [] KstatModule `yaml:"kstat_modules"`
+	KstatModules []KstatModule `yaml:"kstat_modules"`
 }
 
 type KstatModule struct {
-	ID string 		`yaml: "id"`
+	ID         string      `yaml:"id"`
 	KstatNames []KstatName `yaml:"kstat_names"`
 }
 
 type KstatName struct {
-	ID string 		`yaml:"id"`
-	LabelString string 	`yaml:"label_string"`
-	KstatStats []KstatStat `yaml:"kstat_stats"`
+	ID          string      `yaml:"id"`
+	LabelString string      `yaml:"label_string"`
+	KstatStats  []KstatStat `yaml:"kstat_stats"`
 }
 
 type KstatStat struct {
-	ID string 		`yaml:"id"`
-	Help string 		`yaml:"help"`
-	Suffix      string 	`yaml:"suffix"`
-	ScaleFactor float64  	`yaml:"scale_factor"`
+	ID          string  `yaml:"id"`
+	Help        string  `yaml:"help"`
+	Suffix      string  `yaml:"suffix"`
+	ScaleFactor float64 `yaml:"scale_factor"`
+	// Type is counter or gauge, by default counter only for the named
+	// statistics known to count and for I/O kstats.
+	Type string `yaml:"type"`
 }
 
-func (cfg *kstatConfig) init() error {
-	var (
-		cfgFile kstatConfig
-	)
+// kstatPattern matches kstat module, name or statistic IDs. An ID enclosed
+// in slashes is a regular expression, an ID containing any of *?[ a glob
+// and any other ID is matched literally.
+type kstatPattern struct {
+	id   string
+	re   *regexp.Regexp
+	glob bool
+}
+
+func newKstatPattern(id string) (kstatPattern, error) {
+	p := kstatPattern{id: id}
+	switch {
+	case len(id) > 1 && strings.HasPrefix(id, "/") && strings.HasSuffix(id, "/"):
+		re, err := regexp.Compile("^(?:" + id[1:len(id)-1] + ")$")
+		if err != nil {
+			return p, fmt.Errorf("invalid kstat regexp %q: %w", id, err)
+		}
+		p.re = re
+	case strings.ContainsAny(id, "*?["):
+		if _, err := path.Match(id, ""); err != nil {
+			return p, fmt.Errorf("invalid kstat glob %q: %w", id, err)
+		}
+		p.glob = true
+	}
+	return p, nil
+}
+
+// literal reports whether the pattern matches only its ID.
+func (p kstatPattern) literal() bool {
+	return p.re == nil && !p.glob
+}
+
+func (p kstatPattern) match(s string) bool {
+	switch {
+	case p.re != nil:
+		return p.re.MatchString(s)
+	case p.glob:
+		ok, _ := path.Match(p.id, s)
+		return ok
+	}
+	return p.id == s
+}
+
+var kstatInvalidMetricChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// kstatMetricName returns the name of the metric exporting a statistic of
+// the kstats matched by module and name. Only literal module and name IDs
+// are part of it, the others are exported by the labels of kstatLabelNames.
+func kstatMetricName(module, name kstatPattern, stat, suffix string) string {
+	parts := []string{namespace, "kstat"}
+	for _, p := range []kstatPattern{module, name} {
+		if p.literal() {
+			parts = append(parts, p.id)
+		}
+	}
+	parts = append(parts, stat)
+	if suffix != "" {
+		parts = append(parts, suffix)
+	}
+	return kstatInvalidMetricChars.ReplaceAllString(strings.Join(parts, "_"), "_")
+}
 
-	yamlFile, err := ioutil.ReadFile(kstatCfgFilePath())
+// kstatLabelName returns the label exporting the string statistic id.
+func kstatLabelName(id string) string {
+	label := kstatInvalidMetricChars.ReplaceAllString(id, "_")
+	if label == "" || (label[0] >= '0' && label[0] <= '9') {
+		label = "_" + label
+	}
+	return label
+}
 
+// kstatLabelNames returns the labels of the metrics of the kstats matched
+// by module and name: the instance label, then module and name unless their
+// ID is literal.
+func kstatLabelNames(instanceLabel string, module, name kstatPattern) []string {
+	labels := []string{instanceLabel}
+	if !module.literal() {
+		labels = append(labels, "module")
+	}
+	if !name.literal() {
+		labels = append(labels, "name")
+	}
+	return labels
+}
+
+// loadKstatConfig returns the kstat section of the configuration file. An
+// explicitly given --path.kstatcfg, or a configuration file without kstat
+// section, falls back to reading the separate kstat config file.
+func loadKstatConfig() (kstatConfig, error) {
+	var cfgFile kstatConfig
+
+	if section := currentConfig().Kstat; section != nil && !isExplicitFlag("path.kstatcfg") {
+		return *section, nil
+	}
 
-	if err != nil { return err }
+	yamlFile, err := os.ReadFile(kstatCfgFilePath())
+	if err != nil {
+		return cfgFile, err
+	}
 
 	err = yaml.Unmarshal(yamlFile, &cfgFile)
-	if err != nil { return err }
+	return cfgFile, err
+}
 
+func (cfg *kstatConfig) init() error {
+	cfgFile, err := loadKstatConfig()
+	if err != nil {
+		return err
+	}
+	return cfg.setDefaults(cfgFile)
+}
+
+// setDefaults sets cfg to cfgFile with defaults filled in.
+func (cfg *kstatConfig) setDefaults(cfgFile kstatConfig) error {
 	for _, cfgModule := range cfgFile.KstatModules {
-		m := KstatModule {}
+		m := KstatModule{}
 		m.ID = cfgModule.ID
 		for _, cfgName := range cfgModule.KstatNames {
-			n := KstatName {}
+			n := KstatName{}
 			n.ID = cfgName.ID
 			if len(cfgName.LabelString) == 0 {
 				n.LabelString = "instance"
@@ -56,20 +165,21 @@ func (cfg *kstatConfig) init() error {
 
 				s.ID = cfgStat.ID
 
-				if len(cfgStat.Help) == 0 {
-					s.Help = cfgModule.ID + "::" + cfgName.ID + ":" + cfgStat.ID
-				} else {
-					s.Help = cfgStat.Help
-				}
+				// Without help, the collector describes the statistic
+				// by its ID, which may be matched by a pattern.
+				s.Help = cfgStat.Help
 				if cfgStat.ScaleFactor == 0 {
 					s.ScaleFactor = 1
 				} else {
 					s.ScaleFactor = cfgStat.ScaleFactor
 				}
-				if len(cfgStat.Suffix) == 0 {
-					s.Suffix = "total"
-				} else {
-					s.Suffix = cfgStat.Suffix
+				// Without suffix, counters end in total.
+				s.Suffix = cfgStat.Suffix
+				switch cfgStat.Type {
+				case "", "counter", "gauge":
+					s.Type = cfgStat.Type
+				default:
+					return fmt.Errorf("invalid type %q of kstat %s::%s:%s, must be counter or gauge", cfgStat.Type, cfgModule.ID, cfgName.ID, cfgStat.ID)
 				}
 				n.KstatStats = append(n.KstatStats, s)
 			}
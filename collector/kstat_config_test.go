@@ -0,0 +1,110 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mustKstatPattern(t *testing.T, id string) kstatPattern {
+	t.Helper()
+	p, err := newKstatPattern(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestKstatPattern(t *testing.T) {
+	for _, test := range []struct {
+		id      string
+		literal bool
+		match   []string
+		noMatch []string
+	}{
+		{id: "sd", literal: true, match: []string{"sd"}, noMatch: []string{"sderr", "s?"}},
+		{id: "sd*,err", match: []string{"sd0,err", "sd12,err"}, noMatch: []string{"sd0", "cmdk0,err"}},
+		{id: "cpu_info[0-9]", match: []string{"cpu_info3"}, noMatch: []string{"cpu_info12"}},
+		{id: "*", match: []string{"Hard Errors", "snaptime"}},
+		{id: "/sd[0-9]+,err/", match: []string{"sd12,err"}, noMatch: []string{"sd,err", "xsd1,err"}},
+	} {
+		p := mustKstatPattern(t, test.id)
+		if p.literal() != test.literal {
+			t.Errorf("%s: want literal %t", test.id, test.literal)
+		}
+		for _, s := range test.match {
+			if !p.match(s) {
+				t.Errorf("%s: expected %q to match", test.id, s)
+			}
+		}
+		for _, s := range test.noMatch {
+			if p.match(s) {
+				t.Errorf("%s: expected %q not to match", test.id, s)
+			}
+		}
+	}
+
+	for _, id := range []string{"/sd(/", "sd[0-"} {
+		if _, err := newKstatPattern(id); err == nil {
+			t.Errorf("%s: expected invalid pattern", id)
+		}
+	}
+}
+
+func TestKstatMetricName(t *testing.T) {
+	for _, test := range []struct {
+		module, name, stat, suffix string
+		want                       string
+		labels                     []string
+	}{
+		{
+			module: "unix", name: "system_pages", stat: "freemem", suffix: "total",
+			want: "node_kstat_unix_system_pages_freemem_total", labels: []string{"instance"},
+		},
+		{
+			module: "cpu_info", name: "cpu_info*", stat: "clock_MHz",
+			want: "node_kstat_cpu_info_clock_MHz", labels: []string{"instance", "name"},
+		},
+		{
+			module: "sderr", name: "sd*,err", stat: "Hard Errors", suffix: "total",
+			want: "node_kstat_sderr_Hard_Errors_total", labels: []string{"instance", "name"},
+		},
+		{
+			module: "/sd|cmdk/", name: "/.*/", stat: "level-1-count", suffix: "total",
+			want: "node_kstat_level_1_count_total", labels: []string{"instance", "module", "name"},
+		},
+	} {
+		module, name := mustKstatPattern(t, test.module), mustKstatPattern(t, test.name)
+		if got := kstatMetricName(module, name, test.stat, test.suffix); got != test.want {
+			t.Errorf("want metric name %q, got %q", test.want, got)
+		}
+		if got := kstatLabelNames("instance", module, name); !reflect.DeepEqual(got, test.labels) {
+			t.Errorf("%s: want labels %v, got %v", test.want, test.labels, got)
+		}
+	}
+}
+
+func TestKstatLabelName(t *testing.T) {
+	for id, want := range map[string]string{
+		"Vendor":        "Vendor",
+		"Serial No":     "Serial_No",
+		"1st-device":    "_1st_device",
+		"chip_id,clock": "chip_id_clock",
+	} {
+		if got := kstatLabelName(id); got != want {
+			t.Errorf("%q: want label %q, got %q", id, want, got)
+		}
+	}
+}
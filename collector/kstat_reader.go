@@ -0,0 +1,134 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	errKstatNotFound    = errors.New("kstat not found")
+	errKstatUnsupported = errors.New("unsupported kstat type")
+)
+
+// kstatID identifies a kstat by module, instance and name.
+type kstatID struct {
+	module   string
+	instance int
+	name     string
+}
+
+func (id kstatID) String() string {
+	return fmt.Sprintf("%s:%d:%s", id.module, id.instance, id.name)
+}
+
+// kstatValue is a numeric statistic of a kstat.
+type kstatValue struct {
+	id        string
+	valueType prometheus.ValueType
+	value     float64
+}
+
+// kstatStats holds the statistics of a kstat.
+type kstatStats struct {
+	values []kstatValue
+	strs   map[string]string
+	// snaptime is the time the statistics were read at, in nanoseconds
+	// since an arbitrary time.
+	snaptime int64
+}
+
+// value returns the numeric statistic id.
+func (s *kstatStats) value(id string) (float64, error) {
+	for _, v := range s.values {
+		if v.id == id {
+			return v.value, nil
+		}
+	}
+	return 0, fmt.Errorf("kstat statistic %q not found", id)
+}
+
+// kstatCounterStats lists the named statistics known to be counters, as
+// globs by module, "*" matching any module. Their data type doesn't tell,
+// as most unsigned statistics such as the sizes of zfs::arcstats are gauges.
+var kstatCounterStats = map[string][]string{
+	"*": {
+		"*Errors",
+		"ipackets*", "opackets*", "rbytes*", "obytes*",
+		"ierrors", "oerrors", "collisions",
+		"brdcstrcv", "brdcstxmt", "multircv", "multixmt",
+		"norcvbuf", "noxmtbuf",
+	},
+	// cpu::sys, cpu::vm and cpu::intrstat count, but for kstatGaugeStats.
+	"cpu": {"*"},
+	"zfs": {
+		"*hits", "*misses", "demand_hit_*", "deleted", "evict_*",
+		"access_skip", "async_upgrade_sync",
+		"hash_collisions", "mutex_miss", "memory_throttle_count",
+		"l2_abort_lowmem", "l2_cksum_bad", "l2_evict_*", "l2_feeds",
+		"l2_free_on_write", "l2_io_error", "l2_log_blk_writes",
+		"l2_read_bytes", "l2_rebuild_*", "l2_rw_clash", "l2_write_bytes",
+		"l2_writes_*",
+	},
+}
+
+// kstatGaugeStats lists the gauges among the globs of kstatCounterStats.
+var kstatGaugeStats = map[string][]string{
+	"cpu": {"cpu_load_intr"},
+}
+
+// kstatNamedValueType returns the type of the named statistic stat of a
+// kstat of module: a counter if listed in kstatCounterStats and not in
+// kstatGaugeStats, else a gauge.
+func kstatNamedValueType(module, stat string) prometheus.ValueType {
+	for _, glob := range kstatGaugeStats[module] {
+		if ok, _ := path.Match(glob, stat); ok {
+			return prometheus.GaugeValue
+		}
+	}
+	for _, m := range []string{module, "*"} {
+		for _, glob := range kstatCounterStats[m] {
+			if ok, _ := path.Match(glob, stat); ok {
+				return prometheus.CounterValue
+			}
+		}
+	}
+	return prometheus.GaugeValue
+}
+
+// kstatReader reads kstats, from the kernel on illumos, or from fixtures.
+type kstatReader interface {
+	// list returns all kstats in the order of the kstat chain.
+	list() []kstatID
+	// read returns the statistics of a kstat, errKstatNotFound if it
+	// doesn't exist and errKstatUnsupported if its type isn't supported.
+	read(id kstatID) (*kstatStats, error)
+	close() error
+}
+
+// kstatOpener opens a kstatReader, which is closed after each collection.
+type kstatOpener func() (kstatReader, error)
+
+// readKstatValue returns the numeric statistic stat of a kstat.
+func readKstatValue(r kstatReader, id kstatID, stat string) (float64, error) {
+	stats, err := r.read(id)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't read kstat %s: %w", id, err)
+	}
+	return stats.value(stat)
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"github.com/illumos/go-kstat"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// kstatTokenReader reads kstats from the kernel.
+type kstatTokenReader struct {
+	tok *kstat.Token
+	// kstats are the kstats of the chain by ID.
+	kstats map[kstatID]*kstat.KStat
+}
+
+// openKstatReader opens the kstats of the kernel.
+func openKstatReader() (kstatReader, error) {
+	tok, err := kstat.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &kstatTokenReader{tok: tok}, nil
+}
+
+func (r *kstatTokenReader) list() []kstatID {
+	all := r.tok.All()
+	ids := make([]kstatID, 0, len(all))
+	r.kstats = make(map[kstatID]*kstat.KStat, len(all))
+	for _, ks := range all {
+		id := kstatID{module: ks.Module, instance: ks.Instance, name: ks.Name}
+		ids = append(ids, id)
+		r.kstats[id] = ks
+	}
+	return ids
+}
+
+func (r *kstatTokenReader) read(id kstatID) (*kstatStats, error) {
+	ks, ok := r.kstats[id]
+	if !ok {
+		var err error
+		if ks, err = r.tok.Lookup(id.module, id.instance, id.name); err != nil {
+			return nil, errKstatNotFound
+		}
+	}
+
+	switch {
+	case ks.Type == kstat.NamedStat:
+		named, err := ks.AllNamed()
+		if err != nil {
+			return nil, err
+		}
+		stats := &kstatStats{strs: map[string]string{}, snaptime: ks.Snaptime}
+		for _, n := range named {
+			switch n.Type {
+			case kstat.CharData, kstat.String:
+				stats.strs[n.Name] = n.StringVal
+			case kstat.Int32, kstat.Int64:
+				stats.values = append(stats.values, kstatValue{n.Name, kstatNamedValueType(id.module, n.Name), float64(n.IntVal)})
+			default:
+				stats.values = append(stats.values, kstatValue{n.Name, kstatNamedValueType(id.module, n.Name), float64(n.UintVal)})
+			}
+		}
+		return stats, nil
+
+	case ks.Type == kstat.IoStat:
+		io, err := ks.GetIO()
+		if err != nil {
+			return nil, err
+		}
+		return &kstatStats{values: kstatIOValues(io), snaptime: ks.Snaptime}, nil
+
+	// The raw kstats have a layout of their own.
+	case id.module == "unix" && id.name == "vminfo":
+		rawKs, vminfo, err := r.tok.Vminfo()
+		if err != nil {
+			return nil, err
+		}
+		return &kstatStats{values: kstatVminfoValues(vminfo), snaptime: rawKs.Snaptime}, nil
+
+	case id.module == "unix" && id.name == "sysinfo":
+		rawKs, sysinfo, err := r.tok.Sysinfo()
+		if err != nil {
+			return nil, err
+		}
+		return &kstatStats{values: kstatSysinfoValues(sysinfo), snaptime: rawKs.Snaptime}, nil
+
+	case id.module == "unix" && id.name == "var":
+		rawKs, v, err := r.tok.Var()
+		if err != nil {
+			return nil, err
+		}
+		return &kstatStats{values: kstatVarValues(v), snaptime: rawKs.Snaptime}, nil
+	}
+	return nil, errKstatUnsupported
+}
+
+func (r *kstatTokenReader) close() error {
+	return r.tok.Close()
+}
+
+// kstatIOValues returns the statistics of an I/O kstat, named like kstat(1)
+// does. The times are in nanoseconds.
+func kstatIOValues(io *kstat.IO) []kstatValue {
+	return []kstatValue{
+		{"nread", prometheus.CounterValue, float64(io.Nread)},
+		{"nwritten", prometheus.CounterValue, float64(io.Nwritten)},
+		{"reads", prometheus.CounterValue, float64(io.Reads)},
+		{"writes", prometheus.CounterValue, float64(io.Writes)},
+		{"wtime", prometheus.CounterValue, float64(io.Wtime)},
+		{"wlentime", prometheus.CounterValue, float64(io.Wlentime)},
+		{"rtime", prometheus.CounterValue, float64(io.Rtime)},
+		{"rlentime", prometheus.CounterValue, float64(io.Rlentime)},
+		{"wcnt", prometheus.GaugeValue, float64(io.Wcnt)},
+		{"rcnt", prometheus.GaugeValue, float64(io.Rcnt)},
+	}
+}
+
+// kstatVminfoValues returns the statistics of unix:0:vminfo, which are
+// summed up at every update. Even freemem is thus a counter, whose rate
+// divided by the one of updates is the free memory.
+func kstatVminfoValues(vminfo *kstat.Vminfo) []kstatValue {
+	return []kstatValue{
+		{"freemem", prometheus.CounterValue, float64(vminfo.Freemem)},
+		{"swap_resv", prometheus.CounterValue, float64(vminfo.Resv)},
+		{"swap_alloc", prometheus.CounterValue, float64(vminfo.Alloc)},
+		{"swap_avail", prometheus.CounterValue, float64(vminfo.Avail)},
+		{"swap_free", prometheus.CounterValue, float64(vminfo.Free)},
+		{"updates", prometheus.CounterValue, float64(vminfo.Updates)},
+	}
+}
+
+// kstatSysinfoValues returns the statistics of unix:0:sysinfo, which are
+// summed up at every update.
+func kstatSysinfoValues(sysinfo *kstat.Sysinfo) []kstatValue {
+	return []kstatValue{
+		{"updates", prometheus.CounterValue, float64(sysinfo.Updates)},
+		{"runque", prometheus.CounterValue, float64(sysinfo.Runque)},
+		{"runocc", prometheus.CounterValue, float64(sysinfo.Runocc)},
+		{"swpque", prometheus.CounterValue, float64(sysinfo.Swpque)},
+		{"swpocc", prometheus.CounterValue, float64(sysinfo.Swpocc)},
+		{"waiting", prometheus.CounterValue, float64(sysinfo.Waiting)},
+	}
+}
+
+// kstatVarValues returns the tunables of unix:0:var.
+func kstatVarValues(v *kstat.Var) []kstatValue {
+	return []kstatValue{
+		{"v_buf", prometheus.GaugeValue, float64(v.Buf)},
+		{"v_call", prometheus.GaugeValue, float64(v.Call)},
+		{"v_proc", prometheus.GaugeValue, float64(v.Proc)},
+		{"v_maxupttl", prometheus.GaugeValue, float64(v.Maxupttl)},
+		{"v_nglobpris", prometheus.GaugeValue, float64(v.Nglobpris)},
+		{"v_maxsyspri", prometheus.GaugeValue, float64(v.Maxsyspri)},
+		{"v_clist", prometheus.GaugeValue, float64(v.Clist)},
+		{"v_maxup", prometheus.GaugeValue, float64(v.Maxup)},
+		{"v_hbuf", prometheus.GaugeValue, float64(v.Hbuf)},
+		{"v_hmask", prometheus.GaugeValue, float64(v.Hmask)},
+		{"v_pbuf", prometheus.GaugeValue, float64(v.Pbuf)},
+		{"v_sptmap", prometheus.GaugeValue, float64(v.Sptmap)},
+		{"v_maxpmem", prometheus.GaugeValue, float64(v.Maxpmem)},
+		{"v_autoup", prometheus.GaugeValue, float64(v.Autoup)},
+		{"v_bufhwm", prometheus.GaugeValue, float64(v.Bufhwm)},
+	}
+}
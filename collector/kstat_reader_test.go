@@ -0,0 +1,201 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// kstatFixtureReader reads kstats from `kstat -p` output. Integers are
+// typed like named statistics, except those of I/O kstats and of the raw
+// kstats unix::vminfo and unix::sysinfo, which are counters, and other
+// values are strings.
+type kstatFixtureReader struct {
+	ids   []kstatID
+	stats map[kstatID]*kstatStats
+}
+
+// kstatFixtureOpener returns an opener reading the `kstat -p` output in
+// the file path.
+func kstatFixtureOpener(path string) kstatOpener {
+	return func() (kstatReader, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r := &kstatFixtureReader{stats: map[kstatID]*kstatStats{}}
+		raw := map[kstatID]map[string]string{}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), "\t")
+			parts := strings.SplitN(key, ":", 4)
+			if !ok || len(parts) != 4 {
+				return nil, fmt.Errorf("invalid kstat line %q", scanner.Text())
+			}
+			instance, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid kstat instance %q: %w", parts[1], err)
+			}
+			id := kstatID{module: parts[0], instance: instance, name: parts[2]}
+			if _, ok := raw[id]; !ok {
+				r.ids = append(r.ids, id)
+				raw[id] = map[string]string{}
+			}
+			raw[id][parts[3]] = value
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		for _, id := range r.ids {
+			r.stats[id] = kstatFixtureStats(id, raw[id])
+		}
+		return r, nil
+	}
+}
+
+// kstatFixtureStats returns the statistics of the kstat id printed by
+// kstat(1), which prints high-resolution times in seconds.
+func kstatFixtureStats(id kstatID, raw map[string]string) *kstatStats {
+	stats := &kstatStats{strs: map[string]string{}}
+	_, io := raw["rlentime"]
+	for stat, value := range raw {
+		switch stat {
+		case "class", "crtime":
+			continue
+		case "snaptime":
+			seconds, _ := strconv.ParseFloat(value, 64)
+			stats.snaptime = int64(math.Round(seconds * 1e9))
+			continue
+		}
+		if io {
+			switch stat {
+			case "wlastupdate", "rlastupdate":
+			case "wtime", "wlentime", "rtime", "rlentime":
+				seconds, _ := strconv.ParseFloat(value, 64)
+				stats.values = append(stats.values, kstatValue{stat, prometheus.CounterValue, math.Round(seconds * 1e9)})
+			case "wcnt", "rcnt":
+				v, _ := strconv.ParseFloat(value, 64)
+				stats.values = append(stats.values, kstatValue{stat, prometheus.GaugeValue, v})
+			default:
+				v, _ := strconv.ParseFloat(value, 64)
+				stats.values = append(stats.values, kstatValue{stat, prometheus.CounterValue, v})
+			}
+			continue
+		}
+		valueType := kstatNamedValueType(id.module, stat)
+		if id.module == "unix" && (id.name == "vminfo" || id.name == "sysinfo") {
+			valueType = prometheus.CounterValue
+		}
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			stats.values = append(stats.values, kstatValue{stat, valueType, float64(v)})
+		} else if u, err := strconv.ParseUint(value, 10, 64); err == nil {
+			stats.values = append(stats.values, kstatValue{stat, valueType, float64(u)})
+		} else {
+			stats.strs[stat] = value
+		}
+	}
+	return stats
+}
+
+func (r *kstatFixtureReader) list() []kstatID {
+	return r.ids
+}
+
+func (r *kstatFixtureReader) read(id kstatID) (*kstatStats, error) {
+	stats, ok := r.stats[id]
+	if !ok {
+		return nil, errKstatNotFound
+	}
+	return stats, nil
+}
+
+func (r *kstatFixtureReader) close() error {
+	return nil
+}
+
+func TestKstatFixtureReader(t *testing.T) {
+	r, err := kstatFixtureOpener("fixtures/kstat/kstat.txt")()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+
+	want := []kstatID{
+		{"cpu_info", 0, "cpu_info0"},
+		{"cpu_info", 2, "cpu_info2"},
+		{"sd", 0, "sd0"},
+		{"sderr", 0, "sd0,err"},
+		{"unix", 0, "system_misc"},
+		{"unix", 0, "vminfo"},
+		{"zfs", 0, "arcstats"},
+		{"zfs", 0, "zfetchstats"},
+	}
+	if got := r.list(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want kstats %v, got %v", want, got)
+	}
+
+	stats, err := r.read(kstatID{"sd", 0, "sd0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := stats.value("rtime"); err != nil || v != 38215566903 {
+		t.Errorf("want rtime 38215566903ns, got %v (%v)", v, err)
+	}
+	if stats.snaptime != 8464316836012 {
+		t.Errorf("want snaptime 8464316836012ns, got %d", stats.snaptime)
+	}
+
+	stats, err = r.read(kstatID{"sderr", 0, "sd0,err"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.strs["Serial No"] != "VB1234abcd-5678ef" {
+		t.Errorf("want serial number string, got %v", stats.strs)
+	}
+
+	if _, err := r.read(kstatID{"sd", 1, "sd1"}); err != errKstatNotFound {
+		t.Errorf("want errKstatNotFound, got %v", err)
+	}
+}
+
+func TestKstatNamedValueType(t *testing.T) {
+	for _, tc := range []struct {
+		module, stat string
+		want         prometheus.ValueType
+	}{
+		{"zfs", "size", prometheus.GaugeValue},
+		{"zfs", "c_max", prometheus.GaugeValue},
+		{"zfs", "demand_data_hits", prometheus.CounterValue},
+		{"unix", "freemem", prometheus.GaugeValue},
+		{"cpu", "syscall", prometheus.CounterValue},
+		{"cpu", "cpu_load_intr", prometheus.GaugeValue},
+		{"link", "rbytes64", prometheus.CounterValue},
+		{"sderr", "Hard Errors", prometheus.CounterValue},
+	} {
+		if got := kstatNamedValueType(tc.module, tc.stat); got != tc.want {
+			t.Errorf("%s:%s: want type %v, got %v", tc.module, tc.stat, tc.want, got)
+		}
+	}
+}
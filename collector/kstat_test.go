@@ -0,0 +1,186 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noboottime && !noloadavg && !nocpu && !nozfs
+// +build !noboottime,!noloadavg,!nocpu,!nozfs
+
+package collector
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+const kstatFixture = "fixtures/kstat/kstat.txt"
+
+const kstatTestConfig = `
+kstat_modules:
+  - id: unix
+    kstat_names:
+      - id: system_misc
+        kstat_stats:
+          - id: avenrun_1min
+            help: Load average over 1 minute, scaled by 256.
+            type: gauge
+          - id: nproc
+            type: gauge
+      - id: vminfo
+        kstat_stats:
+          - id: freemem
+            scale_factor: 4096
+            suffix: bytes_total
+  - id: sderr
+    kstat_names:
+      - id: sd*,err
+        label_string: device
+        kstat_stats:
+          - id: "*Errors"
+          - id: Vendor
+          - id: Product
+  - id: sd
+    kstat_names:
+      - id: /sd[0-9]+/
+        label_string: device
+        kstat_stats:
+          - id: nread
+            suffix: bytes_total
+          - id: rtime
+            help: Run time of the I/O queue.
+            scale_factor: 1e-9
+            suffix: seconds_total
+          - id: wcnt
+  - id: cpu_info
+    kstat_names:
+      - id: cpu_info*
+        kstat_stats:
+          - id: "*"
+            type: gauge
+  - id: zfs
+    kstat_names:
+      - id: arcstats
+        kstat_stats:
+          - id: size
+            suffix: bytes
+          - id: hits
+`
+
+func testKstatCollectorOutput(t *testing.T, c Collector, golden string) {
+	t.Helper()
+	f, err := os.Open(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, f); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKstatCollector(t *testing.T) {
+	var cfgFile, cfg kstatConfig
+	if err := yaml.Unmarshal([]byte(kstatTestConfig), &cfgFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.setDefaults(cfgFile); err != nil {
+		t.Fatal(err)
+	}
+	c, err := newKstatCollector(cfg, kstatFixtureOpener(kstatFixture), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKstatCollectorOutput(t, c, "fixtures/kstat/kstat.out")
+}
+
+func TestBootTimeKstatCollector(t *testing.T) {
+	c := newBootTimeKstatCollector(kstatFixtureOpener(kstatFixture), log.NewNopLogger())
+	testKstatCollectorOutput(t, c, "fixtures/kstat/boot_time.out")
+}
+
+func TestCPUFreqKstatCollector(t *testing.T) {
+	c := newCPUFreqKstatCollector(kstatFixtureOpener(kstatFixture), log.NewNopLogger())
+	testKstatCollectorOutput(t, c, "fixtures/kstat/cpufreq.out")
+}
+
+func TestZfsKstatCollector(t *testing.T) {
+	c := newZfsKstatCollector(kstatFixtureOpener(kstatFixture), log.NewNopLogger())
+	testKstatCollectorOutput(t, c, "fixtures/kstat/zfs.out")
+}
+
+func TestKstatLoad(t *testing.T) {
+	load, err := kstatLoad(kstatFixtureOpener(kstatFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{0.29, 0.2, 0.14}; !reflect.DeepEqual(want, load) {
+		t.Errorf("want load %v, got %v", want, load)
+	}
+}
+
+// failingKstatReader fails to read the kstat fail.
+type failingKstatReader struct {
+	kstatReader
+	fail kstatID
+}
+
+func (r failingKstatReader) read(id kstatID) (*kstatStats, error) {
+	if id == r.fail {
+		return nil, errors.New("read failed")
+	}
+	return r.kstatReader.read(id)
+}
+
+func TestKstatCollectorReadError(t *testing.T) {
+	var cfgFile, cfg kstatConfig
+	if err := yaml.Unmarshal([]byte(kstatTestConfig), &cfgFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.setDefaults(cfgFile); err != nil {
+		t.Fatal(err)
+	}
+	open := func() (kstatReader, error) {
+		r, err := kstatFixtureOpener(kstatFixture)()
+		if err != nil {
+			return nil, err
+		}
+		return failingKstatReader{r, kstatID{"sd", 0, "sd0"}}, nil
+	}
+	c, err := newKstatCollector(cfg, open, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan prometheus.Metric)
+	done := make(chan int)
+	go func() {
+		n := 0
+		for range ch {
+			n++
+		}
+		done <- n
+	}()
+	err = c.Update(ch)
+	close(ch)
+	if want := "failed to read kstat sd:0:sd0: read failed"; err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+	if n := <-done; n == 0 {
+		t.Error("expected the metrics of the other kstats to be exported")
+	}
+}
@@ -26,6 +26,7 @@ import (
 )
 
 type lnstatCollector struct {
+	paths  Paths
 	logger log.Logger
 }
 
@@ -34,7 +35,7 @@ func init() {
 }
 
 func NewLnstatCollector(logger log.Logger) (Collector, error) {
-	return &lnstatCollector{logger}, nil
+	return &lnstatCollector{paths: currentPaths(), logger: logger}, nil
 }
 
 func (c *lnstatCollector) Update(ch chan<- prometheus.Metric) error {
@@ -42,7 +43,7 @@ func (c *lnstatCollector) Update(ch chan<- prometheus.Metric) error {
 		subsystem = "lnstat"
 	)
 
-	fs, err := procfs.NewFS(*procPath)
+	fs, err := procfs.NewFS(c.paths.ProcFS)
 	if err != nil {
 		return fmt.Errorf("failed to open procfs: %w", err)
 	}
@@ -0,0 +1,46 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noloadavg
+// +build !noloadavg
+
+package collector
+
+import (
+	"math"
+)
+
+// kstatFscale is FSCALE of sys/param.h on illumos, the fixed point scale
+// of the load averages.
+const kstatFscale = 1 << 8
+
+// kstatLoad returns the 1, 5 and 15 minute load averages, rounded to two
+// decimal places.
+func kstatLoad(open kstatOpener) ([]float64, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.close()
+
+	var loads []float64
+	for _, stat := range []string{"avenrun_1min", "avenrun_5min", "avenrun_15min"} {
+		v, err := readKstatValue(r, kstatID{"unix", 0, "system_misc"}, stat)
+		if err != nil {
+			return nil, err
+		}
+		loads = append(loads, math.Round(v/kstatFscale*100)/100)
+	}
+	return loads, nil
+}
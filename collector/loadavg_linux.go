@@ -24,8 +24,8 @@ import (
 )
 
 // Read loadavg from /proc.
-func getLoad() (loads []float64, err error) {
-	data, err := os.ReadFile(procFilePath("loadavg"))
+func (c *loadavgCollector) getLoad() (loads []float64, err error) {
+	data, err := os.ReadFile(c.paths.procFilePath("loadavg"))
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +41,7 @@ func parseLoad(data string) (loads []float64, err error) {
 	loads = make([]float64, 3)
 	parts := strings.Fields(data)
 	if len(parts) < 3 {
-		return nil, fmt.Errorf("unexpected content in %s", procFilePath("loadavg"))
+		return nil, fmt.Errorf("unexpected content in loadavg: %q", data)
 	}
 	for i, load := range parts[0:3] {
 		loads[i], err = strconv.ParseFloat(load, 64)
@@ -16,50 +16,6 @@
 
 package collector
 
-import (
-	"fmt"
-	"strconv"
-
-	"github.com/illumos/go-kstat"
-)
-
-// #include <sys/param.h>
-import "C"
-
-func kstatToFloat(ks *kstat.KStat, kstatKey string) float64 {
-	kstatValue, err := ks.GetNamed(kstatKey)
-
-	if err != nil {
-		panic(err)
-	}
-
-	kstatLoadavg, err := strconv.ParseFloat(
-		fmt.Sprintf("%.2f", float64(kstatValue.UintVal)/C.FSCALE), 64)
-
-	if err != nil {
-		panic(err)
-	}
-
-	return kstatLoadavg
-}
-
-func getLoad() ([]float64, error) {
-	tok, err := kstat.Open()
-	if err != nil {
-		panic(err)
-	}
-
-	defer tok.Close()
-
-	ks, err := tok.Lookup("unix", 0, "system_misc")
-
-	if err != nil {
-		panic(err)
-	}
-
-	loadavg1Min := kstatToFloat(ks, "avenrun_1min")
-	loadavg5Min := kstatToFloat(ks, "avenrun_5min")
-	loadavg15Min := kstatToFloat(ks, "avenrun_15min")
-
-	return []float64{loadavg1Min, loadavg5Min, loadavg15Min}, nil
+func (c *loadavgCollector) getLoad() ([]float64, error) {
+	return kstatLoad(openKstatReader)
 }
@@ -28,6 +28,7 @@ import (
 )
 
 type mdadmCollector struct {
+	paths  Paths
 	logger log.Logger
 }
 
@@ -37,7 +38,7 @@ func init() {
 
 // NewMdadmCollector returns a new Collector exposing raid statistics.
 func NewMdadmCollector(logger log.Logger) (Collector, error) {
-	return &mdadmCollector{logger}, nil
+	return &mdadmCollector{paths: currentPaths(), logger: logger}, nil
 }
 
 var (
@@ -102,7 +103,7 @@ var (
 )
 
 func (c *mdadmCollector) Update(ch chan<- prometheus.Metric) error {
-	fs, err := procfs.NewFS(*procPath)
+	fs, err := procfs.NewFS(c.paths.ProcFS)
 
 	if err != nil {
 		return fmt.Errorf("failed to open procfs: %w", err)
@@ -112,7 +113,7 @@ func (c *mdadmCollector) Update(ch chan<- prometheus.Metric) error {
 
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			level.Debug(c.logger).Log("msg", "Not collecting mdstat, file does not exist", "file", *procPath)
+			level.Debug(c.logger).Log("msg", "Not collecting mdstat, file does not exist", "file", c.paths.ProcFS)
 			return ErrNoData
 		}
 
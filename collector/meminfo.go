@@ -31,6 +31,7 @@ const (
 )
 
 type meminfoCollector struct {
+	paths  Paths
 	logger log.Logger
 }
 
@@ -40,7 +41,7 @@ func init() {
 
 // NewMeminfoCollector returns a new Collector exposing memory stats.
 func NewMeminfoCollector(logger log.Logger) (Collector, error) {
-	return &meminfoCollector{logger}, nil
+	return &meminfoCollector{paths: currentPaths(), logger: logger}, nil
 }
 
 // Update calls (*meminfoCollector).getMemInfo to get the platform specific
@@ -0,0 +1,318 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nonetlink
+// +build !nonetlink
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	netCollectorSubsystem = "net_link"
+)
+
+// netLinkStats are the counters of the link kstats. The 64-bit statistics
+// are preferred over their 32-bit alternatives. illumos reports packets
+// dropped for lack of buffers as norcvbuf and noxmtbuf.
+var netLinkStats = []struct {
+	stats      []string
+	name, help string
+}{
+	{[]string{"rbytes64", "rbytes"}, "receive_bytes_total", "Bytes received by the link."},
+	{[]string{"obytes64", "obytes"}, "transmit_bytes_total", "Bytes transmitted by the link."},
+	{[]string{"ipackets64", "ipackets"}, "receive_packets_total", "Packets received by the link."},
+	{[]string{"opackets64", "opackets"}, "transmit_packets_total", "Packets transmitted by the link."},
+	{[]string{"ierrors"}, "receive_errors_total", "Receive errors of the link."},
+	{[]string{"oerrors"}, "transmit_errors_total", "Transmit errors of the link."},
+	{[]string{"multircv"}, "receive_multicast_total", "Multicast packets received by the link."},
+	{[]string{"multixmt"}, "transmit_multicast_total", "Multicast packets transmitted by the link."},
+	{[]string{"brdcstrcv"}, "receive_broadcast_total", "Broadcast packets received by the link."},
+	{[]string{"brdcstxmt"}, "transmit_broadcast_total", "Broadcast packets transmitted by the link."},
+	{[]string{"collisions"}, "collisions_total", "Collisions on the link."},
+	{[]string{"norcvbuf"}, "receive_nobuf_total", "Received packets of the link dropped for lack of buffers."},
+	{[]string{"noxmtbuf"}, "transmit_nobuf_total", "Packets to transmit on the link dropped for lack of buffers."},
+	{[]string{"unknowns"}, "receive_unknown_protocol_total", "Received packets of the link with an unknown protocol."},
+}
+
+// netLinkDuplexes are the duplex modes by the link_duplex kstat statistic.
+var netLinkDuplexes = []string{"unknown", "half", "full"}
+
+// netLinkLACPStates are the LACP states of aggregation ports printed by
+// dladm show-aggr -L.
+var netLinkLACPStates = []string{"aggregatable", "sync", "coll", "dist", "defaulted", "expired"}
+
+type netLinkCollector struct {
+	info         typedDesc
+	up           typedDesc
+	mtu          typedDesc
+	speed        typedDesc
+	duplex       typedDesc
+	stats        []typedDesc
+	vnicInfo     typedDesc
+	aggrInfo     typedDesc
+	aggrPortUp   typedDesc
+	aggrPortLACP typedDesc
+
+	open kstatOpener
+	// run runs a command and returns its output.
+	run func(ctx context.Context, name string, args ...string) ([]byte, error)
+	// runner runs run, it is nil if run doesn't run commands.
+	runner *commandRunner
+	logger log.Logger
+}
+
+func newNetLinkCollector(open kstatOpener, run func(ctx context.Context, name string, args ...string) ([]byte, error), logger log.Logger) *netLinkCollector {
+	desc := func(name, help string, valueType prometheus.ValueType, labels ...string) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, netCollectorSubsystem, name), help, labels, nil,
+		), valueType}
+	}
+	c := &netLinkCollector{
+		info:         desc("info", "Class of the link, the bridge it belongs to and the links it is over.", prometheus.GaugeValue, "link", "class", "bridge", "over"),
+		up:           desc("up", "Whether the link is up.", prometheus.GaugeValue, "link"),
+		mtu:          desc("mtu_bytes", "MTU of the link.", prometheus.GaugeValue, "link"),
+		speed:        desc("speed_bytes", "Speed of the link in bytes per second.", prometheus.GaugeValue, "link"),
+		duplex:       desc("duplex", "Duplex mode of the link.", prometheus.GaugeValue, "link", "duplex"),
+		vnicInfo:     desc("vnic_info", "Link, zone, MAC address and VLAN ID of the VNIC.", prometheus.GaugeValue, "link", "over", "zone", "macaddress", "vid"),
+		aggrInfo:     desc("aggr_info", "Policy and LACP mode of the aggregation.", prometheus.GaugeValue, "link", "policy", "lacp_activity", "lacp_timer"),
+		aggrPortUp:   desc("aggr_port_attached", "Whether the port is attached to the aggregation.", prometheus.GaugeValue, "link", "port"),
+		aggrPortLACP: desc("aggr_port_lacp_state", "LACP state of the aggregation port.", prometheus.GaugeValue, "link", "port", "state"),
+		open:         open,
+		run:          run,
+		logger:       logger,
+	}
+	for _, s := range netLinkStats {
+		c.stats = append(c.stats, desc(s.name, s.help, prometheus.CounterValue, "link"))
+	}
+	return c
+}
+
+func (c *netLinkCollector) Update(ch chan<- prometheus.Metric) error {
+	return c.UpdateContext(context.Background(), ch)
+}
+
+func (c *netLinkCollector) UpdateContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	err := errors.Join(
+		c.updateKstats(ch),
+		c.updateLinks(ctx, ch),
+		c.updateVNICs(ctx, ch),
+		c.updateAggrs(ctx, ch),
+	)
+	if c.runner != nil {
+		c.runner.collect(ch)
+	}
+	return err
+}
+
+// updateKstats exports the counters, speed and duplex mode of the links.
+func (c *netLinkCollector) updateKstats(ch chan<- prometheus.Metric) error {
+	r, err := c.open()
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	for _, id := range r.list() {
+		if id.module != "link" || id.instance != 0 {
+			continue
+		}
+		stats, err := r.read(id)
+		if err != nil {
+			return fmt.Errorf("couldn't read kstat %s: %w", id, err)
+		}
+		link := id.name
+		for i, s := range netLinkStats {
+			for _, stat := range s.stats {
+				if v, err := stats.value(stat); err == nil {
+					ch <- c.stats[i].mustNewConstMetric(v, link)
+					break
+				}
+			}
+		}
+		if v, err := stats.value("ifspeed"); err == nil {
+			ch <- c.speed.mustNewConstMetric(v/8, link)
+		}
+		if v, err := stats.value("link_duplex"); err == nil {
+			for i, duplex := range netLinkDuplexes {
+				var current float64
+				if int(v) == i {
+					current = 1
+				}
+				ch <- c.duplex.mustNewConstMetric(current, link, duplex)
+			}
+		}
+	}
+	return nil
+}
+
+// updateLinks exports the configuration of the links.
+func (c *netLinkCollector) updateLinks(ctx context.Context, ch chan<- prometheus.Metric) error {
+	links, err := c.dladm(ctx, 6, "show-link", "-p", "-o", "link,class,mtu,state,bridge,over")
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		link := l[0]
+		ch <- c.info.mustNewConstMetric(1, link, l[1], l[4], l[5])
+		var up float64
+		if l[3] == "up" {
+			up = 1
+		}
+		ch <- c.up.mustNewConstMetric(up, link)
+		if l[2] == "" {
+			continue
+		}
+		mtu, err := strconv.ParseFloat(l[2], 64)
+		if err != nil {
+			return fmt.Errorf("invalid MTU of link %s: %w", link, err)
+		}
+		ch <- c.mtu.mustNewConstMetric(mtu, link)
+	}
+	return nil
+}
+
+// updateVNICs exports the zones and MAC addresses of VNICs. VNICs of the
+// global zone have no zone printed.
+func (c *netLinkCollector) updateVNICs(ctx context.Context, ch chan<- prometheus.Metric) error {
+	vnics, err := c.dladm(ctx, 5, "show-vnic", "-p", "-o", "link,over,zone,macaddress,vid")
+	if err != nil {
+		return err
+	}
+	for _, v := range vnics {
+		zone := v[2]
+		if zone == "" {
+			zone = "global"
+		}
+		ch <- c.vnicInfo.mustNewConstMetric(1, v[0], v[1], zone, v[3], v[4])
+	}
+	return nil
+}
+
+// updateAggrs exports the aggregations, their ports and LACP states.
+func (c *netLinkCollector) updateAggrs(ctx context.Context, ch chan<- prometheus.Metric) error {
+	aggrs, err := c.dladm(ctx, 4, "show-aggr", "-p", "-o", "link,policy,lacpactivity,lacptimer")
+	if err != nil {
+		return err
+	}
+	if len(aggrs) == 0 {
+		return nil
+	}
+	for _, a := range aggrs {
+		ch <- c.aggrInfo.mustNewConstMetric(1, a[0], a[1], a[2], a[3])
+	}
+
+	ports, err := c.dladm(ctx, 3, "show-aggr", "-p", "-x", "-o", "link,port,portstate")
+	if err != nil {
+		return err
+	}
+	for _, p := range ports {
+		// The aggregation itself has no port.
+		if p[1] == "" {
+			continue
+		}
+		var attached float64
+		if p[2] == "attached" {
+			attached = 1
+		}
+		ch <- c.aggrPortUp.mustNewConstMetric(attached, p[0], p[1])
+	}
+
+	lacp, err := c.dladm(ctx, 2+len(netLinkLACPStates), "show-aggr", "-p", "-L", "-o", "link,port,"+strings.Join(netLinkLACPStates, ","))
+	if err != nil {
+		return err
+	}
+	for _, p := range lacp {
+		if p[1] == "" {
+			continue
+		}
+		for i, state := range netLinkLACPStates {
+			var v float64
+			if p[2+i] == "yes" {
+				v = 1
+			}
+			ch <- c.aggrPortLACP.mustNewConstMetric(v, p[0], p[1], state)
+		}
+	}
+	return nil
+}
+
+// dladm runs dladm with args, printing the given number of fields in
+// parsable form, and returns the fields of each line.
+func (c *netLinkCollector) dladm(ctx context.Context, fields int, args ...string) ([][]string, error) {
+	out, err := c.run(ctx, "dladm", args...)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := parseDladm(string(out), fields)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse dladm %s output: %w", args[0], err)
+	}
+	return lines, nil
+}
+
+// parseDladm parses the output of a dladm subcommand run with -p, lines of
+// colon separated fields with colons in values escaped by backslashes.
+// Empty values, printed as "--", are returned as empty strings.
+func parseDladm(out string, fields int) ([][]string, error) {
+	var lines [][]string
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		values := splitDladmFields(line)
+		if len(values) != fields {
+			return nil, fmt.Errorf("expected %d fields, got %d: %q", fields, len(values), line)
+		}
+		for i, v := range values {
+			if v == "--" {
+				values[i] = ""
+			}
+		}
+		lines = append(lines, values)
+	}
+	return lines, nil
+}
+
+// splitDladmFields splits a line of parsable dladm output at the colons
+// not escaped by a backslash.
+func splitDladmFields(line string) []string {
+	var (
+		fields []string
+		field  strings.Builder
+	)
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if i+1 < len(line) {
+				i++
+			}
+			field.WriteByte(line[i])
+		case ':':
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(line[i])
+		}
+	}
+	return append(fields, field.String())
+}
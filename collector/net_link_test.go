@@ -0,0 +1,91 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nonetlink
+// +build !nonetlink
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// dladmFixture runs dladm by reading fixtures/net_link.
+func dladmFixture(_ context.Context, name string, args ...string) ([]byte, error) {
+	file := args[0]
+	if file == "show-aggr" {
+		switch args[2] {
+		case "-x":
+			file += "-ports"
+		case "-L":
+			file += "-lacp"
+		}
+	}
+	if name != "dladm" {
+		return nil, fmt.Errorf("unexpected command %s %v", name, args)
+	}
+	return os.ReadFile("fixtures/net_link/" + file + ".txt")
+}
+
+func TestNetLink(t *testing.T) {
+	c := newNetLinkCollector(kstatFixtureOpener("fixtures/net_link/kstat.txt"), dladmFixture, log.NewNopLogger())
+	want, err := os.Open("fixtures/net_link/net_link.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, want); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseDladm(t *testing.T) {
+	for _, tc := range []struct {
+		out    string
+		fields int
+		want   [][]string
+		err    bool
+	}{
+		{
+			out:    "web01_net0:aggr0:web01:2\\:8\\:20\\:d9\\:ab\\:cd:0\n",
+			fields: 5,
+			want:   [][]string{{"web01_net0", "aggr0", "web01", "2:8:20:d9:ab:cd", "0"}},
+		},
+		{
+			out:    "aggr0:aggr:1500:up:--:ixgbe0 ixgbe1\n\nstub0:etherstub:9000:unknown:--:--\n",
+			fields: 6,
+			want: [][]string{
+				{"aggr0", "aggr", "1500", "up", "", "ixgbe0 ixgbe1"},
+				{"stub0", "etherstub", "9000", "unknown", "", ""},
+			},
+		},
+		{out: "", fields: 3},
+		{out: "aggr0:L4\n", fields: 4, err: true},
+	} {
+		got, err := parseDladm(tc.out, tc.fields)
+		if (err != nil) != tc.err {
+			t.Errorf("%q: unexpected error %v", tc.out, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: want %q, got %q", tc.out, tc.want, got)
+		}
+	}
+}
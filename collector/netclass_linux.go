@@ -41,6 +41,9 @@ type netClassCollector struct {
 	fs                    sysfs.FS
 	subsystem             string
 	ignoredDevicesPattern *regexp.Regexp
+	ignoreInvalidSpeed    bool
+	netlink               bool
+	withStats             bool
 	metricDescs           map[string]*prometheus.Desc
 	metricDescsMu         sync.Mutex
 	logger                log.Logger
@@ -61,13 +64,16 @@ func NewNetClassCollector(logger log.Logger) (Collector, error) {
 		fs:                    fs,
 		subsystem:             "network",
 		ignoredDevicesPattern: pattern,
+		ignoreInvalidSpeed:    *netclassInvalidSpeed,
+		netlink:               *netclassNetlink,
+		withStats:             *netclassRTNLWithStats,
 		metricDescs:           map[string]*prometheus.Desc{},
 		logger:                logger,
 	}, nil
 }
 
 func (c *netClassCollector) Update(ch chan<- prometheus.Metric) error {
-	if *netclassNetlink {
+	if c.netlink {
 		return c.netClassRTNLUpdate(ch)
 	}
 	return c.netClassSysfsUpdate(ch)
@@ -123,7 +129,7 @@ func (c *netClassCollector) netClassSysfsUpdate(ch chan<- prometheus.Metric) err
 
 		if ifaceInfo.Speed != nil {
 			// Some devices return -1 if the speed is unknown.
-			if *ifaceInfo.Speed >= 0 || !*netclassInvalidSpeed {
+			if *ifaceInfo.Speed >= 0 || !c.ignoreInvalidSpeed {
 				speedBytes := int64(*ifaceInfo.Speed * 1000 * 1000 / 8)
 				pushMetric(ch, c.getFieldDesc("speed_bytes"), "speed_bytes", speedBytes, prometheus.GaugeValue, ifaceInfo.Name)
 			}
@@ -19,6 +19,7 @@ package collector
 
 import (
 	"errors"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -34,7 +35,7 @@ import (
 */
 import "C"
 
-func getNetDevStats(filter *deviceFilter, logger log.Logger) (netDevStats, error) {
+func getNetDevStats(filter *deviceFilter, paths Paths, logger log.Logger) (netDevStats, error) {
 	netDev := netDevStats{}
 
 	var ifap, ifa *C.struct_ifaddrs
@@ -72,3 +73,12 @@ func getNetDevStats(filter *deviceFilter, logger log.Logger) (netDevStats, error
 
 	return netDev, nil
 }
+
+// netDevBootTimes returns a function reporting the boot time if a device
+// exists since boot. Devices are not known to exist since boot on this
+// platform.
+func netDevBootTimes(paths Paths) func(dev string) (time.Time, bool) {
+	return func(string) (time.Time, bool) {
+		return time.Time{}, false
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"net"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
@@ -42,13 +43,28 @@ var (
 type netDevCollector struct {
 	subsystem        string
 	deviceFilter     deviceFilter
+	addressInfo      bool
+	detailedMetrics  bool
 	metricDescsMutex sync.Mutex
 	metricDescs      map[string]*prometheus.Desc
-	logger           log.Logger
+	// createdMutex protects created and collected.
+	createdMutex sync.Mutex
+	created      map[string]netDevCreated
+	collected    bool
+	paths        Paths
+	logger       log.Logger
 }
 
 type netDevStats map[string]map[string]uint64
 
+// netDevCreated holds the time the counters of a device started at, zero if
+// unknown, and the sum of their last values, which goes backwards when the
+// device is created anew.
+type netDevCreated struct {
+	time  time.Time
+	total uint64
+}
+
 func init() {
 	registerCollector("netdev", defaultEnabled, NewNetDevCollector)
 }
@@ -86,10 +102,14 @@ func NewNetDevCollector(logger log.Logger) (Collector, error) {
 	}
 
 	return &netDevCollector{
-		subsystem:    "network",
-		deviceFilter: newDeviceFilter(*netdevDeviceExclude, *netdevDeviceInclude),
-		metricDescs:  map[string]*prometheus.Desc{},
-		logger:       logger,
+		subsystem:       "network",
+		deviceFilter:    newDeviceFilter(*netdevDeviceExclude, *netdevDeviceInclude),
+		addressInfo:     *netdevAddressInfo,
+		detailedMetrics: *netdevDetailedMetrics,
+		metricDescs:     map[string]*prometheus.Desc{},
+		created:         map[string]netDevCreated{},
+		paths:           currentPaths(),
+		logger:          logger,
 	}, nil
 }
 
@@ -110,20 +130,25 @@ func (c *netDevCollector) metricDesc(key string) *prometheus.Desc {
 }
 
 func (c *netDevCollector) Update(ch chan<- prometheus.Metric) error {
-	netDev, err := getNetDevStats(&c.deviceFilter, c.logger)
+	netDev, err := getNetDevStats(&c.deviceFilter, c.paths, c.logger)
 	if err != nil {
 		return fmt.Errorf("couldn't get netstats: %w", err)
 	}
+	created := c.createdTimes(netDev, time.Now())
 	for dev, devStats := range netDev {
-		if !*netdevDetailedMetrics {
+		if !c.detailedMetrics {
 			legacy(devStats)
 		}
 		for key, value := range devStats {
 			desc := c.metricDesc(key)
+			if t := created[dev]; !t.IsZero() {
+				ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(desc, prometheus.CounterValue, float64(value), t, dev)
+				continue
+			}
 			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value), dev)
 		}
 	}
-	if *netdevAddressInfo {
+	if c.addressInfo {
 		interfaces, err := net.Interfaces()
 		if err != nil {
 			return fmt.Errorf("could not get network interfaces: %w", err)
@@ -141,6 +166,47 @@ func (c *netDevCollector) Update(ch chan<- prometheus.Metric) error {
 	return nil
 }
 
+// createdTimes returns the time the counters of each device started at, or
+// the zero time if unknown. Devices existing at the first collection are
+// assumed to exist since boot if netDevBootTimes knows so. Devices appearing
+// later, or whose counters went backwards, were created since the previous
+// collection, which now approximates.
+func (c *netDevCollector) createdTimes(netDev netDevStats, now time.Time) map[string]time.Time {
+	c.createdMutex.Lock()
+	defer c.createdMutex.Unlock()
+
+	var bootTime func(dev string) (time.Time, bool)
+	if !c.collected {
+		bootTime = netDevBootTimes(c.paths)
+	}
+	times := make(map[string]time.Time, len(netDev))
+	for dev, devStats := range netDev {
+		var total uint64
+		for _, value := range devStats {
+			total += value
+		}
+		prev, ok := c.created[dev]
+		var t time.Time
+		switch {
+		case !ok && !c.collected:
+			t, _ = bootTime(dev)
+		case !ok || total < prev.total:
+			t = now
+		default:
+			t = prev.time
+		}
+		c.created[dev] = netDevCreated{time: t, total: total}
+		times[dev] = t
+	}
+	for dev := range c.created {
+		if _, ok := netDev[dev]; !ok {
+			delete(c.created, dev)
+		}
+	}
+	c.collected = true
+	return times
+}
+
 type addrInfo struct {
 	device  string
 	addr    string
@@ -21,13 +21,14 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"golang.org/x/sys/unix"
 )
 
-func getNetDevStats(filter *deviceFilter, logger log.Logger) (netDevStats, error) {
+func getNetDevStats(filter *deviceFilter, paths Paths, logger log.Logger) (netDevStats, error) {
 	netDev := netDevStats{}
 
 	ifs, err := net.Interfaces()
@@ -118,3 +119,12 @@ type ifData64 struct {
 	Xmittiming uint32
 	Lastchange unix.Timeval32
 }
+
+// netDevBootTimes returns a function reporting the boot time if a device
+// exists since boot. Devices are not known to exist since boot on this
+// platform.
+func netDevBootTimes(paths Paths) func(dev string) (time.Time, bool) {
+	return func(string) (time.Time, bool) {
+		return time.Time{}, false
+	}
+}
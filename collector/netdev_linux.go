@@ -18,6 +18,10 @@ package collector
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
@@ -30,11 +34,33 @@ var (
 	netDevNetlink = kingpin.Flag("collector.netdev.netlink", "Use netlink to gather stats instead of /proc/net/dev.").Default("true").Bool()
 )
 
-func getNetDevStats(filter *deviceFilter, logger log.Logger) (netDevStats, error) {
-	if *netDevNetlink {
+func getNetDevStats(filter *deviceFilter, paths Paths, logger log.Logger) (netDevStats, error) {
+	if flagValue(netDevNetlink) {
 		return netlinkStats(filter, logger)
 	}
-	return procNetDevStats(filter, logger)
+	return procNetDevStats(filter, paths, logger)
+}
+
+// netDevBootTimes returns a function reporting the boot time if a device
+// exists since boot, which is assumed for all but virtual devices such as
+// those of containers. The boot time is read once.
+func netDevBootTimes(paths Paths) func(dev string) (time.Time, bool) {
+	var bootTime time.Time
+	if fs, err := procfs.NewFS(paths.ProcFS); err == nil {
+		if stat, err := fs.Stat(); err == nil {
+			bootTime = time.Unix(int64(stat.BootTime), 0)
+		}
+	}
+	return func(dev string) (time.Time, bool) {
+		if bootTime.IsZero() {
+			return time.Time{}, false
+		}
+		target, err := os.Readlink(paths.sysFilePath(filepath.Join("class/net", dev)))
+		if err != nil || strings.Contains(target, "/devices/virtual/") {
+			return time.Time{}, false
+		}
+		return bootTime, true
+	}
 }
 
 func netlinkStats(filter *deviceFilter, logger log.Logger) (netDevStats, error) {
@@ -141,10 +167,10 @@ func parseNetlinkStats(links []rtnetlink.LinkMessage, filter *deviceFilter, logg
 	return metrics
 }
 
-func procNetDevStats(filter *deviceFilter, logger log.Logger) (netDevStats, error) {
+func procNetDevStats(filter *deviceFilter, paths Paths, logger log.Logger) (netDevStats, error) {
 	metrics := netDevStats{}
 
-	fs, err := procfs.NewFS(*procPath)
+	fs, err := procfs.NewFS(paths.ProcFS)
 	if err != nil {
 		return metrics, fmt.Errorf("failed to open procfs: %w", err)
 	}
@@ -18,6 +18,7 @@ package collector
 
 import (
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
 
@@ -339,3 +340,39 @@ func TestNetDevMetricValues(t *testing.T) {
 		}
 	}
 }
+
+func TestNetDevCreatedTimes(t *testing.T) {
+	c := &netDevCollector{
+		created: map[string]netDevCreated{},
+		paths:   Paths{ProcFS: "fixtures/proc", SysFS: "fixtures/sys"},
+	}
+	bootTime := time.Unix(1418183276, 0)
+
+	// eth0 links to a physical device, bond0 is no link.
+	got := c.createdTimes(netDevStats{
+		"eth0":  {"receive_bytes": 10},
+		"bond0": {"receive_bytes": 10},
+	}, time.Unix(1, 0))
+	if !got["eth0"].Equal(bootTime) || !got["bond0"].IsZero() {
+		t.Errorf("want eth0 created at boot and bond0 unknown, got %v", got)
+	}
+
+	// Devices appearing later and counters going backwards start now.
+	now := time.Unix(2, 0)
+	got = c.createdTimes(netDevStats{
+		"eth0":  {"receive_bytes": 5},
+		"bond0": {"receive_bytes": 20},
+		"veth1": {"receive_bytes": 1},
+	}, now)
+	if !got["eth0"].Equal(now) || !got["bond0"].IsZero() || !got["veth1"].Equal(now) {
+		t.Errorf("want eth0 and veth1 created now and bond0 unknown, got %v", got)
+	}
+
+	got = c.createdTimes(netDevStats{"eth0": {"receive_bytes": 6}}, time.Unix(3, 0))
+	if !got["eth0"].Equal(now) {
+		t.Errorf("want eth0 created at %v, got %v", now, got["eth0"])
+	}
+	if _, ok := c.created["veth1"]; ok {
+		t.Error("expected removed device to be forgotten")
+	}
+}
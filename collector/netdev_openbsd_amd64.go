@@ -17,6 +17,8 @@
 package collector
 
 import (
+	"time"
+
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 
@@ -24,7 +26,7 @@ import (
 	"unsafe"
 )
 
-func getNetDevStats(filter *deviceFilter, logger log.Logger) (netDevStats, error) {
+func getNetDevStats(filter *deviceFilter, paths Paths, logger log.Logger) (netDevStats, error) {
 	netDev := netDevStats{}
 
 	mib := [6]_C_int{unix.CTL_NET, unix.AF_ROUTE, 0, 0, unix.NET_RT_IFLIST, 0}
@@ -76,3 +78,12 @@ func getNetDevStats(filter *deviceFilter, logger log.Logger) (netDevStats, error
 	}
 	return netDev, nil
 }
+
+// netDevBootTimes returns a function reporting the boot time if a device
+// exists since boot. Devices are not known to exist since boot on this
+// platform.
+func netDevBootTimes(paths Paths) func(dev string) (time.Time, bool) {
+	return func(string) (time.Time, bool) {
+		return time.Time{}, false
+	}
+}
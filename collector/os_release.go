@@ -58,6 +58,7 @@ type osRelease struct {
 
 type osReleaseCollector struct {
 	infoDesc           *prometheus.Desc
+	paths              Paths
 	logger             log.Logger
 	os                 *osRelease
 	osMutex            sync.RWMutex
@@ -84,6 +85,7 @@ func init() {
 // NewOSCollector returns a new Collector exposing os-release information.
 func NewOSCollector(logger log.Logger) (Collector, error) {
 	return &osReleaseCollector{
+		paths:  currentPaths(),
 		logger: logger,
 		infoDesc: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "os", "info"),
@@ -172,7 +174,7 @@ func (c *osReleaseCollector) UpdateStruct(path string) error {
 
 func (c *osReleaseCollector) Update(ch chan<- prometheus.Metric) error {
 	for i, path := range c.osReleaseFilenames {
-		err := c.UpdateStruct(*rootfsPath + path)
+		err := c.UpdateStruct(c.paths.RootFS + path)
 		if err == nil {
 			break
 		}
@@ -16,6 +16,8 @@ package collector
 import (
 	"path/filepath"
 	"strings"
+	"sync"
+
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/prometheus/procfs"
 )
@@ -28,35 +30,108 @@ var (
 	udevDataPath = kingpin.Flag("path.udev.data", "udev data path.").Default("/run/udev/data").String()
 	kstatCfgPath = kingpin.Flag("path.kstatcfg", "kstat config path.").Default("/usr/local/etc/kstat_config.yml").String()
 	psCfgPath    = kingpin.Flag("path.pscfg", "ps config path.").Default("/usr/local/etc/kstat_config.yml").String()
+
+	// pathsMtx serializes the creation of collectors, as the path flags are
+	// temporarily pointed to the paths of a probe target meanwhile.
+	pathsMtx sync.Mutex
 )
 
-func procFilePath(name string) string {
-	return filepath.Join(*procPath, name)
+// Paths holds the filesystem locations collectors read from. Collectors
+// resolve them once on creation via currentPaths and keep them, so that
+// collectors of different probe targets can be used concurrently. Unset
+// paths default to the --path.* flags.
+type Paths struct {
+	ProcFS   string `yaml:"procfs"`
+	SysFS    string `yaml:"sysfs"`
+	RootFS   string `yaml:"rootfs"`
+	UdevData string `yaml:"udev_data"`
 }
 
-func sysFilePath(name string) string {
-	return filepath.Join(*sysPath, name)
+// currentPaths returns the paths of the collector being created.
+func currentPaths() Paths {
+	return Paths{
+		ProcFS:   *procPath,
+		SysFS:    *sysPath,
+		RootFS:   *rootfsPath,
+		UdevData: *udevDataPath,
+	}
 }
 
-func rootfsFilePath(name string) string {
-	return filepath.Join(*rootfsPath, name)
+// withPaths runs f, which creates collectors, with the path flags set to p.
+// A nil p keeps the flags as they are.
+func withPaths(p *Paths, f func()) {
+	pathsMtx.Lock()
+	defer pathsMtx.Unlock()
+	if p != nil {
+		saved := currentPaths()
+		setPaths(*p)
+		defer setPaths(saved)
+	}
+	f()
 }
 
-func udevDataFilePath(name string) string {
-	return filepath.Join(*udevDataPath, name)
+func setPaths(p Paths) {
+	if p.ProcFS != "" {
+		*procPath = p.ProcFS
+	}
+	if p.SysFS != "" {
+		*sysPath = p.SysFS
+	}
+	if p.RootFS != "" {
+		*rootfsPath = p.RootFS
+	}
+	if p.UdevData != "" {
+		*udevDataPath = p.UdevData
+	}
 }
 
-func rootfsStripPrefix(path string) string {
-	if *rootfsPath == "/" {
+func (p Paths) procFilePath(name string) string {
+	return filepath.Join(p.ProcFS, name)
+}
+
+func (p Paths) sysFilePath(name string) string {
+	return filepath.Join(p.SysFS, name)
+}
+
+func (p Paths) rootfsFilePath(name string) string {
+	return filepath.Join(p.RootFS, name)
+}
+
+func (p Paths) udevDataFilePath(name string) string {
+	return filepath.Join(p.UdevData, name)
+}
+
+func (p Paths) rootfsStripPrefix(path string) string {
+	if p.RootFS == "/" {
 		return path
 	}
-	stripped := strings.TrimPrefix(path, *rootfsPath)
+	stripped := strings.TrimPrefix(path, p.RootFS)
 	if stripped == "" {
 		return "/"
 	}
 	return stripped
 }
 
+func procFilePath(name string) string {
+	return currentPaths().procFilePath(name)
+}
+
+func sysFilePath(name string) string {
+	return currentPaths().sysFilePath(name)
+}
+
+func rootfsFilePath(name string) string {
+	return currentPaths().rootfsFilePath(name)
+}
+
+func udevDataFilePath(name string) string {
+	return currentPaths().udevDataFilePath(name)
+}
+
+func rootfsStripPrefix(path string) string {
+	return currentPaths().rootfsStripPrefix(path)
+}
+
 func kstatCfgFilePath() string {
 	return *kstatCfgPath
 }
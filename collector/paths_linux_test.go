@@ -0,0 +1,105 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noloadavg
+// +build !noloadavg
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTargetCollector(t *testing.T) {
+	oldStates := map[string]bool{}
+	for name, enabled := range collectorState {
+		oldStates[name] = *enabled
+		*enabled = name == "loadavg"
+	}
+	oldProcPath := *procPath
+	initiatedCollectorsMtx.Lock()
+	oldCollectors, oldTargetCollectors := initiatedCollectors, initiatedTargetCollectors
+	initiatedCollectors = map[string]Collector{}
+	initiatedTargetCollectors = map[string]map[string]Collector{}
+	initiatedCollectorsMtx.Unlock()
+	defer func() {
+		ApplyConfig(nil, nil)
+		for name, enabled := range oldStates {
+			*collectorState[name] = enabled
+		}
+		*procPath = oldProcPath
+		initiatedCollectors, initiatedTargetCollectors = oldCollectors, oldTargetCollectors
+	}()
+
+	*procPath = "/nonexistent"
+	cfg, err := parseConfig([]byte(`
+targets:
+  fixtures:
+    procfs: fixtures/proc
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyConfig(cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	nc, err := NewTargetCollector("fixtures", log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "/nonexistent", *procPath; want != got {
+		t.Errorf("expected --path.procfs to be restored to %q, got %q", want, got)
+	}
+	// Other targets must not affect the paths of a created collector.
+	*procPath = "/changed"
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(nc)
+	want := `# HELP node_load1 1m load average.
+# TYPE node_load1 gauge
+node_load1 0.21
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "node_load1"); err != nil {
+		t.Error(err)
+	}
+
+	again, err := NewTargetCollector("fixtures", log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Collectors["loadavg"] != nc.Collectors["loadavg"] {
+		t.Error("expected the collectors of a target to be reused")
+	}
+
+	if _, err := NewTargetCollector("doesnotexist", log.NewNopLogger()); err == nil || err.Error() != "unknown target: doesnotexist" {
+		t.Errorf("expected unknown target error, got %v", err)
+	}
+
+	*procPath = "fixtures/proc"
+	if err := Reload(cfg, nil, log.NewNopLogger(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(initiatedTargetCollectors) != 0 {
+		t.Errorf("expected target collectors to be dropped on reload, got %v", initiatedTargetCollectors)
+	}
+
+	if _, err := parseConfig([]byte("targets:\n  empty: {}\n")); err == nil {
+		t.Error("expected target without paths to be rejected")
+	}
+}
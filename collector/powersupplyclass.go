@@ -33,6 +33,7 @@ type powerSupplyClassCollector struct {
 	subsystem      string
 	ignoredPattern *regexp.Regexp
 	metricDescs    map[string]*prometheus.Desc
+	paths          Paths
 	logger         log.Logger
 }
 
@@ -46,6 +47,7 @@ func NewPowerSupplyClassCollector(logger log.Logger) (Collector, error) {
 		subsystem:      "power_supply",
 		ignoredPattern: pattern,
 		metricDescs:    map[string]*prometheus.Desc{},
+		paths:          currentPaths(),
 		logger:         logger,
 	}, nil
 }
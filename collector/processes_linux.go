@@ -39,6 +39,7 @@ type processCollector struct {
 	procsState   *prometheus.Desc
 	pidUsed      *prometheus.Desc
 	pidMax       *prometheus.Desc
+	paths        Paths
 	logger       log.Logger
 }
 
@@ -54,7 +55,8 @@ func NewProcessStatCollector(logger log.Logger) (Collector, error) {
 	}
 	subsystem := "processes"
 	return &processCollector{
-		fs: fs,
+		fs:    fs,
+		paths: currentPaths(),
 		threadAlloc: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, subsystem, "threads"),
 			"Allocated threads in system",
@@ -91,7 +93,7 @@ func (c *processCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 
 	ch <- prometheus.MustNewConstMetric(c.threadAlloc, prometheus.GaugeValue, float64(threads))
-	maxThreads, err := readUintFromFile(procFilePath("sys/kernel/threads-max"))
+	maxThreads, err := readUintFromFile(c.paths.procFilePath("sys/kernel/threads-max"))
 	if err != nil {
 		return fmt.Errorf("unable to retrieve limit number of threads: %w", err)
 	}
@@ -105,7 +107,7 @@ func (c *processCollector) Update(ch chan<- prometheus.Metric) error {
 		ch <- prometheus.MustNewConstMetric(c.threadsState, prometheus.GaugeValue, float64(threadStates[state]), state)
 	}
 
-	pidM, err := readUintFromFile(procFilePath("sys/kernel/pid_max"))
+	pidM, err := readUintFromFile(c.paths.procFilePath("sys/kernel/pid_max"))
 	if err != nil {
 		return fmt.Errorf("unable to retrieve limit number of maximum pids alloved: %w", err)
 	}
@@ -148,7 +150,7 @@ func (c *processCollector) getAllocatedThreads() (int, map[string]int32, int, ma
 }
 
 func (c *processCollector) getThreadStates(pid int, pidStat procfs.ProcStat, threadStates map[string]int32) error {
-	fs, err := procfs.NewFS(procFilePath(path.Join(strconv.Itoa(pid), "task")))
+	fs, err := procfs.NewFS(c.paths.procFilePath(path.Join(strconv.Itoa(pid), "task")))
 	if err != nil {
 		if c.isIgnoredError(err) {
 			level.Debug(c.logger).Log("msg", "file not found when retrieving tasks for pid", "pid", pid, "err", err)
@@ -0,0 +1,66 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+type psConfig struct {
+	NumberCpu int `yaml:"number_cpu"`
+	NumberMem int `yaml:"number_mem"`
+	NumberIO  int `yaml:"number_io"`
+	NumberCtx int `yaml:"number_context_switches"`
+	NumberFDs int `yaml:"number_fds"`
+
+	Groups psGroupsConfig `yaml:"groups"`
+}
+
+// psGroupsConfig configures the aggregation of processes into groups.
+type psGroupsConfig struct {
+	// By is comm, cgroup or systemd_unit. Empty disables groups.
+	By string `yaml:"by"`
+	// Comm maps processes whose comm fully matches a regexp to a group,
+	// when grouping by comm.
+	Comm []psCommGroup `yaml:"comm"`
+	// Max bounds the number of groups. Further groups are aggregated as
+	// "other".
+	Max int `yaml:"max"`
+}
+
+type psCommGroup struct {
+	Name   string `yaml:"name"`
+	Regexp string `yaml:"regexp"`
+}
+
+// loadPsConfig returns the ps section of the configuration file. An
+// explicitly given --path.pscfg, or a configuration file without ps
+// section, falls back to reading the separate ps config file.
+func loadPsConfig() (psConfig, error) {
+	var cfgFile psConfig
+
+	if section := currentConfig().Ps; section != nil && !isExplicitFlag("path.pscfg") {
+		return *section, nil
+	}
+
+	yamlFile, err := os.ReadFile(psCfgFilePath())
+	if err != nil {
+		return cfgFile, err
+	}
+
+	err = yaml.Unmarshal(yamlFile, &cfgFile)
+	return cfgFile, err
+}
@@ -0,0 +1,397 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nops
+// +build !nops
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+const (
+	// psDefaultNum is the number of top processes exported by default.
+	psDefaultNum = 10
+	// psDefaultMaxGroups bounds the number of groups by default.
+	psDefaultMaxGroups = 20
+	// psOtherGroup aggregates processes in no or in too many groups.
+	psOtherGroup = "other"
+	// psArgsLen bounds the length of the args label, like the arguments in
+	// psinfo on illumos.
+	psArgsLen = 80
+	// psUserHZ is USER_HZ, the clock tick rate of the start times in
+	// /proc/<pid>/stat. It is 100 on all architectures Go supports, which
+	// procfs assumes as well for the CPU times.
+	psUserHZ = 100
+)
+
+type psCommMatcher struct {
+	name string
+	re   *regexp.Regexp
+}
+
+type psProcfsCollector struct {
+	fs         procfs.FS
+	numCPU     int
+	numMem     int
+	numIO      int
+	numFDs     int
+	groupBy    string
+	commGroups []psCommMatcher
+	maxGroups  int
+	pageSize   uint64
+	now        func() time.Time
+
+	topCPU     typedDesc
+	topMem     typedDesc
+	topIO      typedDesc
+	topFDs     typedDesc
+	groupProcs typedDesc
+	groupCPU   typedDesc
+	groupRSS   typedDesc
+	groupFDs   typedDesc
+	logger     log.Logger
+	history    psHistory
+}
+
+func init() {
+	registerCollector("ps", defaultDisabled, NewPsCollector)
+}
+
+// NewPsCollector returns a new Collector exposing the top processes and
+// process groups read from the proc filesystem.
+func NewPsCollector(logger log.Logger) (Collector, error) {
+	cfg, err := loadPsConfig()
+	// Unlike on illumos, a ps config file is optional.
+	if errors.Is(err, fs.ErrNotExist) && !isExplicitFlag("path.pscfg") {
+		cfg, err = psConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fs, err := procfs.NewFS(currentPaths().ProcFS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+	return newPsProcfsCollector(fs, cfg, logger)
+}
+
+func newPsProcfsCollector(fs procfs.FS, cfg psConfig, logger log.Logger) (*psProcfsCollector, error) {
+	c := &psProcfsCollector{
+		fs:        fs,
+		numCPU:    psNumber(cfg.NumberCpu),
+		numMem:    psNumber(cfg.NumberMem),
+		numIO:     psNumber(cfg.NumberIO),
+		numFDs:    psNumber(cfg.NumberFDs),
+		groupBy:   cfg.Groups.By,
+		maxGroups: cfg.Groups.Max,
+		pageSize:  uint64(os.Getpagesize()),
+		now:       time.Now,
+		logger:    logger,
+	}
+	if c.maxGroups <= 0 {
+		c.maxGroups = psDefaultMaxGroups
+	}
+	switch c.groupBy {
+	case "", "cgroup", "systemd_unit":
+		if len(cfg.Groups.Comm) > 0 {
+			return nil, fmt.Errorf("ps comm groups require grouping by comm, not %q", c.groupBy)
+		}
+	case "comm":
+		for _, g := range cfg.Groups.Comm {
+			re, err := regexp.Compile("^(?:" + g.Regexp + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid regexp of ps group %q: %w", g.Name, err)
+			}
+			c.commGroups = append(c.commGroups, psCommMatcher{g.Name, re})
+		}
+	default:
+		return nil, fmt.Errorf("invalid ps groups by %q, must be comm, cgroup or systemd_unit", c.groupBy)
+	}
+
+	topLabels := []string{"index", "pid", "comm", "args"}
+	groupLabels := []string{"group"}
+	c.topCPU = typedDesc{prometheus.NewDesc(
+		"node_ps_top_cpu_percents",
+		"Process of top CPU consumption processes.",
+		topLabels, nil,
+	), prometheus.GaugeValue}
+	c.topMem = typedDesc{prometheus.NewDesc(
+		"node_ps_top_mem_kilobytes",
+		"Process of top memory consumption processes.",
+		topLabels, nil,
+	), prometheus.GaugeValue}
+	c.topIO = typedDesc{prometheus.NewDesc(
+		"node_ps_top_io_bytes_per_second",
+		"Bytes read and written per second by the processes with the most I/O, over at least the last minute or since their start.",
+		topLabels, nil,
+	), prometheus.GaugeValue}
+	c.topFDs = typedDesc{prometheus.NewDesc(
+		"node_ps_top_open_fds",
+		"Open file descriptors of the processes with the most open file descriptors.",
+		topLabels, nil,
+	), prometheus.GaugeValue}
+	c.groupProcs = typedDesc{prometheus.NewDesc(
+		"node_ps_group_processes",
+		"Number of processes in the group.",
+		groupLabels, nil,
+	), prometheus.GaugeValue}
+	c.groupCPU = typedDesc{prometheus.NewDesc(
+		"node_ps_group_cpu_percents",
+		"Recent CPU usage of all processes in the group.",
+		groupLabels, nil,
+	), prometheus.GaugeValue}
+	c.groupRSS = typedDesc{prometheus.NewDesc(
+		"node_ps_group_rss_bytes",
+		"Resident set size of all processes in the group.",
+		groupLabels, nil,
+	), prometheus.GaugeValue}
+	c.groupFDs = typedDesc{prometheus.NewDesc(
+		"node_ps_group_open_fds",
+		"Open file descriptors of all processes in the group.",
+		groupLabels, nil,
+	), prometheus.GaugeValue}
+	return c, nil
+}
+
+// psNumber returns the configured number of top processes n, or the
+// default if unset.
+func psNumber(n int) int {
+	if n <= 0 {
+		return psDefaultNum
+	}
+	return n
+}
+
+func (c *psProcfsCollector) Update(ch chan<- prometheus.Metric) error {
+	stat, err := c.fs.Stat()
+	if err != nil {
+		return fmt.Errorf("couldn't get stat: %w", err)
+	}
+	ncpus := len(stat.CPU)
+	if ncpus == 0 {
+		ncpus = 1
+	}
+	procs, err := c.readProcesses(stat.BootTime)
+	if err != nil {
+		return fmt.Errorf("couldn't read processes: %w", err)
+	}
+
+	// Like pr_pctcpu on illumos, CPU usage is a percentage of all CPUs,
+	// over at least the last minute or, for new processes, since their
+	// start.
+	now := c.now()
+	base := c.history.add(procs, now)
+	cpuRate := psRate(base, now, func(u psCounters) float64 { return u.cpuTime })
+	for i := range procs {
+		procs[i].pctCPU = cpuRate(procs[i]) / float64(ncpus) * 100
+	}
+
+	top := func(desc typedDesc, procs []psProcess, value func(psProcess) float64) {
+		for i, p := range procs {
+			ch <- desc.mustNewConstMetric(value(p), strconv.Itoa(i), strconv.Itoa(int(p.pid)), p.comm, p.args)
+		}
+	}
+	top(c.topCPU, topPs(procs, c.numCPU, func(p psProcess) float64 { return p.pctCPU }),
+		func(p psProcess) float64 { return p.pctCPU })
+	top(c.topMem, topPs(procs, c.numMem, func(p psProcess) float64 { return float64(p.rss) }),
+		func(p psProcess) float64 { return float64(p.rss) })
+	ioRate := psRate(base, now, func(u psCounters) float64 { return float64(u.ioBytes) })
+	top(c.topIO, topPs(procs, c.numIO, ioRate), ioRate)
+	top(c.topFDs, topPs(procs, c.numFDs, func(p psProcess) float64 { return float64(p.fds) }),
+		func(p psProcess) float64 { return float64(p.fds) })
+
+	if c.groupBy != "" {
+		c.updateGroups(ch, procs)
+	}
+	return nil
+}
+
+// readProcesses reads all processes. Processes exiting meanwhile are
+// skipped, as are the I/O and file descriptors of processes not readable by
+// the exporter.
+func (c *psProcfsCollector) readProcesses(bootTime uint64) ([]psProcess, error) {
+	all, err := c.fs.AllProcs()
+	if err != nil {
+		return nil, err
+	}
+
+	procs := make([]psProcess, 0, len(all))
+	for _, proc := range all {
+		s, err := proc.Stat()
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read process stat", "pid", proc.PID, "err", err)
+			continue
+		}
+		p := psProcess{
+			pid:     int32(proc.PID),
+			start:   int64(bootTime)*1e9 + int64(s.Starttime)*1e9/psUserHZ,
+			comm:    s.Comm,
+			cpuTime: s.CPUTime(),
+			rss:     uint64(s.RSS) * c.pageSize / 1024,
+		}
+		if cmdline, err := proc.CmdLine(); err == nil && len(cmdline) > 0 {
+			p.args = strings.Join(cmdline, " ")
+		} else {
+			p.args = "[" + s.Comm + "]"
+		}
+		if len(p.args) > psArgsLen {
+			p.args = p.args[:psArgsLen]
+		}
+		p.args = strings.ToValidUTF8(p.args, "?")
+		if io, err := proc.IO(); err == nil {
+			p.ioBytes = io.RChar + io.WChar
+		}
+		if fds, err := proc.FileDescriptorsLen(); err == nil {
+			p.fds = fds
+		}
+		p.group = c.group(proc, p.comm)
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
+
+// group returns the group of the process proc with the given comm.
+func (c *psProcfsCollector) group(proc procfs.Proc, comm string) string {
+	switch c.groupBy {
+	case "comm":
+		for _, g := range c.commGroups {
+			if g.re.MatchString(comm) {
+				return g.name
+			}
+		}
+	case "cgroup", "systemd_unit":
+		cgroups, err := proc.Cgroups()
+		if err != nil {
+			return psOtherGroup
+		}
+		cgroup := psCgroupPath(cgroups)
+		if c.groupBy == "cgroup" {
+			if cgroup != "" {
+				return cgroup
+			}
+			break
+		}
+		if unit := psSystemdUnit(cgroup); unit != "" {
+			return unit
+		}
+	}
+	return psOtherGroup
+}
+
+// psCgroupPath returns the cgroup v2 path of a process, or the path in the
+// systemd hierarchy of cgroup v1.
+func psCgroupPath(cgroups []procfs.Cgroup) string {
+	for _, cgroup := range cgroups {
+		if cgroup.HierarchyID == 0 {
+			return cgroup.Path
+		}
+	}
+	for _, cgroup := range cgroups {
+		for _, controller := range cgroup.Controllers {
+			if controller == "name=systemd" {
+				return cgroup.Path
+			}
+		}
+	}
+	return ""
+}
+
+// psSystemdUnit returns the innermost service or scope unit in the cgroup
+// path.
+func psSystemdUnit(cgroup string) string {
+	for cgroup != "/" && cgroup != "." && cgroup != "" {
+		unit := path.Base(cgroup)
+		if strings.HasSuffix(unit, ".service") || strings.HasSuffix(unit, ".scope") {
+			return unit
+		}
+		cgroup = path.Dir(cgroup)
+	}
+	return ""
+}
+
+// updateGroups exports the aggregates of the process groups. Only the
+// groups using the most CPU are kept, the others are aggregated as
+// psOtherGroup.
+func (c *psProcfsCollector) updateGroups(ch chan<- prometheus.Metric, procs []psProcess) {
+	type groupStats struct {
+		name   string
+		procs  int
+		pctCPU float64
+		rss    uint64
+		fds    int
+	}
+	byName := map[string]*groupStats{}
+	for _, p := range procs {
+		g, ok := byName[p.group]
+		if !ok {
+			g = &groupStats{name: p.group}
+			byName[p.group] = g
+		}
+		g.procs++
+		g.pctCPU += p.pctCPU
+		g.rss += p.rss
+		g.fds += p.fds
+	}
+
+	var groups []*groupStats
+	other := byName[psOtherGroup]
+	for name, g := range byName {
+		if name != psOtherGroup {
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].pctCPU != groups[j].pctCPU {
+			return groups[i].pctCPU > groups[j].pctCPU
+		}
+		return groups[i].name < groups[j].name
+	})
+	if len(groups) > c.maxGroups {
+		if other == nil {
+			other = &groupStats{name: psOtherGroup}
+		}
+		for _, g := range groups[c.maxGroups:] {
+			other.procs += g.procs
+			other.pctCPU += g.pctCPU
+			other.rss += g.rss
+			other.fds += g.fds
+		}
+		groups = groups[:c.maxGroups]
+	}
+	if other != nil {
+		groups = append(groups, other)
+	}
+
+	for _, g := range groups {
+		ch <- c.groupProcs.mustNewConstMetric(float64(g.procs), g.name)
+		ch <- c.groupCPU.mustNewConstMetric(g.pctCPU, g.name)
+		ch <- c.groupRSS.mustNewConstMetric(float64(g.rss)*1024, g.name)
+		ch <- c.groupFDs.mustNewConstMetric(float64(g.fds), g.name)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nops
+// +build !nops
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/procfs"
+)
+
+func newTestPsProcfsCollector(t *testing.T, cfg psConfig) *psProcfsCollector {
+	t.Helper()
+	fs, err := procfs.NewFS("fixtures/ps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newPsProcfsCollector(fs, cfg, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pageSize = 4096
+	c.now = func() time.Time { return time.Unix(1700010000, 0) }
+	return c
+}
+
+func TestPsProcfsCollector(t *testing.T) {
+	c := newTestPsProcfsCollector(t, psConfig{
+		NumberCpu: 3,
+		NumberMem: 2,
+		NumberIO:  2,
+		NumberFDs: 2,
+		Groups:    psGroupsConfig{By: "systemd_unit", Max: 2},
+	})
+
+	want := `# HELP node_ps_group_cpu_percents Recent CPU usage of all processes in the group.
+	# TYPE node_ps_group_cpu_percents gauge
+	node_ps_group_cpu_percents{group="nginx.service"} 6
+	node_ps_group_cpu_percents{group="other"} 0.75
+	node_ps_group_cpu_percents{group="postgresql@14-main.service"} 10
+	# HELP node_ps_group_open_fds Open file descriptors of all processes in the group.
+	# TYPE node_ps_group_open_fds gauge
+	node_ps_group_open_fds{group="nginx.service"} 6
+	node_ps_group_open_fds{group="other"} 3
+	node_ps_group_open_fds{group="postgresql@14-main.service"} 5
+	# HELP node_ps_group_processes Number of processes in the group.
+	# TYPE node_ps_group_processes gauge
+	node_ps_group_processes{group="nginx.service"} 2
+	node_ps_group_processes{group="other"} 3
+	node_ps_group_processes{group="postgresql@14-main.service"} 1
+	# HELP node_ps_group_rss_bytes Resident set size of all processes in the group.
+	# TYPE node_ps_group_rss_bytes gauge
+	node_ps_group_rss_bytes{group="nginx.service"} 2.4576e+07
+	node_ps_group_rss_bytes{group="other"} 1.7408e+07
+	node_ps_group_rss_bytes{group="postgresql@14-main.service"} 1.024e+08
+	# HELP node_ps_top_cpu_percents Process of top CPU consumption processes.
+	# TYPE node_ps_top_cpu_percents gauge
+	node_ps_top_cpu_percents{args="/usr/lib/postgresql/14/bin/postgres -D /var/lib/postgresql/14/main -c config_fil",comm="postgres",index="0",pid="600"} 10
+	node_ps_top_cpu_percents{args="nginx: master process /usr/sbin/nginx",comm="nginx",index="2",pid="412"} 1
+	node_ps_top_cpu_percents{args="nginx: worker process",comm="nginx",index="1",pid="413"} 5
+	# HELP node_ps_top_io_bytes_per_second Bytes read and written per second by the processes with the most I/O, over at least the last minute or since their start.
+	# TYPE node_ps_top_io_bytes_per_second gauge
+	node_ps_top_io_bytes_per_second{args="/usr/lib/postgresql/14/bin/postgres -D /var/lib/postgresql/14/main -c config_fil",comm="postgres",index="1",pid="600"} 500
+	node_ps_top_io_bytes_per_second{args="nginx: worker process",comm="nginx",index="0",pid="413"} 1400
+	# HELP node_ps_top_mem_kilobytes Process of top memory consumption processes.
+	# TYPE node_ps_top_mem_kilobytes gauge
+	node_ps_top_mem_kilobytes{args="/usr/lib/postgresql/14/bin/postgres -D /var/lib/postgresql/14/main -c config_fil",comm="postgres",index="0",pid="600"} 100000
+	node_ps_top_mem_kilobytes{args="nginx: worker process",comm="nginx",index="1",pid="413"} 20000
+	# HELP node_ps_top_open_fds Open file descriptors of the processes with the most open file descriptors.
+	# TYPE node_ps_top_open_fds gauge
+	node_ps_top_open_fds{args="/usr/lib/postgresql/14/bin/postgres -D /var/lib/postgresql/14/main -c config_fil",comm="postgres",index="0",pid="600"} 5
+	node_ps_top_open_fds{args="nginx: worker process",comm="nginx",index="1",pid="413"} 4
+	`
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+
+	// Without CPU time spent since the first scrape, whose sample is the
+	// only one yet, all processes are idle.
+	c.now = func() time.Time { return time.Unix(1700010010, 0) }
+	want = `# HELP node_ps_top_cpu_percents Process of top CPU consumption processes.
+	# TYPE node_ps_top_cpu_percents gauge
+	node_ps_top_cpu_percents{args="/sbin/init splash",comm="systemd",index="0",pid="1"} 0
+	node_ps_top_cpu_percents{args="[kthreadd]",comm="kthreadd",index="1",pid="2"} 0
+	node_ps_top_cpu_percents{args="nginx: master process /usr/sbin/nginx",comm="nginx",index="2",pid="412"} 0
+	`
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), "node_ps_top_cpu_percents"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPsProcfsCommGroups(t *testing.T) {
+	c := newTestPsProcfsCollector(t, psConfig{
+		Groups: psGroupsConfig{By: "comm", Comm: []psCommGroup{
+			{Name: "web", Regexp: "nginx|httpd"},
+			{Name: "db", Regexp: "postgres"},
+		}},
+	})
+
+	want := `# HELP node_ps_group_processes Number of processes in the group.
+	# TYPE node_ps_group_processes gauge
+	node_ps_group_processes{group="db"} 1
+	node_ps_group_processes{group="other"} 3
+	node_ps_group_processes{group="web"} 2
+	`
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), "node_ps_group_processes"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPsProcfsInvalidGroups(t *testing.T) {
+	fs, err := procfs.NewFS("fixtures/ps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, groups := range []psGroupsConfig{
+		{By: "user"},
+		{By: "cgroup", Comm: []psCommGroup{{Name: "web", Regexp: "nginx"}}},
+		{By: "comm", Comm: []psCommGroup{{Name: "web", Regexp: "nginx("}}},
+	} {
+		if _, err := newPsProcfsCollector(fs, psConfig{Groups: groups}, log.NewNopLogger()); err == nil {
+			t.Errorf("%+v: expected error", groups)
+		}
+	}
+}
+
+func TestPsSystemdUnit(t *testing.T) {
+	for cgroup, want := range map[string]string{
+		"/system.slice/nginx.service":                                       "nginx.service",
+		"/user.slice/user-1000.slice/user@1000.service/app.slice/vte.scope": "vte.scope",
+		"/system.slice/docker.service/payload":                              "docker.service",
+		"/user.slice":                                                       "",
+		"/":                                                                 "",
+	} {
+		if got := psSystemdUnit(cgroup); got != want {
+			t.Errorf("%s: want unit %q, got %q", cgroup, want, got)
+		}
+	}
+
+	v1 := []procfs.Cgroup{
+		{HierarchyID: 4, Controllers: []string{"cpu", "cpuacct"}, Path: "/"},
+		{HierarchyID: 1, Controllers: []string{"name=systemd"}, Path: "/system.slice/sshd.service"},
+	}
+	if got := psCgroupPath(v1); got != "/system.slice/sshd.service" {
+		t.Errorf("want systemd cgroup v1 path, got %q", got)
+	}
+}
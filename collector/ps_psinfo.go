@@ -0,0 +1,397 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nops
+// +build !nops
+
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Offsets into the psinfo_t and prusage_t structures of <sys/procfs.h> of
+// 64-bit illumos, which only runs on little-endian machines.
+const (
+	psinfoPid     = 8   // pr_pid
+	psinfoRSS     = 56  // pr_rssize, in kilobytes
+	psinfoPctCPU  = 80  // pr_pctcpu
+	psinfoStart   = 88  // pr_start
+	psinfoFname   = 136 // pr_fname[16]
+	psinfoPsargs  = 152 // pr_psargs[80]
+	psinfoZoneID  = 276 // pr_zoneid
+	psinfoMinSize = 288
+
+	prusageIctx    = 400 // pr_ictx
+	prusageVctx    = 392 // pr_vctx
+	prusageIoch    = 416 // pr_ioch
+	prusageMinSize = 424
+
+	// psPctScale is 100% in the 16 bit binary fraction of pr_pctcpu.
+	psPctScale = 0x8000
+
+	// psWindow is the time the rates of process counters are taken over,
+	// at least.
+	psWindow = time.Minute
+	// psSampleInterval is the minimum time between two samples of the
+	// process counters.
+	psSampleInterval = 10 * time.Second
+)
+
+// psProcess is a process read from /proc/<pid>/psinfo and usage.
+type psProcess struct {
+	pid    int32
+	zoneID int32
+	// start is the start time of the process in nanoseconds since the
+	// epoch. Together with pid it tells reused process IDs apart.
+	start  int64
+	comm   string
+	args   string
+	pctCPU float64
+	// rss is the resident set size in kilobytes.
+	rss uint64
+	// ioBytes is the number of characters read and written.
+	ioBytes uint64
+	// ctxSwitches is the number of voluntary and involuntary context
+	// switches.
+	ctxSwitches uint64
+	// cpuTime is the CPU time in seconds, fds the number of open file
+	// descriptors and group the process group. They are only known on
+	// Linux.
+	cpuTime float64
+	fds     int
+	group   string
+}
+
+type psKey struct {
+	pid   int32
+	start int64
+}
+
+// psCounters are the counters of a process at a sample.
+type psCounters struct {
+	ioBytes     uint64
+	ctxSwitches uint64
+	cpuTime     float64
+}
+
+// psSample holds the counters of all processes at a time.
+type psSample struct {
+	at       time.Time
+	counters map[psKey]psCounters
+}
+
+// psHistory holds samples of the process counters, so that rates are taken
+// over psWindow rather than since the previous scrape, which would depend on
+// how often and by how many servers the collector is scraped.
+type psHistory struct {
+	mtx     sync.Mutex
+	samples []psSample
+}
+
+type psCollector struct {
+	procPath  string
+	numCPU    int
+	numMem    int
+	numIO     int
+	numCtx    int
+	zoneName  func(zoneID int32) string
+	topCPU    typedDesc
+	topMem    typedDesc
+	topIO     typedDesc
+	topCtx    typedDesc
+	zoneProcs typedDesc
+	zoneRSS   typedDesc
+	zoneCPU   typedDesc
+	now       func() time.Time
+	logger    log.Logger
+	history   psHistory
+}
+
+func newPsCollector(procPath string, cfg psConfig, zoneName func(int32) string, logger log.Logger) *psCollector {
+	topLabels := []string{"index", "pid", "zoneid", "zone", "comm", "args"}
+	zoneLabels := []string{"zoneid", "zone"}
+	return &psCollector{
+		procPath: procPath,
+		numCPU:   cfg.NumberCpu,
+		numMem:   cfg.NumberMem,
+		numIO:    cfg.NumberIO,
+		numCtx:   cfg.NumberCtx,
+		zoneName: zoneName,
+		topCPU: typedDesc{prometheus.NewDesc(
+			"node_ps_top_cpu_percents",
+			"Process of top CPU consumption processes.",
+			topLabels, nil,
+		), prometheus.GaugeValue},
+		topMem: typedDesc{prometheus.NewDesc(
+			"node_ps_top_mem_kilobytes",
+			"Process of top memory consumption processes.",
+			topLabels, nil,
+		), prometheus.GaugeValue},
+		topIO: typedDesc{prometheus.NewDesc(
+			"node_ps_top_io_bytes_per_second",
+			"Bytes read and written per second by the processes with the most I/O, over at least the last minute or since their start.",
+			topLabels, nil,
+		), prometheus.GaugeValue},
+		topCtx: typedDesc{prometheus.NewDesc(
+			"node_ps_top_context_switches_per_second",
+			"Context switches per second of the processes with the most context switches, over at least the last minute or since their start.",
+			topLabels, nil,
+		), prometheus.GaugeValue},
+		zoneProcs: typedDesc{prometheus.NewDesc(
+			"node_ps_zone_processes",
+			"Number of processes in the zone.",
+			zoneLabels, nil,
+		), prometheus.GaugeValue},
+		zoneRSS: typedDesc{prometheus.NewDesc(
+			"node_ps_zone_rss_bytes",
+			"Resident set size of all processes in the zone.",
+			zoneLabels, nil,
+		), prometheus.GaugeValue},
+		zoneCPU: typedDesc{prometheus.NewDesc(
+			"node_ps_zone_cpu_percents",
+			"Recent CPU usage of all processes in the zone.",
+			zoneLabels, nil,
+		), prometheus.GaugeValue},
+		now:    time.Now,
+		logger: logger,
+	}
+}
+
+// parsePsinfo parses the psinfo_t in b.
+func parsePsinfo(b []byte, p *psProcess) error {
+	if len(b) < psinfoMinSize {
+		return fmt.Errorf("psinfo too short: %d bytes", len(b))
+	}
+	le := binary.LittleEndian
+	p.pid = int32(le.Uint32(b[psinfoPid:]))
+	p.zoneID = int32(le.Uint32(b[psinfoZoneID:]))
+	p.start = int64(le.Uint64(b[psinfoStart:]))*1e9 + int64(le.Uint64(b[psinfoStart+8:]))
+	p.comm = psString(b[psinfoFname : psinfoFname+16])
+	p.args = psString(b[psinfoPsargs : psinfoPsargs+80])
+	p.pctCPU = float64(le.Uint16(b[psinfoPctCPU:])) * 100 / psPctScale
+	p.rss = le.Uint64(b[psinfoRSS:])
+	return nil
+}
+
+// parsePrusage parses the prusage_t in b.
+func parsePrusage(b []byte, p *psProcess) error {
+	if len(b) < prusageMinSize {
+		return fmt.Errorf("usage too short: %d bytes", len(b))
+	}
+	le := binary.LittleEndian
+	p.ioBytes = le.Uint64(b[prusageIoch:])
+	p.ctxSwitches = le.Uint64(b[prusageVctx:]) + le.Uint64(b[prusageIctx:])
+	return nil
+}
+
+// psString returns the NUL terminated string in b, with invalid UTF-8,
+// e.g. of truncated arguments, replaced.
+func psString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.ToValidUTF8(string(b), "?")
+}
+
+// readPsProcesses reads all processes from the proc filesystem at procPath.
+// Processes exiting meanwhile are skipped.
+func (c *psCollector) readPsProcesses() ([]psProcess, error) {
+	entries, err := os.ReadDir(c.procPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var procs []psProcess
+	for _, entry := range entries {
+		if _, err := strconv.ParseUint(entry.Name(), 10, 32); err != nil {
+			continue
+		}
+		var p psProcess
+		b, err := os.ReadFile(filepath.Join(c.procPath, entry.Name(), "psinfo"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := parsePsinfo(b, &p); err != nil {
+			return nil, fmt.Errorf("couldn't parse psinfo of process %s: %w", entry.Name(), err)
+		}
+		// Without usage, e.g. of zombies, I/O and context switches stay
+		// zero.
+		b, err = os.ReadFile(filepath.Join(c.procPath, entry.Name(), "usage"))
+		if err == nil {
+			err = parsePrusage(b, &p)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "couldn't read process usage", "pid", entry.Name(), "err", err)
+		}
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
+
+func (p psProcess) key() psKey {
+	return psKey{p.pid, p.start}
+}
+
+func (p psProcess) counters() psCounters {
+	return psCounters{ioBytes: p.ioBytes, ctxSwitches: p.ctxSwitches, cpuTime: p.cpuTime}
+}
+
+// psCountersOf returns the counters of procs by process.
+func psCountersOf(procs []psProcess) map[psKey]psCounters {
+	counters := make(map[psKey]psCounters, len(procs))
+	for _, p := range procs {
+		counters[p.key()] = p.counters()
+	}
+	return counters
+}
+
+// add samples the counters of procs at now, unless the latest sample is
+// more recent than psSampleInterval. It returns the base of the rates: the
+// latest earlier sample at least psWindow old, else the oldest one, or the
+// zero psSample if there is none.
+func (h *psHistory) add(procs []psProcess, now time.Time) psSample {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for len(h.samples) > 1 && now.Sub(h.samples[1].at) >= psWindow {
+		h.samples = h.samples[1:]
+	}
+	var base psSample
+	if len(h.samples) > 0 {
+		base = h.samples[0]
+	}
+	if len(h.samples) == 0 || now.Sub(h.samples[len(h.samples)-1].at) >= psSampleInterval {
+		h.samples = append(h.samples, psSample{at: now, counters: psCountersOf(procs)})
+	}
+	return base
+}
+
+// psRate returns a function returning the per second rate of counter of a
+// process at now since base, or since its start if it is not in base.
+func psRate(base psSample, now time.Time, counter func(psCounters) float64) func(psProcess) float64 {
+	return func(p psProcess) float64 {
+		value := counter(p.counters())
+		elapsed := now.Sub(time.Unix(0, p.start)).Seconds()
+		if before, ok := base.counters[p.key()]; ok && counter(before) <= value {
+			value -= counter(before)
+			elapsed = now.Sub(base.at).Seconds()
+		}
+		if elapsed <= 0 {
+			return 0
+		}
+		return value / elapsed
+	}
+}
+
+// topPs returns the n processes with the largest value, in descending
+// order.
+func topPs(procs []psProcess, n int, value func(psProcess) float64) []psProcess {
+	top := make([]psProcess, len(procs))
+	copy(top, procs)
+	sort.SliceStable(top, func(i, j int) bool {
+		if vi, vj := value(top[i]), value(top[j]); vi != vj {
+			return vi > vj
+		}
+		return top[i].pid < top[j].pid
+	})
+	if n < len(top) {
+		top = top[:n]
+	}
+	return top
+}
+
+func (c *psCollector) Update(ch chan<- prometheus.Metric) error {
+	procs, err := c.readPsProcesses()
+	if err != nil {
+		return fmt.Errorf("couldn't read processes: %w", err)
+	}
+
+	zoneNames := map[int32]string{}
+	zoneName := func(zoneID int32) string {
+		name, ok := zoneNames[zoneID]
+		if !ok {
+			name = c.zoneName(zoneID)
+			zoneNames[zoneID] = name
+		}
+		return name
+	}
+	top := func(desc typedDesc, procs []psProcess, value func(psProcess) float64) {
+		for i, p := range procs {
+			ch <- desc.mustNewConstMetric(value(p),
+				strconv.Itoa(i),
+				strconv.Itoa(int(p.pid)),
+				strconv.Itoa(int(p.zoneID)),
+				zoneName(p.zoneID),
+				p.comm,
+				p.args,
+			)
+		}
+	}
+
+	top(c.topCPU, topPs(procs, c.numCPU, func(p psProcess) float64 { return p.pctCPU }),
+		func(p psProcess) float64 { return p.pctCPU })
+	top(c.topMem, topPs(procs, c.numMem, func(p psProcess) float64 { return float64(p.rss) }),
+		func(p psProcess) float64 { return float64(p.rss) })
+
+	// Rank I/O and context switches by their recent rate rather than
+	// their total since the start of the process.
+	now := c.now()
+	base := c.history.add(procs, now)
+	ioRate := psRate(base, now, func(u psCounters) float64 { return float64(u.ioBytes) })
+	top(c.topIO, topPs(procs, c.numIO, ioRate), ioRate)
+	ctxRate := psRate(base, now, func(u psCounters) float64 { return float64(u.ctxSwitches) })
+	top(c.topCtx, topPs(procs, c.numCtx, ctxRate), ctxRate)
+
+	type zoneStats struct {
+		procs  int
+		rss    uint64
+		pctCPU float64
+	}
+	zones := map[int32]*zoneStats{}
+	for _, p := range procs {
+		z, ok := zones[p.zoneID]
+		if !ok {
+			z = &zoneStats{}
+			zones[p.zoneID] = z
+		}
+		z.procs++
+		z.rss += p.rss
+		z.pctCPU += p.pctCPU
+	}
+	for zoneID, z := range zones {
+		labels := []string{strconv.Itoa(int(zoneID)), zoneName(zoneID)}
+		ch <- c.zoneProcs.mustNewConstMetric(float64(z.procs), labels...)
+		ch <- c.zoneRSS.mustNewConstMetric(float64(z.rss)*1024, labels...)
+		ch <- c.zoneCPU.mustNewConstMetric(z.pctCPU, labels...)
+	}
+	return nil
+}
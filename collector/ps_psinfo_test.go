@@ -0,0 +1,123 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nops
+// +build !nops
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPsCollector(t *testing.T) {
+	zones := map[int32]string{0: "global", 1: "web"}
+	cfg := psConfig{NumberCpu: 3, NumberMem: 2, NumberIO: 2, NumberCtx: 2}
+	c := newPsCollector("fixtures/psinfo", cfg, func(id int32) string { return zones[id] }, log.NewNopLogger())
+
+	now := time.Unix(1728900400, 500000000)
+	c.now = func() time.Time { return now }
+
+	// Rates are taken since the sample of 100 seconds ago, the one of 30
+	// seconds ago is too recent. nginx did most of its I/O before, java
+	// since, and sshd started since.
+	c.history.samples = []psSample{
+		{at: now.Add(-100 * time.Second), counters: map[psKey]psCounters{
+			{1, 1728900000500000000}:    {ioBytes: 100000, ctxSwitches: 500},
+			{812, 1728900120500000000}:  {ioBytes: 5000000, ctxSwitches: 5000},
+			{1024, 1728900130500000000}: {ioBytes: 49999000, ctxSwitches: 200},
+		}},
+		{at: now.Add(-30 * time.Second), counters: map[psKey]psCounters{
+			{812, 1728900120500000000}: {ioBytes: 9999000, ctxSwitches: 9990},
+		}},
+	}
+
+	want := `# HELP node_ps_top_context_switches_per_second Context switches per second of the processes with the most context switches, over at least the last minute or since their start.
+	# TYPE node_ps_top_context_switches_per_second gauge
+	node_ps_top_context_switches_per_second{args="/usr/bin/java -Xmx512m -jar /opt/app/app.jar",comm="java",index="0",pid="812",zone="web",zoneid="1"} 50
+	node_ps_top_context_switches_per_second{args="nginx: worker process",comm="nginx",index="1",pid="1024",zone="web",zoneid="1"} 0.3
+	# HELP node_ps_top_cpu_percents Process of top CPU consumption processes.
+	# TYPE node_ps_top_cpu_percents gauge
+	node_ps_top_cpu_percents{args="/usr/bin/java -Xmx512m -jar /opt/app/app.jar",comm="java",index="0",pid="812",zone="web",zoneid="1"} 50
+	node_ps_top_cpu_percents{args="nginx: worker process",comm="nginx",index="1",pid="1024",zone="web",zoneid="1"} 6.25
+	node_ps_top_cpu_percents{args="/usr/lib/ssh/sshd",comm="sshd",index="2",pid="2048",zone="global",zoneid="0"} 0.78125
+	# HELP node_ps_top_io_bytes_per_second Bytes read and written per second by the processes with the most I/O, over at least the last minute or since their start.
+	# TYPE node_ps_top_io_bytes_per_second gauge
+	node_ps_top_io_bytes_per_second{args="/usr/bin/java -Xmx512m -jar /opt/app/app.jar",comm="java",index="0",pid="812",zone="web",zoneid="1"} 50000
+	node_ps_top_io_bytes_per_second{args="/usr/lib/ssh/sshd",comm="sshd",index="1",pid="2048",zone="global",zoneid="0"} 20.48
+	# HELP node_ps_top_mem_kilobytes Process of top memory consumption processes.
+	# TYPE node_ps_top_mem_kilobytes gauge
+	node_ps_top_mem_kilobytes{args="/usr/bin/java -Xmx512m -jar /opt/app/app.jar",comm="java",index="0",pid="812",zone="web",zoneid="1"} 524288
+	node_ps_top_mem_kilobytes{args="nginx: worker process",comm="nginx",index="1",pid="1024",zone="web",zoneid="1"} 16384
+	# HELP node_ps_zone_cpu_percents Recent CPU usage of all processes in the zone.
+	# TYPE node_ps_zone_cpu_percents gauge
+	node_ps_zone_cpu_percents{zone="",zoneid="2"} 0
+	node_ps_zone_cpu_percents{zone="global",zoneid="0"} 1.171875
+	node_ps_zone_cpu_percents{zone="web",zoneid="1"} 56.25
+	# HELP node_ps_zone_processes Number of processes in the zone.
+	# TYPE node_ps_zone_processes gauge
+	node_ps_zone_processes{zone="",zoneid="2"} 1
+	node_ps_zone_processes{zone="global",zoneid="0"} 2
+	node_ps_zone_processes{zone="web",zoneid="1"} 2
+	# HELP node_ps_zone_rss_bytes Resident set size of all processes in the zone.
+	# TYPE node_ps_zone_rss_bytes gauge
+	node_ps_zone_rss_bytes{zone="",zoneid="2"} 0
+	node_ps_zone_rss_bytes{zone="global",zoneid="0"} 1.048576e+07
+	node_ps_zone_rss_bytes{zone="web",zoneid="1"} 5.53648128e+08
+	`
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPsHistory(t *testing.T) {
+	var h psHistory
+	start := time.Unix(1728900000, 0)
+	for _, tc := range []struct {
+		after, base time.Duration
+		samples     int
+	}{
+		{after: 0, base: -1, samples: 1},
+		// Samples are kept every psSampleInterval at most.
+		{after: 5 * time.Second, base: 0, samples: 1},
+		{after: 10 * time.Second, base: 0, samples: 2},
+		{after: 30 * time.Second, base: 0, samples: 3},
+		// The base is the latest sample at least psWindow old.
+		{after: 70 * time.Second, base: 10 * time.Second, samples: 3},
+		{after: 95 * time.Second, base: 30 * time.Second, samples: 3},
+	} {
+		base := h.add(nil, start.Add(tc.after))
+		if tc.base < 0 {
+			if !base.at.IsZero() {
+				t.Errorf("after %s: want no base, got %s", tc.after, base.at)
+			}
+		} else if want := start.Add(tc.base); !base.at.Equal(want) {
+			t.Errorf("after %s: want base %s, got %s", tc.after, want, base.at)
+		}
+		if len(h.samples) != tc.samples {
+			t.Errorf("after %s: want %d samples, got %d", tc.after, tc.samples, len(h.samples))
+		}
+	}
+}
+
+func TestParsePsinfoTooShort(t *testing.T) {
+	var p psProcess
+	if err := parsePsinfo(make([]byte, psinfoMinSize-1), &p); err == nil {
+		t.Error("expected error for truncated psinfo")
+	}
+}
@@ -32,6 +32,7 @@ import (
 type qdiscStatCollector struct {
 	logger       log.Logger
 	deviceFilter deviceFilter
+	fixtures     string
 	bytes        typedDesc
 	packets      typedDesc
 	drops        typedDesc
@@ -115,6 +116,7 @@ func NewQdiscStatCollector(logger log.Logger) (Collector, error) {
 		), prometheus.GaugeValue},
 		logger:       logger,
 		deviceFilter: newDeviceFilter(*collectorQdiscDeviceExclude, *collectorQdiscDeviceInclude),
+		fixtures:     *collectorQdisc,
 	}, nil
 }
 
@@ -134,7 +136,7 @@ func (c *qdiscStatCollector) Update(ch chan<- prometheus.Metric) error {
 	var msgs []qdisc.QdiscInfo
 	var err error
 
-	fixtures := *collectorQdisc
+	fixtures := c.fixtures
 
 	if fixtures == "" {
 		msgs, err = qdisc.Get()
@@ -0,0 +1,271 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// RelabelAction is the action of a relabeling rule.
+type RelabelAction string
+
+const (
+	relabelReplace   RelabelAction = "replace"
+	relabelKeep      RelabelAction = "keep"
+	relabelDrop      RelabelAction = "drop"
+	relabelHashMod   RelabelAction = "hashmod"
+	relabelLabelDrop RelabelAction = "labeldrop"
+	relabelLabelKeep RelabelAction = "labelkeep"
+)
+
+var relabelDroppedSeries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "scrape",
+		Name:      "collector_relabel_dropped_series_total",
+		Help:      "node_exporter: Total number of series of a collector dropped by metric relabeling.",
+	},
+	[]string{"collector"},
+)
+
+// descRE extracts the name and help of a metric from the output of
+// (*prometheus.Desc).String, as the client library offers no accessors.
+// TestRelabelMetricDesc pins the format this relies on.
+var descRE = regexp.MustCompile(`^Desc\{fqName: ("(?:[^"\\]|\\.)*"), help: ("(?:[^"\\]|\\.)*")`)
+
+// RelabelConfig is a metric relabeling rule with the semantics of
+// Prometheus' metric_relabel_configs.
+type RelabelConfig struct {
+	SourceLabels []string      `yaml:"source_labels,flow"`
+	Separator    string        `yaml:"separator"`
+	Regex        relabelRegexp `yaml:"regex"`
+	Modulus      uint64        `yaml:"modulus"`
+	TargetLabel  string        `yaml:"target_label"`
+	Replacement  string        `yaml:"replacement"`
+	Action       RelabelAction `yaml:"action"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, applying the Prometheus
+// defaults for unset fields.
+func (c *RelabelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = RelabelConfig{
+		Separator:   ";",
+		Regex:       mustNewRelabelRegexp("(.*)"),
+		Replacement: "$1",
+		Action:      relabelReplace,
+	}
+	type plain RelabelConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return c.validate()
+}
+
+func (c *RelabelConfig) validate() error {
+	switch c.Action {
+	case relabelReplace:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel action %s requires a target_label", c.Action)
+		}
+		if !strings.Contains(c.TargetLabel, "$") && !model.LabelName(c.TargetLabel).IsValid() {
+			return fmt.Errorf("invalid target_label %q", c.TargetLabel)
+		}
+	case relabelHashMod:
+		if !model.LabelName(c.TargetLabel).IsValid() {
+			return fmt.Errorf("relabel action %s requires a valid target_label, got %q", c.Action, c.TargetLabel)
+		}
+		if c.Modulus == 0 {
+			return fmt.Errorf("relabel action %s requires a non-zero modulus", c.Action)
+		}
+	case relabelKeep, relabelDrop:
+	case relabelLabelDrop, relabelLabelKeep:
+		if len(c.SourceLabels) > 0 || c.TargetLabel != "" {
+			return fmt.Errorf("relabel action %s only accepts a regex", c.Action)
+		}
+	default:
+		return fmt.Errorf("unknown relabel action %q", c.Action)
+	}
+	for _, l := range c.SourceLabels {
+		if !model.LabelName(l).IsValid() {
+			return fmt.Errorf("invalid source label %q", l)
+		}
+	}
+	return nil
+}
+
+// relabelRegexp is a regular expression anchored at both ends.
+type relabelRegexp struct {
+	*regexp.Regexp
+}
+
+func mustNewRelabelRegexp(s string) relabelRegexp {
+	return relabelRegexp{regexp.MustCompile("^(?:" + s + ")$")}
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (re *relabelRegexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	r, err := regexp.Compile("^(?:" + s + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid regex %q: %w", s, err)
+	}
+	re.Regexp = r
+	return nil
+}
+
+// relabel applies cfgs to the labels of a series, including its name as
+// __name__. It returns false if the series is dropped.
+func relabel(labels map[string]string, cfgs []*RelabelConfig) bool {
+	for _, cfg := range cfgs {
+		values := make([]string, 0, len(cfg.SourceLabels))
+		for _, l := range cfg.SourceLabels {
+			values = append(values, labels[l])
+		}
+		value := strings.Join(values, cfg.Separator)
+
+		switch cfg.Action {
+		case relabelKeep:
+			if !cfg.Regex.MatchString(value) {
+				return false
+			}
+		case relabelDrop:
+			if cfg.Regex.MatchString(value) {
+				return false
+			}
+		case relabelReplace:
+			indexes := cfg.Regex.FindStringSubmatchIndex(value)
+			if indexes == nil {
+				break
+			}
+			target := string(cfg.Regex.ExpandString(nil, cfg.TargetLabel, value, indexes))
+			if !model.LabelName(target).IsValid() {
+				break
+			}
+			replacement := string(cfg.Regex.ExpandString(nil, cfg.Replacement, value, indexes))
+			if replacement == "" {
+				delete(labels, target)
+				break
+			}
+			labels[target] = replacement
+		case relabelHashMod:
+			sum := md5.Sum([]byte(value))
+			labels[cfg.TargetLabel] = strconv.FormatUint(binary.BigEndian.Uint64(sum[8:])%cfg.Modulus, 10)
+		case relabelLabelDrop:
+			for name := range labels {
+				if cfg.Regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		case relabelLabelKeep:
+			for name := range labels {
+				if !cfg.Regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+	return labels[model.MetricNameLabel] != ""
+}
+
+// relabelMetric applies cfgs to m. It returns m itself if its labels are
+// unchanged, and false if it is dropped.
+func relabelMetric(m prometheus.Metric, cfgs []*RelabelConfig) (prometheus.Metric, bool, error) {
+	match := descRE.FindStringSubmatch(m.Desc().String())
+	if match == nil {
+		return nil, false, fmt.Errorf("unexpected metric descriptor %s", m.Desc())
+	}
+	name, err := strconv.Unquote(match[1])
+	if err != nil {
+		return nil, false, err
+	}
+	help, err := strconv.Unquote(match[2])
+	if err != nil {
+		return nil, false, err
+	}
+	var metric dto.Metric
+	if err := m.Write(&metric); err != nil {
+		return nil, false, err
+	}
+
+	labels := make(map[string]string, len(metric.Label)+1)
+	for _, lp := range metric.Label {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	labels[model.MetricNameLabel] = name
+	if !relabel(labels, cfgs) {
+		return nil, false, nil
+	}
+
+	newName := labels[model.MetricNameLabel]
+	delete(labels, model.MetricNameLabel)
+	changed := newName != name || len(labels) != len(metric.Label)
+	for _, lp := range metric.Label {
+		if v, ok := labels[lp.GetName()]; !ok || v != lp.GetValue() {
+			changed = true
+		}
+	}
+	if !changed {
+		return m, true, nil
+	}
+
+	pairs := make([]*dto.LabelPair, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, &dto.LabelPair{Name: stringPtr(name), Value: stringPtr(value)})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].GetName() < pairs[j].GetName() })
+	return relabeledMetric{
+		Metric: m,
+		desc:   prometheus.NewDesc(newName, help, nil, labels),
+		labels: pairs,
+	}, true, nil
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// relabeledMetric replaces the name and labels of a metric. The labels are
+// all part of its descriptor.
+type relabeledMetric struct {
+	prometheus.Metric
+	desc   *prometheus.Desc
+	labels []*dto.LabelPair
+}
+
+// Desc implements prometheus.Metric.
+func (m relabeledMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+// Write implements prometheus.Metric.
+func (m relabeledMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	out.Label = m.labels
+	return nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+func parseRelabelConfigs(t *testing.T, config string) []*RelabelConfig {
+	t.Helper()
+	var cfgs []*RelabelConfig
+	if err := yaml.UnmarshalStrict([]byte(config), &cfgs); err != nil {
+		t.Fatal(err)
+	}
+	return cfgs
+}
+
+func TestRelabel(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		labels map[string]string
+		want   map[string]string
+	}{
+		{
+			name:   "keep matching",
+			config: `[{source_labels: [__name__], regex: "node_ps_.*", action: keep}]`,
+			labels: map[string]string{"__name__": "node_ps_cpu", "pid": "1"},
+			want:   map[string]string{"__name__": "node_ps_cpu", "pid": "1"},
+		},
+		{
+			name:   "keep not matching",
+			config: `[{source_labels: [__name__], regex: "node_ps_.*", action: keep}]`,
+			labels: map[string]string{"__name__": "node_load1"},
+		},
+		{
+			name:   "drop",
+			config: `[{source_labels: [__name__, cpu], regex: "node_interrupts_total;[1-9][0-9]*", action: drop}]`,
+			labels: map[string]string{"__name__": "node_interrupts_total", "cpu": "12"},
+		},
+		{
+			name:   "drop not matching",
+			config: `[{source_labels: [__name__, cpu], regex: "node_interrupts_total;[1-9][0-9]*", action: drop}]`,
+			labels: map[string]string{"__name__": "node_interrupts_total", "cpu": "0"},
+			want:   map[string]string{"__name__": "node_interrupts_total", "cpu": "0"},
+		},
+		{
+			name:   "replace",
+			config: `[{source_labels: [device], regex: "(sd[a-z]+)[0-9]*", target_label: disk, replacement: "disk_$1"}]`,
+			labels: map[string]string{"__name__": "node_disk_io", "device": "sda1"},
+			want:   map[string]string{"__name__": "node_disk_io", "device": "sda1", "disk": "disk_sda"},
+		},
+		{
+			name:   "replace with empty value deletes",
+			config: `[{source_labels: [zone], regex: global, target_label: zone, replacement: ""}]`,
+			labels: map[string]string{"__name__": "node_ps_cpu", "zone": "global"},
+			want:   map[string]string{"__name__": "node_ps_cpu"},
+		},
+		{
+			name:   "replace name",
+			config: `[{source_labels: [__name__], regex: "node_kstat_(.*)", target_label: __name__, replacement: "node_$1"}]`,
+			labels: map[string]string{"__name__": "node_kstat_freemem"},
+			want:   map[string]string{"__name__": "node_freemem"},
+		},
+		{
+			name:   "hashmod",
+			config: `[{source_labels: [pid], target_label: shard, modulus: 8, action: hashmod}]`,
+			labels: map[string]string{"__name__": "node_ps_cpu", "pid": "1"},
+			want:   map[string]string{"__name__": "node_ps_cpu", "pid": "1", "shard": "3"},
+		},
+		{
+			name:   "labeldrop",
+			config: `[{regex: "args|pid", action: labeldrop}]`,
+			labels: map[string]string{"__name__": "node_ps_cpu", "args": "-v", "pid": "1", "comm": "sh"},
+			want:   map[string]string{"__name__": "node_ps_cpu", "comm": "sh"},
+		},
+		{
+			name:   "labelkeep",
+			config: `[{regex: "__name__|comm", action: labelkeep}]`,
+			labels: map[string]string{"__name__": "node_ps_cpu", "pid": "1", "comm": "sh"},
+			want:   map[string]string{"__name__": "node_ps_cpu", "comm": "sh"},
+		},
+		{
+			name:   "labelkeep without name drops",
+			config: `[{regex: comm, action: labelkeep}]`,
+			labels: map[string]string{"__name__": "node_ps_cpu", "comm": "sh"},
+		},
+	}
+
+	for _, test := range tests {
+		cfgs := parseRelabelConfigs(t, test.config)
+		keep := relabel(test.labels, cfgs)
+		if keep != (test.want != nil) {
+			t.Errorf("%s: want keep %t, got %t", test.name, test.want != nil, keep)
+			continue
+		}
+		if keep && !reflect.DeepEqual(test.want, test.labels) {
+			t.Errorf("%s: want labels %v, got %v", test.name, test.want, test.labels)
+		}
+	}
+}
+
+func TestRelabelConfigErrors(t *testing.T) {
+	for config, want := range map[string]string{
+		`[{action: replace}]`:                                 "requires a target_label",
+		`[{action: hashmod, target_label: shard}]`:            "non-zero modulus",
+		`[{action: labeldrop, source_labels: [a], regex: b}]`: "only accepts a regex",
+		`[{action: rewrite}]`:                                 `unknown relabel action "rewrite"`,
+		`[{action: keep, regex: "("}]`:                        "invalid regex",
+		`[{action: keep, source_labels: ["a-b"]}]`:            `invalid source label "a-b"`,
+	} {
+		var cfgs []*RelabelConfig
+		err := yaml.UnmarshalStrict([]byte(config), &cfgs)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", config, want, err)
+		}
+	}
+}
+
+func TestNodeCollectorRelabel(t *testing.T) {
+	cfg, err := parseConfig([]byte(`
+collectors:
+  loadavg:
+    metric_relabel_configs:
+      - source_labels: [__name__]
+        regex: node_test_value
+        target_label: source
+        replacement: test
+metric_relabel_configs:
+  - source_labels: [__name__, type]
+    regex: node_test_value;drop
+    action: drop
+  - regex: type
+    action: labeldrop
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := prometheus.NewDesc("node_test_value", "Test value.", []string{"type"}, nil)
+	c := testMetricsCollector{
+		prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, "keep"),
+		prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 2, "drop"),
+	}
+	nc := NodeCollector{
+		Collectors:     map[string]Collector{"loadavg": c},
+		relabelConfigs: cfg.relabelConfigs(),
+		logger:         log.NewNopLogger(),
+	}
+	relabelDroppedSeries.Reset()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(nc)
+	want := `# HELP node_scrape_collector_relabel_dropped_series_total node_exporter: Total number of series of a collector dropped by metric relabeling.
+# TYPE node_scrape_collector_relabel_dropped_series_total counter
+node_scrape_collector_relabel_dropped_series_total{collector="loadavg"} 1
+# HELP node_test_value Test value.
+# TYPE node_test_value gauge
+node_test_value{source="test"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "node_test_value", "node_scrape_collector_relabel_dropped_series_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestRelabelMetricDesc fails if the format of (*prometheus.Desc).String
+// changes in a way relabelMetric does not understand anymore.
+func TestRelabelMetricDesc(t *testing.T) {
+	cfgs := parseRelabelConfigs(t, `
+- target_label: added
+  replacement: value
+`)
+	for _, help := range []string{
+		"Plain help.",
+		`Help with "quotes", a backslash \ and a comma.`,
+		"Help with a newline\nand unicode: µs.",
+		`Help containing ", help: " like the format.`,
+		"",
+	} {
+		for _, test := range []struct {
+			metric prometheus.Metric
+			labels prometheus.Labels
+		}{
+			{
+				metric: prometheus.MustNewConstMetric(prometheus.NewDesc("node_test_value", help, nil, nil), prometheus.GaugeValue, 1),
+				labels: prometheus.Labels{"added": "value"},
+			},
+			{
+				metric: prometheus.MustNewConstMetric(
+					prometheus.NewDesc("node_test_value", help, []string{"type"}, prometheus.Labels{"const": `a "b"`}),
+					prometheus.GaugeValue, 1, "x",
+				),
+				labels: prometheus.Labels{"added": "value", "const": `a "b"`, "type": "x"},
+			},
+		} {
+			relabeled, keep, err := relabelMetric(test.metric, cfgs)
+			if err != nil || !keep {
+				t.Fatalf("%s: relabeling failed, has the descriptor format changed? %v", test.metric.Desc(), err)
+			}
+			want := prometheus.NewDesc("node_test_value", help, nil, test.labels)
+			if want.String() != relabeled.Desc().String() {
+				t.Errorf("want descriptor %s, got %s", want, relabeled.Desc())
+			}
+		}
+	}
+}
+
+type testMetricsCollector []prometheus.Metric
+
+func (c testMetricsCollector) Update(ch chan<- prometheus.Metric) error {
+	for _, m := range c {
+		ch <- m
+	}
+	return nil
+}
@@ -35,6 +35,7 @@ const (
 var pageSize = os.Getpagesize()
 
 type sockStatCollector struct {
+	paths  Paths
 	logger log.Logger
 }
 
@@ -44,11 +45,11 @@ func init() {
 
 // NewSockStatCollector returns a new Collector exposing socket stats.
 func NewSockStatCollector(logger log.Logger) (Collector, error) {
-	return &sockStatCollector{logger}, nil
+	return &sockStatCollector{paths: currentPaths(), logger: logger}, nil
 }
 
 func (c *sockStatCollector) Update(ch chan<- prometheus.Metric) error {
-	fs, err := procfs.NewFS(*procPath)
+	fs, err := procfs.NewFS(c.paths.ProcFS)
 	if err != nil {
 		return fmt.Errorf("failed to open procfs: %w", err)
 	}
@@ -18,6 +18,7 @@ package collector
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
@@ -34,6 +35,7 @@ type statCollector struct {
 	procsRunning *prometheus.Desc
 	procsBlocked *prometheus.Desc
 	softIRQ      *prometheus.Desc
+	withSoftIRQ  bool
 	logger       log.Logger
 }
 
@@ -86,7 +88,8 @@ func NewStatCollector(logger log.Logger) (Collector, error) {
 			"Number of softirq calls.",
 			[]string{"vector"}, nil,
 		),
-		logger: logger,
+		withSoftIRQ: *statSoftirqFlag,
+		logger:      logger,
 	}, nil
 }
 
@@ -97,16 +100,18 @@ func (c *statCollector) Update(ch chan<- prometheus.Metric) error {
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(c.intr, prometheus.CounterValue, float64(stats.IRQTotal))
-	ch <- prometheus.MustNewConstMetric(c.ctxt, prometheus.CounterValue, float64(stats.ContextSwitches))
-	ch <- prometheus.MustNewConstMetric(c.forks, prometheus.CounterValue, float64(stats.ProcessCreated))
+	// The counters of /proc/stat start at boot.
+	bootTime := time.Unix(int64(stats.BootTime), 0)
+	ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.intr, prometheus.CounterValue, float64(stats.IRQTotal), bootTime)
+	ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.ctxt, prometheus.CounterValue, float64(stats.ContextSwitches), bootTime)
+	ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.forks, prometheus.CounterValue, float64(stats.ProcessCreated), bootTime)
 
 	ch <- prometheus.MustNewConstMetric(c.btime, prometheus.GaugeValue, float64(stats.BootTime))
 
 	ch <- prometheus.MustNewConstMetric(c.procsRunning, prometheus.GaugeValue, float64(stats.ProcessesRunning))
 	ch <- prometheus.MustNewConstMetric(c.procsBlocked, prometheus.GaugeValue, float64(stats.ProcessesBlocked))
 
-	if *statSoftirqFlag {
+	if c.withSoftIRQ {
 		si := stats.SoftIRQ
 
 		for _, vec := range []struct {
@@ -124,7 +129,7 @@ func (c *statCollector) Update(ch chan<- prometheus.Metric) error {
 			{name: "hrtimer", value: si.Hrtimer},
 			{name: "rcu", value: si.Rcu},
 		} {
-			ch <- prometheus.MustNewConstMetric(c.softIRQ, prometheus.CounterValue, float64(vec.value), vec.name)
+			ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(c.softIRQ, prometheus.CounterValue, float64(vec.value), bootTime, vec.name)
 		}
 	}
 
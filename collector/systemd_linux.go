@@ -78,6 +78,10 @@ type systemdCollector struct {
 	// Use regexps for more flexibility than device_filter.go allows
 	systemdUnitIncludePattern *regexp.Regexp
 	systemdUnitExcludePattern *regexp.Regexp
+	private                   bool
+	enableTaskMetrics         bool
+	enableRestartsMetrics     bool
+	enableStartTimeMetrics    bool
 	logger                    log.Logger
 }
 
@@ -170,6 +174,10 @@ func NewSystemdCollector(logger log.Logger) (Collector, error) {
 		systemdVersionDesc:            systemdVersionDesc,
 		systemdUnitIncludePattern:     systemdUnitIncludePattern,
 		systemdUnitExcludePattern:     systemdUnitExcludePattern,
+		private:                       *systemdPrivate,
+		enableTaskMetrics:             *enableTaskMetrics,
+		enableRestartsMetrics:         *enableRestartsMetrics,
+		enableStartTimeMetrics:        *enableStartTimeMetrics,
 		logger:                        logger,
 	}, nil
 }
@@ -178,7 +186,7 @@ func NewSystemdCollector(logger log.Logger) (Collector, error) {
 // to reduce wait time for responses.
 func (c *systemdCollector) Update(ch chan<- prometheus.Metric) error {
 	begin := time.Now()
-	conn, err := newSystemdDbusConn()
+	conn, err := newSystemdDbusConn(c.private)
 	if err != nil {
 		return fmt.Errorf("couldn't get dbus connection: %w", err)
 	}
@@ -221,7 +229,7 @@ func (c *systemdCollector) Update(ch chan<- prometheus.Metric) error {
 		level.Debug(c.logger).Log("msg", "collectUnitStatusMetrics took", "duration_seconds", time.Since(begin).Seconds())
 	}()
 
-	if *enableStartTimeMetrics {
+	if c.enableStartTimeMetrics {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -231,7 +239,7 @@ func (c *systemdCollector) Update(ch chan<- prometheus.Metric) error {
 		}()
 	}
 
-	if *enableTaskMetrics {
+	if c.enableTaskMetrics {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -295,7 +303,7 @@ func (c *systemdCollector) collectUnitStatusMetrics(conn *dbus.Conn, ch chan<- p
 				c.unitDesc, prometheus.GaugeValue, isActive,
 				unit.Name, stateName, serviceType)
 		}
-		if *enableRestartsMetrics && strings.HasSuffix(unit.Name, ".service") {
+		if c.enableRestartsMetrics && strings.HasSuffix(unit.Name, ".service") {
 			// NRestarts wasn't added until systemd 235.
 			restartsCount, err := conn.GetUnitTypePropertyContext(context.TODO(), unit.Name, "Service", "NRestarts")
 			if err != nil {
@@ -434,8 +442,8 @@ func (c *systemdCollector) collectSystemState(conn *dbus.Conn, ch chan<- prometh
 	return nil
 }
 
-func newSystemdDbusConn() (*dbus.Conn, error) {
-	if *systemdPrivate {
+func newSystemdDbusConn(private bool) (*dbus.Conn, error) {
+	if private {
 		return dbus.NewSystemdConnectionContext(context.TODO())
 	}
 	return dbus.NewWithContext(context.TODO())
@@ -60,6 +60,7 @@ const (
 
 type tcpStatCollector struct {
 	desc   typedDesc
+	paths  Paths
 	logger log.Logger
 }
 
@@ -75,6 +76,7 @@ func NewTCPStatCollector(logger log.Logger) (Collector, error) {
 			"Number of connection states.",
 			[]string{"state"}, nil,
 		), prometheus.GaugeValue},
+		paths:  currentPaths(),
 		logger: logger,
 	}, nil
 }
@@ -135,7 +137,7 @@ func (c *tcpStatCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 
 	// if enabled ipv6 system
-	if _, hasIPv6 := os.Stat(procFilePath("net/tcp6")); hasIPv6 == nil {
+	if _, hasIPv6 := os.Stat(c.paths.procFilePath("net/tcp6")); hasIPv6 == nil {
 		tcp6Stats, err := getTCPStats(syscall.AF_INET6)
 		if err != nil {
 			return fmt.Errorf("couldn't get tcp6stats: %w", err)
@@ -17,11 +17,18 @@
 package collector
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
@@ -30,25 +37,122 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
-	textFileDirectory = kingpin.Flag("collector.textfile.directory", "Directory to read text files with metrics from.").Default("").String()
-	mtimeDesc         = prometheus.NewDesc(
+	textFileDirectory = kingpin.Flag(
+		"collector.textfile.directory",
+		"Directory to read text files with metrics from. Can be repeated.",
+	).Default("").Strings()
+	textFileDirectoryLabels = kingpin.Flag(
+		"collector.textfile.directory.label",
+		"Constant label added to the metrics of the text files in a directory, in the form <directory>:<label>=<value>, replacing the label of the same name in the files. Can be repeated.",
+	).Strings()
+	textFileRecursive = kingpin.Flag(
+		"collector.textfile.recursive",
+		"Also read text files in the subdirectories of the textfile directories.",
+	).Default("false").Bool()
+	textFileMaxFileSize = kingpin.Flag(
+		"collector.textfile.max-file-size",
+		"Maximum size of a text file. Larger files are skipped. 0 disables the limit.",
+	).Default("0").Bytes()
+	textFileMaxSeries = kingpin.Flag(
+		"collector.textfile.max-series",
+		"Maximum number of series in a text file. Files with more series are skipped. 0 disables the limit.",
+	).Default("0").Int()
+	textFileAllowedUIDs = kingpin.Flag(
+		"collector.textfile.allowed-uids",
+		"Only read text files owned by this user ID or one of the allowed group IDs. Can be repeated.",
+	).Uint32List()
+	textFileAllowedGIDs = kingpin.Flag(
+		"collector.textfile.allowed-gids",
+		"Only read text files owned by this group ID or one of the allowed user IDs. Can be repeated.",
+	).Uint32List()
+	textFileWatch = kingpin.Flag(
+		"collector.textfile.watch",
+		"Watch the textfile directories with inotify to only parse the text files which changed. Otherwise, or if inotify is unavailable, text files are parsed again once their stats changed.",
+	).Default("true").Bool()
+	textFileTimestamps = kingpin.Flag(
+		"collector.textfile.timestamps",
+		"Export the timestamps of samples in text files instead of skipping files containing timestamps.",
+	).Default("false").Bool()
+	textFileMaxAge = kingpin.Flag(
+		"collector.textfile.max-age",
+		"Maximum age of text files by modification time. Metrics of older files are skipped and the files reported by node_textfile_stale. 0 disables the limit.",
+	).Default("0s").Duration()
+	textFileMaxAgeOverrides = kingpin.Flag(
+		"collector.textfile.max-age.override",
+		"Maximum age of the text files matching a glob pattern, or in a directory matching it, in the form <pattern>=<duration>, overriding --collector.textfile.max-age. The last matching pattern wins. Can be repeated.",
+	).Strings()
+	mtimeDesc = prometheus.NewDesc(
 		"node_textfile_mtime_seconds",
 		"Unixtime mtime of textfiles successfully read.",
 		[]string{"file"},
 		nil,
 	)
+	parsesDesc = prometheus.NewDesc(
+		"node_textfile_parses_total",
+		"Number of text files parsed.",
+		nil, nil,
+	)
+	cacheHitsDesc = prometheus.NewDesc(
+		"node_textfile_cache_hits_total",
+		"Number of text files whose metrics were reused instead of parsing the unchanged files.",
+		nil, nil,
+	)
+	staleDesc = prometheus.NewDesc(
+		"node_textfile_stale",
+		"1 if the textfile is older than its maximum age and its metrics were skipped, 0 otherwise. Only exported for textfiles with a maximum age.",
+		[]string{"file"},
+		nil,
+	)
 )
 
 type textFileCollector struct {
-	path string
+	directories []textFileDir
+	recursive   bool
+	// maxFileSize and maxSeries limit the size of a file, 0 if unlimited.
+	maxFileSize int64
+	maxSeries   int
+	// Files are only read if owned by one of the allowedUIDs or
+	// allowedGIDs, unless both are empty.
+	allowedUIDs []uint32
+	allowedGIDs []uint32
+	// scripts are run on scrape, reusing their output for scriptCache.
+	scripts         []*textFileScript
+	scriptTimeout   time.Duration
+	scriptMaxOutput int64
+	scriptCache     time.Duration
+	// timestamps enables the export of sample timestamps.
+	timestamps bool
+	maxAge     time.Duration
+	// maxAges override maxAge for the files matching their pattern.
+	maxAges []textFileAgeLimit
+	// cache keeps the results of processing the text files, if not nil.
+	cache     *textFileCache
+	parses    atomic.Uint64
+	cacheHits atomic.Uint64
 	// Only set for testing to get predictable output.
 	mtime  *float64
+	now    func() time.Time
 	logger log.Logger
 }
 
+// textFileDir is a directory, or glob pattern of directories, to read
+// textfiles from, and the labels added to their metrics.
+type textFileDir struct {
+	path   string
+	labels []*dto.LabelPair
+}
+
+// textFileAgeLimit is the maximum age of the textfiles matching pattern.
+type textFileAgeLimit struct {
+	pattern string
+	maxAge  time.Duration
+}
+
 func init() {
 	registerCollector("textfile", defaultEnabled, NewTextFileCollector)
 }
@@ -56,13 +160,140 @@ func init() {
 // NewTextFileCollector returns a new Collector exposing metrics read from files
 // in the given textfile directory.
 func NewTextFileCollector(logger log.Logger) (Collector, error) {
+	if *textFileMaxAge < 0 {
+		return nil, fmt.Errorf("invalid textfile max age %s: must not be negative", *textFileMaxAge)
+	}
+	if *textFileMaxSeries < 0 {
+		return nil, fmt.Errorf("invalid textfile max series %d: must not be negative", *textFileMaxSeries)
+	}
+	if (len(*textFileAllowedUIDs) > 0 || len(*textFileAllowedGIDs) > 0) && !fileOwnerSupported {
+		return nil, errors.New("textfile ownership rules are not supported on this platform")
+	}
+	maxAges, err := parseTextFileMaxAges(*textFileMaxAgeOverrides)
+	if err != nil {
+		return nil, err
+	}
+	directories, err := parseTextFileDirectories(*textFileDirectory, *textFileDirectoryLabels)
+	if err != nil {
+		return nil, err
+	}
+	if *textFileScriptTimeout < 0 {
+		return nil, fmt.Errorf("invalid textfile script timeout %s: must not be negative", *textFileScriptTimeout)
+	}
+	if *textFileScriptCache < 0 {
+		return nil, fmt.Errorf("invalid textfile script cache duration %s: must not be negative", *textFileScriptCache)
+	}
+	scripts, err := parseTextFileScripts(*textFileScripts)
+	if err != nil {
+		return nil, err
+	}
 	c := &textFileCollector{
-		path:   *textFileDirectory,
-		logger: logger,
+		directories: directories,
+		recursive:   *textFileRecursive,
+		maxFileSize: int64(*textFileMaxFileSize),
+		maxSeries:   *textFileMaxSeries,
+		allowedUIDs: *textFileAllowedUIDs,
+		allowedGIDs: *textFileAllowedGIDs,
+
+		scripts:         scripts,
+		scriptTimeout:   *textFileScriptTimeout,
+		scriptMaxOutput: int64(*textFileScriptMaxOutput),
+		scriptCache:     *textFileScriptCache,
+
+		timestamps: *textFileTimestamps,
+		maxAge:     *textFileMaxAge,
+		maxAges:    maxAges,
+		cache:      newTextFileCache(*textFileWatch, logger),
+		now:        time.Now,
+		logger:     logger,
 	}
 	return c, nil
 }
 
+// Close stops watching the textfile directories.
+func (c *textFileCollector) Close() error {
+	if c.cache == nil {
+		return nil
+	}
+	return c.cache.Close()
+}
+
+// parseTextFileDirectories returns the textfile directories with the labels
+// of the <directory>:<label>=<value> settings.
+func parseTextFileDirectories(paths, settings []string) ([]textFileDir, error) {
+	directories := make([]textFileDir, len(paths))
+	for i, path := range paths {
+		directories[i].path = path
+	}
+	for _, setting := range settings {
+		eq := strings.Index(setting, "=")
+		colon := -1
+		if eq > 0 {
+			colon = strings.LastIndex(setting[:eq], ":")
+		}
+		if colon <= 0 {
+			return nil, fmt.Errorf("invalid textfile directory label %q: expected <directory>:<label>=<value>", setting)
+		}
+		path, name, value := setting[:colon], setting[colon+1:eq], setting[eq+1:]
+		if !model.LabelName(name).IsValid() {
+			return nil, fmt.Errorf("invalid textfile directory label %q: invalid label name %q", setting, name)
+		}
+		found := false
+		for i := range directories {
+			if filepath.Clean(directories[i].path) != filepath.Clean(path) {
+				continue
+			}
+			found = true
+			labels := directories[i].labels
+			labels = slices.DeleteFunc(labels, func(l *dto.LabelPair) bool { return l.GetName() == name })
+			directories[i].labels = append(labels, &dto.LabelPair{Name: &name, Value: &value})
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid textfile directory label %q: %q is not a textfile directory", setting, path)
+		}
+	}
+	return directories, nil
+}
+
+// parseTextFileMaxAges parses the <pattern>=<duration> overrides of the
+// maximum age.
+func parseTextFileMaxAges(overrides []string) ([]textFileAgeLimit, error) {
+	var maxAges []textFileAgeLimit
+	for _, override := range overrides {
+		i := strings.LastIndex(override, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid textfile max age override %q: expected <pattern>=<duration>", override)
+		}
+		pattern := override[:i]
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid textfile max age override %q: %w", override, err)
+		}
+		maxAge, err := time.ParseDuration(override[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid textfile max age override %q: %w", override, err)
+		}
+		if maxAge < 0 {
+			return nil, fmt.Errorf("invalid textfile max age override %q: must not be negative", override)
+		}
+		maxAges = append(maxAges, textFileAgeLimit{pattern, maxAge})
+	}
+	return maxAges, nil
+}
+
+// maxAgeOf returns the maximum age of the textfile at path.
+func (c *textFileCollector) maxAgeOf(path string) time.Duration {
+	maxAge := c.maxAge
+	dir := filepath.Dir(path)
+	for _, m := range c.maxAges {
+		if ok, _ := filepath.Match(m.pattern, path); ok {
+			maxAge = m.maxAge
+		} else if ok, _ := filepath.Match(m.pattern, filepath.Clean(dir)); ok {
+			maxAge = m.maxAge
+		}
+	}
+	return maxAge
+}
+
 func convertMetricFamily(metricFamily *dto.MetricFamily, ch chan<- prometheus.Metric, logger log.Logger) {
 	var valType prometheus.ValueType
 	var val float64
@@ -78,10 +309,6 @@ func convertMetricFamily(metricFamily *dto.MetricFamily, ch chan<- prometheus.Me
 	}
 
 	for _, metric := range metricFamily.Metric {
-		if metric.TimestampMs != nil {
-			level.Warn(logger).Log("msg", "Ignoring unsupported custom timestamp on textfile collector metric", "metric", metric)
-		}
-
 		labels := metric.GetLabel()
 		var names []string
 		var values []string
@@ -104,6 +331,7 @@ func convertMetricFamily(metricFamily *dto.MetricFamily, ch chan<- prometheus.Me
 			}
 		}
 
+		var m prometheus.Metric
 		metricType := metricFamily.GetType()
 		switch metricType {
 		case dto.MetricType_COUNTER:
@@ -123,7 +351,7 @@ func convertMetricFamily(metricFamily *dto.MetricFamily, ch chan<- prometheus.Me
 			for _, q := range metric.Summary.Quantile {
 				quantiles[q.GetQuantile()] = q.GetValue()
 			}
-			ch <- prometheus.MustNewConstSummary(
+			m = prometheus.MustNewConstSummary(
 				prometheus.NewDesc(
 					*metricFamily.Name,
 					metricFamily.GetHelp(),
@@ -134,11 +362,22 @@ func convertMetricFamily(metricFamily *dto.MetricFamily, ch chan<- prometheus.Me
 				quantiles, values...,
 			)
 		case dto.MetricType_HISTOGRAM:
+			if isNativeHistogram(metric.Histogram) {
+				m = newNativeHistogram(
+					prometheus.NewDesc(
+						*metricFamily.Name,
+						metricFamily.GetHelp(),
+						names, nil,
+					),
+					metric.Histogram, values...,
+				)
+				break
+			}
 			buckets := map[float64]uint64{}
 			for _, b := range metric.Histogram.Bucket {
 				buckets[b.GetUpperBound()] = b.GetCumulativeCount()
 			}
-			ch <- prometheus.MustNewConstHistogram(
+			m = prometheus.MustNewConstHistogram(
 				prometheus.NewDesc(
 					*metricFamily.Name,
 					metricFamily.GetHelp(),
@@ -152,7 +391,7 @@ func convertMetricFamily(metricFamily *dto.MetricFamily, ch chan<- prometheus.Me
 			panic("unknown metric type")
 		}
 		if metricType == dto.MetricType_GAUGE || metricType == dto.MetricType_COUNTER || metricType == dto.MetricType_UNTYPED {
-			ch <- prometheus.MustNewConstMetric(
+			m = prometheus.MustNewConstMetric(
 				prometheus.NewDesc(
 					*metricFamily.Name,
 					metricFamily.GetHelp(),
@@ -161,6 +400,11 @@ func convertMetricFamily(metricFamily *dto.MetricFamily, ch chan<- prometheus.Me
 				valType, val, values...,
 			)
 		}
+		// Files with timestamps are only read if they are enabled.
+		if metric.TimestampMs != nil {
+			m = prometheus.NewMetricWithTimestamp(time.UnixMilli(metric.GetTimestampMs()), m)
+		}
+		ch <- m
 	}
 }
 
@@ -186,8 +430,30 @@ func (c *textFileCollector) exportMTimes(mtimes map[string]time.Time, ch chan<-
 	}
 }
 
+func (c *textFileCollector) exportStale(stale map[string]bool, ch chan<- prometheus.Metric) {
+	filepaths := make([]string, 0, len(stale))
+	for path := range stale {
+		filepaths = append(filepaths, path)
+	}
+	sort.Strings(filepaths)
+
+	for _, path := range filepaths {
+		var v float64
+		if stale[path] {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(staleDesc, prometheus.GaugeValue, v, path)
+	}
+}
+
 // Update implements the Collector interface.
 func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
+	return c.UpdateContext(context.Background(), ch)
+}
+
+// UpdateContext reads the text files and runs the scripts, killing the
+// scripts once ctx is done.
+func (c *textFileCollector) UpdateContext(ctx context.Context, ch chan<- prometheus.Metric) error {
 	// Iterate over files and accumulate their metrics, but also track any
 	// parsing errors so an error metric can be reported.
 	var errored bool
@@ -195,65 +461,95 @@ func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
 	metricsNamesToFiles := map[string][]string{}
 	metricsNamesToHelpTexts := map[string][2]string{}
 
-	paths, err := filepath.Glob(c.path)
-	if err != nil || len(paths) == 0 {
-		// not glob or not accessible path either way assume single
-		// directory and let os.ReadDir handle it
-		paths = []string{c.path}
+	addFamilies := func(source string, families map[string]*dto.MetricFamily) {
+		for _, mf := range families {
+			// Check for metrics with inconsistent help texts and take the first help text occurrence.
+			if helpTexts, seen := metricsNamesToHelpTexts[*mf.Name]; seen {
+				if mf.Help != nil && helpTexts[0] != *mf.Help || helpTexts[1] != "" {
+					metricsNamesToHelpTexts[*mf.Name] = [2]string{helpTexts[0], *mf.Help}
+					errored = true
+					level.Error(c.logger).Log("msg", "inconsistent metric help text",
+						"metric", *mf.Name,
+						"original_help_text", helpTexts[0],
+						"new_help_text", *mf.Help,
+						// Only the first file path will be recorded in case of two or more inconsistent help texts.
+						"file", metricsNamesToFiles[*mf.Name][0])
+					continue
+				}
+			}
+			if mf.Help != nil {
+				metricsNamesToHelpTexts[*mf.Name] = [2]string{*mf.Help}
+			}
+			metricsNamesToFiles[*mf.Name] = append(metricsNamesToFiles[*mf.Name], source)
+			parsedFamilies = append(parsedFamilies, mf)
+		}
 	}
 
 	mtimes := make(map[string]time.Time)
-	for _, path := range paths {
-		files, err := os.ReadDir(path)
-		if err != nil && path != "" {
-			errored = true
-			level.Error(c.logger).Log("msg", "failed to read textfile collector directory", "path", path, "err", err)
+	stale := make(map[string]bool)
+	seen := make(map[textFileCacheKey]bool)
+	for i, dir := range c.directories {
+		paths, err := filepath.Glob(dir.path)
+		if err != nil || len(paths) == 0 {
+			// not glob or not accessible path either way assume single
+			// directory and let os.ReadDir handle it
+			paths = []string{dir.path}
 		}
 
-		for _, f := range files {
-			metricsFilePath := filepath.Join(path, f.Name())
-			if !strings.HasSuffix(f.Name(), ".prom") {
-				continue
+		for _, path := range paths {
+			files, err := c.listFiles(path)
+			if err != nil && path != "" {
+				errored = true
+				level.Error(c.logger).Log("msg", "failed to read textfile collector directory", "path", path, "err", err)
 			}
 
-			mtime, families, err := c.processFile(path, f.Name(), ch)
-
-			for _, mf := range families {
-				// Check for metrics with inconsistent help texts and take the first help text occurrence.
-				if helpTexts, seen := metricsNamesToHelpTexts[*mf.Name]; seen {
-					if mf.Help != nil && helpTexts[0] != *mf.Help || helpTexts[1] != "" {
-						metricsNamesToHelpTexts[*mf.Name] = [2]string{helpTexts[0], *mf.Help}
-						errored = true
-						level.Error(c.logger).Log("msg", "inconsistent metric help text",
-							"metric", *mf.Name,
-							"original_help_text", helpTexts[0],
-							"new_help_text", *mf.Help,
-							// Only the first file path will be recorded in case of two or more inconsistent help texts.
-							"file", metricsNamesToFiles[*mf.Name][0])
+			for _, name := range files {
+				metricsFilePath := filepath.Join(path, name)
+				key := textFileCacheKey{dir: i, path: metricsFilePath}
+				seen[key] = true
+				mtime, families, err := c.readFile(key, dir.labels)
+
+				if maxAge := c.maxAgeOf(metricsFilePath); err == nil && maxAge > 0 {
+					stale[metricsFilePath] = c.now().Sub(*mtime) > maxAge
+					if stale[metricsFilePath] {
+						level.Debug(c.logger).Log("msg", "skipping stale textfile", "file", metricsFilePath, "mtime", *mtime, "max_age", maxAge)
 						continue
 					}
 				}
-				if mf.Help != nil {
-					metricsNamesToHelpTexts[*mf.Name] = [2]string{*mf.Help}
+
+				addFamilies(metricsFilePath, families)
+
+				if err != nil {
+					errored = true
+					level.Error(c.logger).Log("msg", "failed to collect textfile data", "file", name, "err", err)
+					continue
 				}
-				metricsNamesToFiles[*mf.Name] = append(metricsNamesToFiles[*mf.Name], metricsFilePath)
-				parsedFamilies = append(parsedFamilies, mf)
-			}
 
-			if err != nil {
-				errored = true
-				level.Error(c.logger).Log("msg", "failed to collect textfile data", "file", f.Name(), "err", err)
-				continue
+				mtimes[metricsFilePath] = *mtime
 			}
+		}
+	}
 
-			mtimes[metricsFilePath] = *mtime
+	if c.cache != nil {
+		c.cache.prune(seen)
+	}
+
+	scriptFamilies, scriptErrs := c.runScripts(ctx)
+	for i, s := range c.scripts {
+		if err := scriptErrs[i]; err != nil {
+			errored = true
+			level.Error(c.logger).Log("msg", "failed to collect textfile script data", "script", s.name, "err", err)
+			continue
 		}
+		addFamilies("script "+s.name, scriptFamilies[i])
 	}
 
-	for _, mf := range parsedFamilies {
+	for i, mf := range parsedFamilies {
 		if mf.Help == nil {
+			// The families may be cached, so they are copied rather than
+			// modified.
 			help := fmt.Sprintf("Metric read from %s", strings.Join(metricsNamesToFiles[*mf.Name], ", "))
-			mf.Help = &help
+			parsedFamilies[i] = &dto.MetricFamily{Name: mf.Name, Help: &help, Type: mf.Type, Metric: mf.Metric}
 		}
 	}
 
@@ -262,6 +558,12 @@ func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 
 	c.exportMTimes(mtimes, ch)
+	c.exportStale(stale, ch)
+	c.exportScripts(ch)
+	if c.cache != nil {
+		ch <- prometheus.MustNewConstMetric(parsesDesc, prometheus.CounterValue, float64(c.parses.Load()))
+		ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(c.cacheHits.Load()))
+	}
 
 	// Export if there were errors.
 	var errVal float64
@@ -281,28 +583,138 @@ func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
 	return nil
 }
 
-// processFile processes a single file, returning its modification time on success.
-func (c *textFileCollector) processFile(dir, name string, ch chan<- prometheus.Metric) (*time.Time, map[string]*dto.MetricFamily, error) {
-	path := filepath.Join(dir, name)
+// isTextFile returns true for the names of text files and protobuf files.
+func isTextFile(name string) bool {
+	return strings.HasSuffix(name, ".prom") || strings.HasSuffix(name, ".pb")
+}
+
+// listFiles returns the paths of the *.prom and *.pb files in dir relative to it,
+// including its subdirectories if enabled. Unreadable subdirectories are
+// skipped and reported in the error.
+func (c *textFileCollector) listFiles(dir string) ([]string, error) {
+	if !c.recursive {
+		c.watchDir(dir)
+		entries, err := os.ReadDir(dir)
+		var files []string
+		for _, e := range entries {
+			if isTextFile(e.Name()) && !e.IsDir() {
+				files = append(files, e.Name())
+			}
+		}
+		return files, err
+	}
+
+	var (
+		files []string
+		errs  []error
+	)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			errs = append(errs, err)
+			return nil
+		}
+		if d.IsDir() {
+			// Watch the directory before it is read.
+			c.watchDir(path)
+			return nil
+		}
+		if !isTextFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, errors.Join(append(errs, err)...)
+}
+
+// watchDir watches a directory for changes of the cached text files.
+func (c *textFileCollector) watchDir(dir string) {
+	if c.cache != nil {
+		c.cache.watch(dir)
+	}
+}
+
+// readFile returns the cached result of processing a text file, or
+// processes it if it changed.
+func (c *textFileCollector) readFile(key textFileCacheKey, labels []*dto.LabelPair) (*time.Time, map[string]*dto.MetricFamily, error) {
+	if c.cache == nil {
+		c.parses.Add(1)
+		return c.processFile(key.path, labels)
+	}
+	entry, ok := c.cache.lookup(key)
+	if ok {
+		c.cacheHits.Add(1)
+		return entry.mtime, entry.families, entry.err
+	}
+	c.parses.Add(1)
+	entry.mtime, entry.families, entry.err = c.processFile(key.path, labels)
+	c.cache.store(key, entry)
+	return entry.mtime, entry.families, entry.err
+}
+
+// processFile processes a single file, returning its modification time on
+// success. The labels are added to all its metrics, replacing the labels of
+// the same names.
+func (c *textFileCollector) processFile(path string, labels []*dto.LabelPair) (*time.Time, map[string]*dto.MetricFamily, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open textfile data file %q: %w", path, err)
 	}
 	defer f.Close()
 
-	var parser expfmt.TextParser
-	families, err := parser.TextToMetricFamilies(f)
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat %q: %w", path, err)
+	}
+	if err := c.checkOwner(stat); err != nil {
+		return nil, nil, fmt.Errorf("textfile %q: %w", path, err)
+	}
+
+	var r io.Reader = f
+	if c.maxFileSize > 0 {
+		// The size is checked while reading, as the file may grow.
+		r = io.LimitReader(f, c.maxFileSize+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read textfile data file %q: %w", path, err)
+	}
+	if c.maxFileSize > 0 && int64(len(data)) > c.maxFileSize {
+		return nil, nil, fmt.Errorf("textfile %q is larger than the maximum file size of %d bytes, skipping entire file", path, c.maxFileSize)
+	}
+
+	var families map[string]*dto.MetricFamily
+	if strings.HasSuffix(path, ".pb") {
+		families, err = parseTextFileProto(data)
+	} else {
+		families, err = parseTextFileData(data)
+	}
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to parse textfile data from %q: %w", path, err)
 	}
 
-	if hasTimestamps(families) {
-		return nil, nil, fmt.Errorf("textfile %q contains unsupported client-side timestamps, skipping entire file", path)
+	if err := c.checkFamilies(fmt.Sprintf("textfile %q", path), families); err != nil {
+		return nil, nil, err
+	}
+
+	if len(labels) > 0 {
+		for _, mf := range families {
+			for _, m := range mf.Metric {
+				m.Label = withLabels(m.Label, labels)
+			}
+		}
 	}
 
 	// Only stat the file once it has been parsed and validated, so that
 	// a failure does not appear fresh.
-	stat, err := f.Stat()
+	stat, err = f.Stat()
 	if err != nil {
 		return nil, families, fmt.Errorf("failed to stat %q: %w", path, err)
 	}
@@ -311,6 +723,163 @@ func (c *textFileCollector) processFile(dir, name string, ch chan<- prometheus.M
 	return &t, families, nil
 }
 
+// nativeHistogram is a histogram read from a protobuf file, which may have
+// native buckets the constant histograms don't support.
+type nativeHistogram struct {
+	desc      *prometheus.Desc
+	histogram *dto.Histogram
+	labels    []*dto.LabelPair
+}
+
+func newNativeHistogram(desc *prometheus.Desc, histogram *dto.Histogram, labelValues ...string) prometheus.Metric {
+	return &nativeHistogram{
+		desc:      desc,
+		histogram: histogram,
+		labels:    prometheus.MakeLabelPairs(desc, labelValues),
+	}
+}
+
+func (h *nativeHistogram) Desc() *prometheus.Desc {
+	return h.desc
+}
+
+func (h *nativeHistogram) Write(m *dto.Metric) error {
+	m.Label = h.labels
+	m.Histogram = proto.Clone(h.histogram).(*dto.Histogram)
+	return nil
+}
+
+// isNativeHistogram returns true if a histogram has a native bucket schema.
+func isNativeHistogram(h *dto.Histogram) bool {
+	return h.Schema != nil || h.ZeroThreshold != nil || len(h.PositiveSpan) > 0 || len(h.NegativeSpan) > 0
+}
+
+// parseTextFileData parses metrics in the text format or, if terminated by
+// an EOF marker, OpenMetrics.
+func parseTextFileData(data []byte) (map[string]*dto.MetricFamily, error) {
+	if isOpenMetrics(data) {
+		var err error
+		if data, err = openMetricsToText(data); err != nil {
+			return nil, err
+		}
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(bytes.NewReader(data))
+}
+
+// parseTextFileProto parses length-delimited protobuf metric families, the
+// only format supporting native histograms. Gauge histograms are read as
+// histograms.
+func parseTextFileProto(data []byte) (map[string]*dto.MetricFamily, error) {
+	families := make(map[string]*dto.MetricFamily)
+	dec := expfmt.NewDecoder(bytes.NewReader(data), expfmt.NewFormat(expfmt.TypeProtoDelim))
+	for {
+		mf := &dto.MetricFamily{}
+		if err := dec.Decode(mf); err == io.EOF {
+			return families, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if _, ok := families[mf.GetName()]; ok {
+			return nil, fmt.Errorf("duplicate metric family %q", mf.GetName())
+		}
+		if mf.GetType() == dto.MetricType_GAUGE_HISTOGRAM {
+			mf.Type = dto.MetricType_HISTOGRAM.Enum()
+		}
+		for _, m := range mf.Metric {
+			if err := checkProtoMetric(mf.GetType(), m); err != nil {
+				return nil, fmt.Errorf("metric family %q: %w", mf.GetName(), err)
+			}
+		}
+		families[mf.GetName()] = mf
+	}
+}
+
+// checkProtoMetric returns an error if a decoded metric lacks the value of
+// its type.
+func checkProtoMetric(typ dto.MetricType, m *dto.Metric) error {
+	if m == nil {
+		return errors.New("empty metric")
+	}
+	for _, l := range m.Label {
+		if l == nil {
+			return errors.New("empty label")
+		}
+	}
+	var ok bool
+	switch typ {
+	case dto.MetricType_COUNTER:
+		ok = m.Counter != nil
+	case dto.MetricType_GAUGE:
+		ok = m.Gauge != nil
+	case dto.MetricType_UNTYPED:
+		ok = m.Untyped != nil
+	case dto.MetricType_SUMMARY:
+		ok = m.Summary != nil
+	case dto.MetricType_HISTOGRAM:
+		ok = m.Histogram != nil
+	default:
+		return fmt.Errorf("unsupported metric type %s", typ)
+	}
+	if !ok {
+		return fmt.Errorf("metric without %s value", strings.ToLower(typ.String()))
+	}
+	return nil
+}
+
+// checkFamilies returns an error if the families read from source have
+// timestamps while they are not enabled, or too many series.
+func (c *textFileCollector) checkFamilies(source string, families map[string]*dto.MetricFamily) error {
+	if !c.timestamps && hasTimestamps(families) {
+		return fmt.Errorf("%s contains client-side timestamps, which are not enabled, skipping entire file", source)
+	}
+
+	if c.maxSeries > 0 {
+		var series int
+		for _, mf := range families {
+			series += len(mf.Metric)
+		}
+		if series > c.maxSeries {
+			return fmt.Errorf("%s contains %d series, more than the maximum of %d, skipping entire file", source, series, c.maxSeries)
+		}
+	}
+	return nil
+}
+
+// withLabels returns pairs with labels added, replacing the pairs of the
+// same names.
+func withLabels(pairs, labels []*dto.LabelPair) []*dto.LabelPair {
+	result := make([]*dto.LabelPair, 0, len(pairs)+len(labels))
+	for _, p := range pairs {
+		replaced := false
+		for _, l := range labels {
+			if p.GetName() == l.GetName() {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			result = append(result, p)
+		}
+	}
+	return append(result, labels...)
+}
+
+// checkOwner returns an error if the owner of a file isn't allowed.
+func (c *textFileCollector) checkOwner(stat os.FileInfo) error {
+	if len(c.allowedUIDs) == 0 && len(c.allowedGIDs) == 0 {
+		return nil
+	}
+	uid, gid, ok := fileOwner(stat)
+	if !ok {
+		return errors.New("couldn't determine the owner")
+	}
+	if slices.Contains(c.allowedUIDs, uid) || slices.Contains(c.allowedGIDs, gid) {
+		return nil
+	}
+	return fmt.Errorf("owned by uid %d and gid %d, which are not allowed, skipping entire file", uid, gid)
+}
+
 // hasTimestamps returns true when metrics contain unsupported timestamps.
 func hasTimestamps(parsedFamilies map[string]*dto.MetricFamily) bool {
 	for _, mf := range parsedFamilies {
@@ -0,0 +1,203 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notextfile
+// +build !notextfile
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// textFileWatcher reports the changes of the files in the directories it
+// watches.
+type textFileWatcher interface {
+	add(dir string) error
+	Close() error
+}
+
+// textFileCacheKey identifies a text file read from one of the textfile
+// directories, as the directories add different labels.
+type textFileCacheKey struct {
+	dir  int
+	path string
+}
+
+// textFileCacheEntry is the result of processing a text file.
+type textFileCacheEntry struct {
+	// epoch and version are those of the cache and file when the file was
+	// read, stat its stat if its directory wasn't watched.
+	epoch   uint64
+	version uint64
+	stat    os.FileInfo
+
+	mtime    *time.Time
+	families map[string]*dto.MetricFamily
+	err      error
+}
+
+// textFileCache keeps the results of processing text files, so that files
+// are only parsed again once they changed. Changes are reported by a
+// watcher if available, and detected by comparing the stats of the files in
+// directories not watched.
+type textFileCache struct {
+	watcher textFileWatcher
+	logger  log.Logger
+
+	mtx     sync.Mutex
+	entries map[textFileCacheKey]*textFileCacheEntry
+	// versions are incremented on changes of the files, epoch when all
+	// entries are invalidated.
+	versions map[string]uint64
+	epoch    uint64
+	watched  map[string]bool
+}
+
+// newTextFileCache creates a cache, watching the directories if watch is
+// set and watching is supported.
+func newTextFileCache(watch bool, logger log.Logger) *textFileCache {
+	c := &textFileCache{
+		logger:   logger,
+		entries:  make(map[textFileCacheKey]*textFileCacheEntry),
+		versions: make(map[string]uint64),
+		watched:  make(map[string]bool),
+	}
+	if !watch {
+		return c
+	}
+	watcher, err := newTextFileWatcher(c.changed, c.reset, logger)
+	if err != nil {
+		level.Info(logger).Log("msg", "failed to watch textfile directories, comparing file stats instead", "err", err)
+		return c
+	}
+	c.watcher = watcher
+	return c
+}
+
+// watch starts watching dir, unless already watched.
+func (c *textFileCache) watch(dir string) {
+	if c.watcher == nil {
+		return
+	}
+	dir = filepath.Clean(dir)
+	c.mtx.Lock()
+	watched := c.watched[dir]
+	c.mtx.Unlock()
+	if watched {
+		return
+	}
+	if err := c.watcher.add(dir); err != nil {
+		level.Debug(c.logger).Log("msg", "failed to watch textfile directory, comparing file stats instead", "dir", dir, "err", err)
+		return
+	}
+	c.mtx.Lock()
+	c.watched[dir] = true
+	c.mtx.Unlock()
+}
+
+// changed invalidates the entries of the file at path.
+func (c *textFileCache) changed(path string) {
+	c.mtx.Lock()
+	c.versions[path]++
+	c.mtx.Unlock()
+}
+
+// reset invalidates all entries and forgets the watched directories, for
+// when changes may have been missed.
+func (c *textFileCache) reset() {
+	c.mtx.Lock()
+	c.epoch++
+	c.entries = make(map[textFileCacheKey]*textFileCacheEntry)
+	c.versions = make(map[string]uint64)
+	c.watched = make(map[string]bool)
+	c.mtx.Unlock()
+}
+
+// lookup returns the entry of a file and true if it is still valid. If not,
+// it returns a new entry to fill and store.
+func (c *textFileCache) lookup(key textFileCacheKey) (*textFileCacheEntry, bool) {
+	c.mtx.Lock()
+	current := &textFileCacheEntry{epoch: c.epoch, version: c.versions[key.path]}
+	watched := c.watched[filepath.Dir(key.path)]
+	entry := c.entries[key]
+	c.mtx.Unlock()
+
+	if !watched {
+		// Stat errors are reported when processing the file.
+		current.stat, _ = os.Stat(key.path)
+	}
+	if entry != nil && entry.epoch == current.epoch && entry.version == current.version &&
+		(watched || sameTextFile(entry.stat, current.stat)) {
+		return entry, true
+	}
+	return current, false
+}
+
+// store stores the entry of a file returned by lookup.
+func (c *textFileCache) store(key textFileCacheKey, entry *textFileCacheEntry) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if entry.epoch == c.epoch {
+		c.entries[key] = entry
+	}
+}
+
+// prune removes the entries of the files not in seen.
+func (c *textFileCache) prune(seen map[textFileCacheKey]bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	paths := make(map[string]bool)
+	for key := range c.entries {
+		if !seen[key] {
+			delete(c.entries, key)
+		}
+	}
+	for key := range seen {
+		paths[key.path] = true
+	}
+	for path := range c.versions {
+		if !paths[path] {
+			delete(c.versions, path)
+		}
+	}
+}
+
+// Close stops watching the directories.
+func (c *textFileCache) Close() error {
+	if c.watcher == nil {
+		return nil
+	}
+	return c.watcher.Close()
+}
+
+// sameTextFile returns true if the stats are of the same, unchanged file.
+// Files replaced by renaming another file over them are different files.
+func sameTextFile(a, b os.FileInfo) bool {
+	if a == nil || b == nil || !os.SameFile(a, b) {
+		return false
+	}
+	if !a.ModTime().Equal(b.ModTime()) || a.Size() != b.Size() || a.Mode() != b.Mode() {
+		return false
+	}
+	uidA, gidA, _ := fileOwner(a)
+	uidB, gidB, _ := fileOwner(b)
+	return uidA == uidB && gidA == gidB
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notextfile
+// +build !notextfile
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// compareTextfileCache compares the value of the metric a read from dir and
+// the parse and cache hit counts.
+func compareTextfileCache(t *testing.T, c *textFileCollector, dir string, value, parses, hits int) error {
+	want := fmt.Sprintf(`# HELP a Metric read from %s/a.prom
+# TYPE a untyped
+a %d
+# HELP node_textfile_cache_hits_total Number of text files whose metrics were reused instead of parsing the unchanged files.
+# TYPE node_textfile_cache_hits_total counter
+node_textfile_cache_hits_total %d
+# HELP node_textfile_parses_total Number of text files parsed.
+# TYPE node_textfile_parses_total counter
+node_textfile_parses_total %d
+`, dir, value, hits, parses)
+	return testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), "a", "node_textfile_cache_hits_total", "node_textfile_parses_total")
+}
+
+// writeTextfile replaces the text file at path the way jobs do, by renaming
+// a new file into place.
+func writeTextfile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path+".tmp", []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTextfileCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.prom")
+	writeTextfile(t, path, "a 1\n")
+
+	c := &textFileCollector{
+		directories: []textFileDir{{path: dir}},
+		cache:       newTextFileCache(false, log.NewNopLogger()),
+		logger:      log.NewNopLogger(),
+	}
+	if err := compareTextfileCache(t, c, dir, 1, 1, 0); err != nil {
+		t.Error(err)
+	}
+	if err := compareTextfileCache(t, c, dir, 1, 1, 1); err != nil {
+		t.Error(err)
+	}
+
+	writeTextfile(t, path, "a 2\n")
+	if err := compareTextfileCache(t, c, dir, 2, 2, 1); err != nil {
+		t.Error(err)
+	}
+
+	// Files written in place are parsed again once their mtime changed.
+	if err := os.WriteFile(path, []byte("a 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := compareTextfileCache(t, c, dir, 3, 3, 1); err != nil {
+		t.Error(err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Update(make(chan prometheus.Metric, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.cache.entries) != 0 {
+		t.Errorf("want entries of removed files pruned, got %v", c.cache.entries)
+	}
+}
+
+func TestTextfileCacheWatch(t *testing.T) {
+	cache := newTextFileCache(true, log.NewNopLogger())
+	if cache.watcher == nil {
+		t.Skip("watching directories is not supported")
+	}
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(sub, "a.prom")
+	writeTextfile(t, path, "a 1\n")
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &textFileCollector{
+		directories: []textFileDir{{path: dir}},
+		recursive:   true,
+		cache:       cache,
+		logger:      log.NewNopLogger(),
+	}
+	defer c.Close()
+	if err := compareTextfileCache(t, c, sub, 1, 1, 0); err != nil {
+		t.Error(err)
+	}
+	if !cache.watched[dir] || !cache.watched[sub] {
+		t.Fatalf("want %s and %s watched, got %v", dir, sub, cache.watched)
+	}
+	if err := compareTextfileCache(t, c, sub, 1, 1, 1); err != nil {
+		t.Error(err)
+	}
+
+	// Changes are detected even if the stat of the file is the same.
+	if err := os.WriteFile(path, []byte("a 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, stat.ModTime(), stat.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	waitTextfileCache(t, c, sub, 2)
+
+	writeTextfile(t, path, "a 3\n")
+	waitTextfileCache(t, c, sub, 3)
+
+	// Once closed, the stats of the files are compared.
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cache.mtx.Lock()
+		watched := len(cache.watched)
+		cache.mtx.Unlock()
+		if watched == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("directories still watched after closing")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	parses, hits := int(c.parses.Load()), int(c.cacheHits.Load())
+	if err := compareTextfileCache(t, c, sub, 3, parses+1, hits); err != nil {
+		t.Error(err)
+	}
+	if err := compareTextfileCache(t, c, sub, 3, parses+1, hits+1); err != nil {
+		t.Error(err)
+	}
+}
+
+// waitTextfileCache waits for the change of the metric a read from dir to
+// be exported, and for the file to be cached again. A change may be
+// reported by several events, each causing the file to be parsed.
+func waitTextfileCache(t *testing.T, c *textFileCollector, dir string, value int) {
+	t.Helper()
+	want := fmt.Sprintf("# HELP a Metric read from %s/a.prom\n# TYPE a untyped\na %d\n", dir, value)
+	deadline := time.Now().Add(5 * time.Second)
+	parses := c.parses.Load()
+	for {
+		err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), "a")
+		if err == nil && c.parses.Load() > parses {
+			previous := c.parses.Load()
+			c.Update(make(chan prometheus.Metric, 100))
+			if c.parses.Load() == previous {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("change to %d not cached: %v", value, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notextfile
+// +build !notextfile
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// openMetricsEOF terminates OpenMetrics text, telling it apart from the
+// classic text format.
+const openMetricsEOF = "# EOF"
+
+// openMetricsTypes maps the OpenMetrics metric types to the types of the
+// text format.
+var openMetricsTypes = map[string]string{
+	"counter":        "counter",
+	"gauge":          "gauge",
+	"histogram":      "histogram",
+	"gaugehistogram": "histogram",
+	"summary":        "summary",
+	"info":           "gauge",
+	"stateset":       "gauge",
+	"unknown":        "untyped",
+}
+
+// isOpenMetrics returns true if data ends with the OpenMetrics EOF marker.
+func isOpenMetrics(data []byte) bool {
+	data = bytes.TrimRight(data, "\n")
+	return bytes.Equal(data, []byte(openMetricsEOF)) || bytes.HasSuffix(data, []byte("\n"+openMetricsEOF))
+}
+
+// openMetricsToText translates OpenMetrics text to the classic text format
+// the way Prometheus ingests it: counters get the _total suffix, info
+// families the _info suffix and gauge histograms become histograms, while
+// _created samples, units and exemplars are dropped. Info and stateset
+// families become gauges, and timestamps are converted to milliseconds.
+func openMetricsToText(data []byte) ([]byte, error) {
+	lines := strings.Split(string(data), "\n")
+
+	// Metadata may precede the TYPE of a family, so the types are read
+	// first to name the families.
+	types := make(map[string]string)
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) == 4 && fields[0] == "#" && fields[1] == "TYPE" {
+			types[fields[2]] = fields[3]
+		}
+	}
+
+	var (
+		out    strings.Builder
+		family string
+	)
+	for i, line := range lines {
+		if line == openMetricsEOF {
+			break
+		}
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.SplitN(line, " ", 4)
+			if len(fields) < 3 || fields[0] != "#" {
+				return nil, fmt.Errorf("line %d: invalid OpenMetrics comment %q", i+1, line)
+			}
+			family = fields[2]
+			typ, ok := types[family]
+			if !ok {
+				typ = "unknown"
+			}
+			textType, ok := openMetricsTypes[typ]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown OpenMetrics type %q", i+1, typ)
+			}
+			name := family
+			switch typ {
+			case "counter":
+				name += "_total"
+			case "info":
+				name += "_info"
+			}
+
+			switch fields[1] {
+			case "TYPE":
+				fmt.Fprintf(&out, "# TYPE %s %s\n", name, textType)
+			case "HELP":
+				var help string
+				if len(fields) == 4 {
+					help = unescapeOpenMetricsHelp(fields[3])
+				}
+				fmt.Fprintf(&out, "# HELP %s %s\n", name, help)
+			case "UNIT":
+			default:
+				return nil, fmt.Errorf("line %d: invalid OpenMetrics comment %q", i+1, line)
+			}
+			continue
+		}
+
+		sample, err := openMetricsSampleToText(line, family, types[family])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if sample != "" {
+			out.WriteString(sample)
+			out.WriteByte('\n')
+		}
+	}
+	return []byte(out.String()), nil
+}
+
+// openMetricsSampleToText translates a sample line of the family of type typ,
+// returning an empty string for dropped samples.
+func openMetricsSampleToText(line, family, typ string) (string, error) {
+	end := strings.IndexAny(line, "{ ")
+	if end <= 0 {
+		return "", fmt.Errorf("invalid OpenMetrics sample %q", line)
+	}
+	name := line[:end]
+	if line[end] == '{' {
+		n, err := openMetricsLabelsEnd(line[end:])
+		if err != nil {
+			return "", fmt.Errorf("invalid OpenMetrics sample %q: %w", line, err)
+		}
+		end += n
+	}
+	labels := line[len(name):end]
+
+	switch suffix := strings.TrimPrefix(name, family); {
+	case suffix == name:
+	case suffix == "_created" && typ != "gauge" && typ != "info" && typ != "stateset" && typ != "unknown":
+		return "", nil
+	case typ == "gaugehistogram" && suffix == "_gcount":
+		name = family + "_count"
+	case typ == "gaugehistogram" && suffix == "_gsum":
+		name = family + "_sum"
+	}
+
+	// Exemplars follow the value and the optional timestamp.
+	rest, _, _ := strings.Cut(line[end:], "#")
+	fields := strings.Fields(rest)
+	switch len(fields) {
+	case 1:
+		return name + labels + " " + fields[0], nil
+	case 2:
+		ts, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || math.IsNaN(ts) || math.IsInf(ts, 0) {
+			return "", fmt.Errorf("invalid OpenMetrics timestamp %q", fields[1])
+		}
+		return fmt.Sprintf("%s%s %s %d", name, labels, fields[0], int64(math.Round(ts*1000))), nil
+	default:
+		return "", fmt.Errorf("invalid OpenMetrics sample %q", line)
+	}
+}
+
+// openMetricsLabelsEnd returns the length of the label set s starts with.
+func openMetricsLabelsEnd(s string) (int, error) {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == '}':
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated label set")
+}
+
+// unescapeOpenMetricsHelp unescapes the double quotes of an OpenMetrics help
+// text, which the text format doesn't escape.
+func unescapeOpenMetricsHelp(help string) string {
+	var b strings.Builder
+	for i := 0; i < len(help); i++ {
+		if help[i] == '\\' && i+1 < len(help) {
+			i++
+			if help[i] != '"' {
+				b.WriteByte('\\')
+			}
+		}
+		b.WriteByte(help[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notextfile
+// +build !notextfile
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestOpenMetricsToText(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{
+			in:   "# EOF\n",
+			want: "",
+		},
+		{
+			in:   "# HELP a_seconds A \\\"quoted\\\" \\\\ help.\n# TYPE a_seconds gauge\n# UNIT a_seconds seconds\na_seconds{x=\"}\\\"#\"} 1 1700000000.123\n# EOF",
+			want: "# HELP a_seconds A \"quoted\" \\\\ help.\n# TYPE a_seconds gauge\na_seconds{x=\"}\\\"#\"} 1 1700000000123\n",
+		},
+		{
+			in:   "# TYPE a counter\na_total 1 # {id=\"1\"} 1\na_created 1e9\nb 1\n# EOF\n",
+			want: "# TYPE a_total counter\na_total 1\nb 1\n",
+		},
+	} {
+		got, err := openMetricsToText([]byte(test.in))
+		if err != nil {
+			t.Errorf("%q: %s", test.in, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%q: want %q, got %q", test.in, test.want, got)
+		}
+	}
+
+	for _, in := range []string{
+		"# TYPE a enum\n# EOF\n",
+		"# COMMENT\n# EOF\n",
+		"# INFO a b\n# EOF\n",
+		"a{x=\"1\" 1\n# EOF\n",
+		"a 1 now\n# EOF\n",
+		"a 1 1 1\n# EOF\n",
+	} {
+		if _, err := openMetricsToText([]byte(in)); err == nil {
+			t.Errorf("%q: want error", in)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notextfile
+// +build !notextfile
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	textFileScripts = kingpin.Flag(
+		"collector.textfile.script",
+		"Executable whose standard output is read as a text file, in the form <name>=<path> [<argument>...]. Can be repeated.",
+	).Strings()
+	textFileScriptTimeout = kingpin.Flag(
+		"collector.textfile.script.timeout",
+		"Maximum duration of a textfile script. The script is killed when exceeding it. 0 disables the timeout.",
+	).Default("30s").Duration()
+	textFileScriptMaxOutput = kingpin.Flag(
+		"collector.textfile.script.max-output",
+		"Maximum size of the output of a textfile script. Scripts writing more are considered failed. 0 disables the limit.",
+	).Default("1MB").Bytes()
+	textFileScriptCache = kingpin.Flag(
+		"collector.textfile.script.cache",
+		"Duration the output of a textfile script is reused for before running it again. 0 runs scripts on every scrape.",
+	).Default("0s").Duration()
+
+	scriptDurationDesc = prometheus.NewDesc(
+		"node_textfile_script_duration_seconds",
+		"Duration of the last run of the textfile script.",
+		[]string{"script"},
+		nil,
+	)
+	scriptExitCodeDesc = prometheus.NewDesc(
+		"node_textfile_script_exit_code",
+		"Exit code of the last run of the textfile script, -1 if it failed to start or was killed.",
+		[]string{"script"},
+		nil,
+	)
+	scriptLastSuccessDesc = prometheus.NewDesc(
+		"node_textfile_script_last_success_timestamp_seconds",
+		"Unixtime of the last successful run of the textfile script, 0 if it never succeeded.",
+		[]string{"script"},
+		nil,
+	)
+)
+
+// textFileScript is an executable whose output is read as a text file. The
+// result of its last run is kept for caching.
+type textFileScript struct {
+	name string
+	path string
+	args []string
+
+	mtx         sync.Mutex
+	ran         time.Time
+	families    map[string]*dto.MetricFamily
+	err         error
+	duration    time.Duration
+	exitCode    int
+	lastSuccess time.Time
+}
+
+// parseTextFileScripts parses the <name>=<path> [<argument>...] settings of
+// the textfile scripts.
+func parseTextFileScripts(settings []string) ([]*textFileScript, error) {
+	var scripts []*textFileScript
+	names := make(map[string]bool)
+	for _, setting := range settings {
+		name, command, ok := strings.Cut(setting, "=")
+		fields := strings.Fields(command)
+		if !ok || name == "" || len(fields) == 0 {
+			return nil, fmt.Errorf("invalid textfile script %q: expected <name>=<path> [<argument>...]", setting)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("invalid textfile script %q: duplicate name %q", setting, name)
+		}
+		names[name] = true
+		scripts = append(scripts, &textFileScript{name: name, path: fields[0], args: fields[1:]})
+	}
+	return scripts, nil
+}
+
+// runScripts runs the scripts whose cached output expired in parallel, and
+// returns the metric families of each script, or the error of its last run.
+func (c *textFileCollector) runScripts(ctx context.Context) ([]map[string]*dto.MetricFamily, []error) {
+	families := make([]map[string]*dto.MetricFamily, len(c.scripts))
+	errs := make([]error, len(c.scripts))
+	var wg sync.WaitGroup
+	for i, s := range c.scripts {
+		wg.Add(1)
+		go func(i int, s *textFileScript) {
+			defer wg.Done()
+			families[i], errs[i] = c.scriptFamilies(ctx, s)
+		}(i, s)
+	}
+	wg.Wait()
+	return families, errs
+}
+
+// scriptFamilies returns the metric families written by a script, running
+// it unless its cached output is recent enough.
+func (c *textFileCollector) scriptFamilies(ctx context.Context, s *textFileScript) (map[string]*dto.MetricFamily, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.ran.IsZero() || c.now().Sub(s.ran) >= c.scriptCache {
+		s.ran = c.now()
+		var output []byte
+		output, s.exitCode, s.err = c.runScript(ctx, s)
+		s.duration = c.now().Sub(s.ran)
+		s.families = nil
+		if s.err == nil {
+			// The output is parsed now so that the last success isn't
+			// updated by unusable output. The families are reused until
+			// the next run, as they are not modified while exporting them.
+			if s.families, s.err = c.parseScriptOutput(s.name, output); s.err == nil {
+				s.lastSuccess = s.ran
+			}
+		}
+	}
+	return s.families, s.err
+}
+
+// runScript runs a script and returns its output and exit code.
+func (c *textFileCollector) runScript(ctx context.Context, s *textFileScript) ([]byte, int, error) {
+	if c.scriptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.scriptTimeout)
+		defer cancel()
+	}
+
+	stdout := &limitedBuffer{limit: c.scriptMaxOutput}
+	stderr := &limitedBuffer{limit: execStderrLimit + 1}
+	cmd := exec.CommandContext(ctx, s.path, s.args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Don't wait for children inheriting the output pipes of a killed script.
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if err == nil {
+		if stdout.truncated {
+			return nil, 0, fmt.Errorf("output of textfile script %q is larger than the maximum of %d bytes", s.name, c.scriptMaxOutput)
+		}
+		return stdout.Bytes(), 0, nil
+	}
+
+	cerr := &commandError{
+		Command: s.path,
+		Args:    s.args,
+		Reason:  execFailureStart,
+		Stderr:  truncateStderr(stderr.String()),
+		Err:     err,
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		cerr.Reason = execFailureTimeout
+		cerr.Err = ctx.Err()
+	case errors.As(err, &exitErr):
+		cerr.Reason = execFailureExit
+		cerr.ExitCode = exitErr.ExitCode()
+		return nil, cerr.ExitCode, cerr
+	}
+	return nil, -1, cerr
+}
+
+// parseScriptOutput parses the output of the named script.
+func (c *textFileCollector) parseScriptOutput(name string, output []byte) (map[string]*dto.MetricFamily, error) {
+	families, err := parseTextFileData(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the output of textfile script %q: %w", name, err)
+	}
+	if err := c.checkFamilies(fmt.Sprintf("textfile script %q", name), families); err != nil {
+		return nil, err
+	}
+	return families, nil
+}
+
+// exportScripts sends the status of the last run of each script.
+func (c *textFileCollector) exportScripts(ch chan<- prometheus.Metric) {
+	for _, s := range c.scripts {
+		s.mtx.Lock()
+		var lastSuccess float64
+		if !s.lastSuccess.IsZero() {
+			lastSuccess = float64(s.lastSuccess.UnixNano()) / 1e9
+		}
+		ch <- prometheus.MustNewConstMetric(scriptDurationDesc, prometheus.GaugeValue, s.duration.Seconds(), s.name)
+		ch <- prometheus.MustNewConstMetric(scriptExitCodeDesc, prometheus.GaugeValue, float64(s.exitCode), s.name)
+		ch <- prometheus.MustNewConstMetric(scriptLastSuccessDesc, prometheus.GaugeValue, lastSuccess, s.name)
+		s.mtx.Unlock()
+	}
+}
+
+// limitedBuffer is a buffer discarding the data written beyond its limit,
+// so that a command isn't blocked writing its output. A limit of 0 keeps all
+// data. The buffer isn't embedded, as io.Copy would bypass Write using its
+// ReadFrom method.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.limit - int64(b.buf.Len()); b.limit > 0 && int64(n) > room {
+		p = p[:max(room, 0)]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
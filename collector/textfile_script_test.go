@@ -0,0 +1,155 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notextfile
+// +build !notextfile
+
+package collector
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const textFileScriptFixtures = "fixtures/textfile/scripts/"
+
+func TestParseTextFileScripts(t *testing.T) {
+	for _, setting := range []string{"ok", "=ok.sh", "ok=", "ok= ", "ok=a.sh,ok=b.sh"} {
+		if _, err := parseTextFileScripts(strings.Split(setting, ",")); err == nil {
+			t.Errorf("want error for textfile script %q", setting)
+		}
+	}
+	scripts, err := parseTextFileScripts([]string{"ok=/bin/ok.sh  a=b c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := scripts[0]; s.name != "ok" || s.path != "/bin/ok.sh" || strings.Join(s.args, ",") != "a=b,c" {
+		t.Errorf("unexpected script %+v", s)
+	}
+}
+
+func TestTextfileScripts(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "runs")
+	scripts, err := parseTextFileScripts([]string{
+		"ok=" + textFileScriptFixtures + "ok.sh nightly",
+		"count=" + textFileScriptFixtures + "count.sh " + counter,
+		"fail=" + textFileScriptFixtures + "fail.sh",
+		"slow=" + textFileScriptFixtures + "slow.sh",
+		"large=" + textFileScriptFixtures + "large.sh",
+		"invalid=" + textFileScriptFixtures + "invalid.sh",
+		"missing=" + textFileScriptFixtures + "missing.sh",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	c := &textFileCollector{
+		scripts:         scripts,
+		scriptTimeout:   500 * time.Millisecond,
+		scriptMaxOutput: 1000,
+		scriptCache:     time.Minute,
+		now:             func() time.Time { return now },
+		logger:          log.NewNopLogger(),
+	}
+
+	want := `# HELP node_textfile_script_exit_code Exit code of the last run of the textfile script, -1 if it failed to start or was killed.
+# TYPE node_textfile_script_exit_code gauge
+node_textfile_script_exit_code{script="count"} 0
+node_textfile_script_exit_code{script="fail"} 3
+node_textfile_script_exit_code{script="invalid"} 0
+node_textfile_script_exit_code{script="large"} 0
+node_textfile_script_exit_code{script="missing"} -1
+node_textfile_script_exit_code{script="ok"} 0
+node_textfile_script_exit_code{script="slow"} -1
+# HELP node_textfile_script_last_success_timestamp_seconds Unixtime of the last successful run of the textfile script, 0 if it never succeeded.
+# TYPE node_textfile_script_last_success_timestamp_seconds gauge
+node_textfile_script_last_success_timestamp_seconds{script="count"} 1.7e+09
+node_textfile_script_last_success_timestamp_seconds{script="fail"} 0
+node_textfile_script_last_success_timestamp_seconds{script="invalid"} 0
+node_textfile_script_last_success_timestamp_seconds{script="large"} 0
+node_textfile_script_last_success_timestamp_seconds{script="missing"} 0
+node_textfile_script_last_success_timestamp_seconds{script="ok"} 1.7e+09
+node_textfile_script_last_success_timestamp_seconds{script="slow"} 0
+# HELP node_textfile_scrape_error 1 if there was an error opening or reading a file, 0 otherwise
+# TYPE node_textfile_scrape_error gauge
+node_textfile_scrape_error 1
+# HELP script_info Information about the script.
+# TYPE script_info gauge
+script_info{arg="nightly"} 1
+# HELP script_runs Metric read from script count
+# TYPE script_runs untyped
+script_runs 1
+`
+	names := []string{
+		"node_textfile_script_exit_code",
+		"node_textfile_script_last_success_timestamp_seconds",
+		"node_textfile_scrape_error",
+		"script_failed",
+		"script_info",
+		"script_invalid",
+		"script_large",
+		"script_runs",
+	}
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+
+	var cerr *commandError
+	if err := scripts[2].err; !errors.As(err, &cerr) || cerr.Reason != execFailureExit || cerr.Stderr != "broken backup" {
+		t.Errorf("want exit error with stderr, got %v", err)
+	}
+	if err := scripts[3].err; !errors.As(err, &cerr) || cerr.Reason != execFailureTimeout {
+		t.Errorf("want timeout error, got %v", err)
+	}
+
+	// The cached output is reused until it expires.
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+	now = now.Add(time.Minute)
+	want = `# HELP script_runs Metric read from script count
+# TYPE script_runs untyped
+script_runs 2
+`
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), "script_runs"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	for _, test := range []struct {
+		limit     int64
+		want      string
+		truncated bool
+	}{
+		{limit: 0, want: "abcdef"},
+		{limit: 6, want: "abcdef"},
+		{limit: 4, want: "abcd", truncated: true},
+	} {
+		b := &limitedBuffer{limit: test.limit}
+		for _, s := range []string{"abc", "def"} {
+			if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+				t.Fatalf("limit %d: want full write, got %d, %v", test.limit, n, err)
+			}
+		}
+		if b.String() != test.want || b.truncated != test.truncated {
+			t.Errorf("limit %d: want %q (truncated %t), got %q (truncated %t)", test.limit, test.want, test.truncated, b.String(), b.truncated)
+		}
+	}
+}
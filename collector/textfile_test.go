@@ -21,12 +21,16 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
 )
@@ -51,8 +55,9 @@ func (a collectorAdapter) Collect(ch chan<- prometheus.Metric) {
 
 func TestTextfileCollector(t *testing.T) {
 	tests := []struct {
-		path string
-		out  string
+		path       string
+		out        string
+		timestamps bool
 	}{
 		{
 			path: "fixtures/textfile/no_metric_files",
@@ -70,6 +75,11 @@ func TestTextfileCollector(t *testing.T) {
 			path: "fixtures/textfile/client_side_timestamp",
 			out:  "fixtures/textfile/client_side_timestamp.out",
 		},
+		{
+			path:       "fixtures/textfile/client_side_timestamp",
+			out:        "fixtures/textfile/client_side_timestamp_enabled.out",
+			timestamps: true,
+		},
 		{
 			path: "fixtures/textfile/different_metric_types",
 			out:  "fixtures/textfile/different_metric_types.out",
@@ -114,14 +124,23 @@ func TestTextfileCollector(t *testing.T) {
 			path: "fixtures/textfile/metrics_merge_different_help",
 			out:  "fixtures/textfile/metrics_merge_different_help.out",
 		},
+		{
+			path: "fixtures/textfile/openmetrics",
+			out:  "fixtures/textfile/openmetrics.out",
+		},
+		{
+			path: "fixtures/textfile/native_histogram",
+			out:  "fixtures/textfile/native_histogram.out",
+		},
 	}
 
 	for i, test := range tests {
 		mtime := 1.0
 		c := &textFileCollector{
-			path:   test.path,
-			mtime:  &mtime,
-			logger: log.NewNopLogger(),
+			directories: []textFileDir{{path: test.path}},
+			timestamps:  test.timestamps,
+			mtime:       &mtime,
+			logger:      log.NewNopLogger(),
 		}
 
 		// Suppress a log message about `nonexistent_path` not existing, this is
@@ -149,3 +168,204 @@ func TestTextfileCollector(t *testing.T) {
 		}
 	}
 }
+
+func TestTextfileMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Unix(1700000000, 0)
+	for name, age := range map[string]time.Duration{
+		"fresh.prom":       time.Minute,
+		"old.prom":         2 * time.Hour,
+		"batch/daily.prom": 20 * time.Hour,
+		"batch/stuck.prom": 50 * time.Hour,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		metric := strings.NewReplacer("/", "_", ".prom", "").Replace(name)
+		if err := os.WriteFile(path, []byte(metric+" 1\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := parseTextFileMaxAges([]string{filepath.Join(dir, "batch") + "=1d"}); err == nil {
+		t.Fatal("want error for invalid duration")
+	}
+	maxAges, err := parseTextFileMaxAges([]string{filepath.Join(dir, "batch") + "=24h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := 1.0
+	c := &textFileCollector{
+		directories: []textFileDir{{path: dir}},
+		maxAge:      time.Hour,
+		maxAges:     maxAges,
+		mtime:       &mtime,
+		now:         func() time.Time { return now },
+		logger:      log.NewNopLogger(),
+	}
+	want := fmt.Sprintf(`# HELP fresh Metric read from %[1]s/fresh.prom
+# TYPE fresh untyped
+fresh 1
+# HELP node_textfile_stale 1 if the textfile is older than its maximum age and its metrics were skipped, 0 otherwise. Only exported for textfiles with a maximum age.
+# TYPE node_textfile_stale gauge
+node_textfile_stale{file="%[1]s/fresh.prom"} 0
+node_textfile_stale{file="%[1]s/old.prom"} 1
+`, dir)
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), "fresh", "old", "node_textfile_stale"); err != nil {
+		t.Error(err)
+	}
+
+	c.directories = []textFileDir{{path: filepath.Join(dir, "batch")}}
+	want = fmt.Sprintf(`# HELP batch_daily Metric read from %[1]s/batch/daily.prom
+# TYPE batch_daily untyped
+batch_daily 1
+# HELP node_textfile_mtime_seconds Unixtime mtime of textfiles successfully read.
+# TYPE node_textfile_mtime_seconds gauge
+node_textfile_mtime_seconds{file="%[1]s/batch/daily.prom"} 1
+# HELP node_textfile_stale 1 if the textfile is older than its maximum age and its metrics were skipped, 0 otherwise. Only exported for textfiles with a maximum age.
+# TYPE node_textfile_stale gauge
+node_textfile_stale{file="%[1]s/batch/daily.prom"} 0
+node_textfile_stale{file="%[1]s/batch/stuck.prom"} 1
+`, dir)
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), "batch_daily", "batch_stuck", "node_textfile_mtime_seconds", "node_textfile_stale"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTextfileDirectories(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"cron/a.prom":        "a{source=\"file\"} 1\n",
+		"cron/sub/b.prom":    "b 1\n",
+		"cron/sub/b.txt":     "ignored 1\n",
+		"other/c.prom":       "c 1\nc_large 1234567890\n",
+		"other/d.prom":       "d{x=\"1\"} 1\nd{x=\"2\"} 1\nd{x=\"3\"} 1\n",
+		"other/sub/ignored":  "ignored 1\n",
+		"other/sub/e.prom":   "e 1\n",
+		"other/sub/f.prom/x": "ignored 1\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cron, other := filepath.Join(dir, "cron"), filepath.Join(dir, "other")
+	for _, setting := range []string{
+		cron + ":source",
+		cron + ":0source=cron",
+		filepath.Join(dir, "missing") + ":source=cron",
+	} {
+		if _, err := parseTextFileDirectories([]string{cron}, []string{setting}); err == nil {
+			t.Errorf("want error for directory label %q", setting)
+		}
+	}
+	directories, err := parseTextFileDirectories(
+		[]string{cron + "/", other},
+		[]string{cron + ":source=batch", cron + ":source=cron"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := 1.0
+	c := &textFileCollector{
+		directories: directories,
+		recursive:   true,
+		maxFileSize: 20,
+		maxSeries:   2,
+		mtime:       &mtime,
+		logger:      log.NewNopLogger(),
+	}
+	want := `# HELP a Metric read from ` + cron + `/a.prom
+# TYPE a untyped
+a{source="cron"} 1
+# HELP b Metric read from ` + cron + `/sub/b.prom
+# TYPE b untyped
+b{source="cron"} 1
+# HELP e Metric read from ` + other + `/sub/e.prom
+# TYPE e untyped
+e 1
+# HELP node_textfile_scrape_error 1 if there was an error opening or reading a file, 0 otherwise
+# TYPE node_textfile_scrape_error gauge
+node_textfile_scrape_error 1
+`
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), "a", "b", "c", "d", "e", "ignored", "node_textfile_scrape_error"); err != nil {
+		t.Error(err)
+	}
+
+	c.recursive = false
+	want = `# HELP a Metric read from ` + cron + `/a.prom
+# TYPE a untyped
+a{source="cron"} 1
+`
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), "a", "b", "e"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTextfileOwner(t *testing.T) {
+	if !fileOwnerSupported {
+		t.Skip("file ownership is not supported")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.prom"), []byte("a 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	uid, gid := uint32(os.Getuid()), uint32(os.Getgid())
+
+	for _, test := range []struct {
+		uids, gids []uint32
+		want       string
+	}{
+		{want: "a 1\n"},
+		{uids: []uint32{uid}, want: "a 1\n"},
+		{uids: []uint32{uid + 1}, gids: []uint32{gid}, want: "a 1\n"},
+		{uids: []uint32{uid + 1}, gids: []uint32{gid + 1}},
+	} {
+		c := &textFileCollector{
+			directories: []textFileDir{{path: dir}},
+			allowedUIDs: test.uids,
+			allowedGIDs: test.gids,
+			logger:      log.NewNopLogger(),
+		}
+		want := test.want
+		if want != "" {
+			want = "# HELP a Metric read from " + dir + "/a.prom\n# TYPE a untyped\n" + want
+		}
+		if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), "a"); err != nil {
+			t.Errorf("uids %v, gids %v: %s", test.uids, test.gids, err)
+		}
+	}
+}
+
+func TestTextfileNativeHistogram(t *testing.T) {
+	c := &textFileCollector{
+		directories: []textFileDir{{path: "fixtures/textfile/native_histogram"}},
+		logger:      log.NewNopLogger(),
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(testUpdateCollector{t, c})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "request_duration_seconds" {
+			continue
+		}
+		h := mf.Metric[0].GetHistogram()
+		if h.GetSchema() != 3 || h.GetZeroCount() != 1 || len(h.PositiveSpan) != 2 || len(h.PositiveDelta) != 3 {
+			t.Errorf("native buckets not exported: %v", h)
+		}
+		return
+	}
+	t.Error("native histogram not exported")
+}
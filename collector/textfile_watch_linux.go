@@ -0,0 +1,138 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notextfile
+// +build !notextfile
+
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask selects the events of files changing, appearing and
+// disappearing in a directory, and of the directory itself disappearing.
+const inotifyMask = unix.IN_ATTRIB | unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE |
+	unix.IN_MODIFY | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF |
+	unix.IN_ONLYDIR
+
+// inotifyWatcher watches directories with inotify.
+type inotifyWatcher struct {
+	// fd is only used while not closed, as Fd would make file blocking.
+	fd      int
+	file    *os.File
+	changed func(path string)
+	reset   func()
+	logger  log.Logger
+
+	mtx    sync.Mutex
+	dirs   map[int32]string
+	closed bool
+}
+
+func newTextFileWatcher(changed func(path string), reset func(), logger log.Logger) (textFileWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %w", err)
+	}
+	w := &inotifyWatcher{
+		fd: fd,
+		// The file is non-blocking, so that Close interrupts Read.
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		changed: changed,
+		reset:   reset,
+		logger:  logger,
+		dirs:    make(map[int32]string),
+	}
+	go w.loop()
+	return w, nil
+}
+
+func (w *inotifyWatcher) add(dir string) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.closed {
+		return errors.New("watcher closed")
+	}
+	wd, err := unix.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return fmt.Errorf("inotify_add_watch: %w", err)
+	}
+	w.dirs[int32(wd)] = dir
+	return nil
+}
+
+func (w *inotifyWatcher) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.file.Close()
+}
+
+func (w *inotifyWatcher) loop() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				level.Error(w.logger).Log("msg", "failed to read inotify events, comparing file stats instead", "err", err)
+				w.Close()
+			}
+			// Changes aren't reported anymore.
+			w.reset()
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			off += unix.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[off:off+int(event.Len)], "\x00"))
+			off += int(event.Len)
+			w.handle(event.Wd, event.Mask, name)
+		}
+	}
+}
+
+func (w *inotifyWatcher) handle(wd int32, mask uint32, name string) {
+	w.mtx.Lock()
+	dir, ok := w.dirs[wd]
+	switch {
+	case mask&unix.IN_Q_OVERFLOW != 0:
+	case mask&unix.IN_IGNORED != 0:
+		delete(w.dirs, wd)
+	case mask&unix.IN_MOVE_SELF != 0 && !w.closed:
+		// The directory is watched at its new path, but is expected at
+		// its old one.
+		unix.InotifyRmWatch(w.fd, uint32(wd))
+	case ok && name != "":
+		w.mtx.Unlock()
+		w.changed(filepath.Join(dir, name))
+		return
+	}
+	w.mtx.Unlock()
+	if mask&(unix.IN_Q_OVERFLOW|unix.IN_IGNORED|unix.IN_MOVE_SELF|unix.IN_DELETE_SELF) != 0 {
+		w.reset()
+	}
+}
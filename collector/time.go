@@ -29,6 +29,7 @@ type timeCollector struct {
 	zone                  typedDesc
 	clocksourcesAvailable typedDesc
 	clocksourceCurrent    typedDesc
+	paths                 Paths
 	logger                log.Logger
 }
 
@@ -61,6 +62,7 @@ func NewTimeCollector(logger log.Logger) (Collector, error) {
 			"Current clocksource read from '/sys/devices/system/clocksource'.",
 			[]string{"device", "clocksource"}, nil,
 		), prometheus.GaugeValue},
+		paths:  currentPaths(),
 		logger: logger,
 	}, nil
 }
@@ -39,6 +39,7 @@ var (
 
 type vmStatCollector struct {
 	fieldPattern *regexp.Regexp
+	paths        Paths
 	logger       log.Logger
 }
 
@@ -51,12 +52,13 @@ func NewvmStatCollector(logger log.Logger) (Collector, error) {
 	pattern := regexp.MustCompile(*vmStatFields)
 	return &vmStatCollector{
 		fieldPattern: pattern,
+		paths:        currentPaths(),
 		logger:       logger,
 	}, nil
 }
 
 func (c *vmStatCollector) Update(ch chan<- prometheus.Metric) error {
-	file, err := os.Open(procFilePath("vmstat"))
+	file, err := os.Open(c.paths.procFilePath("vmstat"))
 	if err != nil {
 		return err
 	}
@@ -39,6 +39,7 @@ type zfsCollector struct {
 	linuxZpoolObjsetPath string
 	linuxZpoolStatePath  string
 	linuxPathMap         map[string]string
+	paths                Paths
 	logger               log.Logger
 }
 
@@ -62,6 +63,7 @@ func NewZFSCollector(logger log.Logger) (Collector, error) {
 			"zfs_zfetch":      "zfetchstats",
 			"zfs_zil":         "zil",
 		},
+		paths:  currentPaths(),
 		logger: logger,
 	}, nil
 }
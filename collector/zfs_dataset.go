@@ -0,0 +1,211 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nozfsdataset
+// +build !nozfsdataset
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	zfsDatasetInclude   = kingpin.Flag("collector.zfs_dataset.dataset-include", "Regexp of ZFS datasets to include (mutually exclusive to dataset-exclude).").String()
+	zfsDatasetExclude   = kingpin.Flag("collector.zfs_dataset.dataset-exclude", "Regexp of ZFS datasets to exclude (mutually exclusive to dataset-include).").String()
+	zfsDatasetMaxDepth  = kingpin.Flag("collector.zfs_dataset.max-depth", "Maximum depth of ZFS datasets below their pool, 0 for no limit.").Default("0").Int()
+	zfsDatasetSnapshots = kingpin.Flag("collector.zfs_dataset.snapshots", "Count the snapshots of ZFS datasets.").Default("true").Bool()
+)
+
+// zfsDatasetProperties are the properties listed by `zfs list`, after name
+// and type, with their metric and help.
+var zfsDatasetProperties = []struct {
+	property, metric, help string
+}{
+	{"used", "used_bytes", "Space used by the dataset and its descendants."},
+	{"available", "available_bytes", "Space available to the dataset and its descendants."},
+	{"referenced", "referenced_bytes", "Space referenced by the dataset."},
+	{"logicalused", "logical_used_bytes", "Space used by the dataset and its descendants before compression."},
+	{"quota", "quota_bytes", "Quota of the dataset and its descendants, 0 if none."},
+	{"refquota", "refquota_bytes", "Quota of the space referenced by the dataset, 0 if none."},
+	{"reservation", "reservation_bytes", "Space reserved for the dataset and its descendants."},
+	{"compressratio", "compression_ratio", "Compression ratio of the data referenced by the dataset and its descendants."},
+	{"usedbysnapshots", "used_by_snapshots_bytes", "Space used by the snapshots of the dataset."},
+}
+
+type zfsDatasetCollector struct {
+	filter    deviceFilter
+	maxDepth  int
+	snapshots bool
+	descs     []*prometheus.Desc
+	snapCount *prometheus.Desc
+	// list runs `zfs list` with args.
+	list func(ctx context.Context, args ...string) (io.Reader, error)
+	// runner runs list, it is nil if list doesn't run a command.
+	runner *commandRunner
+	logger log.Logger
+}
+
+// zfsDataset is a dataset listed by `zfs list -Hp`.
+type zfsDataset struct {
+	name   string
+	typ    string
+	values []string
+}
+
+func init() {
+	registerCollector("zfs_dataset", defaultDisabled, NewZFSDatasetCollector)
+}
+
+// NewZFSDatasetCollector returns a new Collector exposing the usage, quotas
+// and snapshots of ZFS datasets.
+func NewZFSDatasetCollector(logger log.Logger) (Collector, error) {
+	if *zfsDatasetInclude != "" && *zfsDatasetExclude != "" {
+		return nil, fmt.Errorf("dataset-exclude & dataset-include are mutually exclusive")
+	}
+	for _, re := range []string{*zfsDatasetInclude, *zfsDatasetExclude} {
+		if _, err := regexp.Compile(re); err != nil {
+			return nil, fmt.Errorf("invalid ZFS dataset regexp: %w", err)
+		}
+	}
+	runner, err := newCommandRunner("zfs_dataset")
+	if err != nil {
+		return nil, err
+	}
+	list := func(ctx context.Context, args ...string) (io.Reader, error) {
+		out, err := runner.run(ctx, "zfs", append([]string{"list", "-Hp"}, args...)...)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(out), nil
+	}
+	c := newZFSDatasetCollector(newDeviceFilter(*zfsDatasetExclude, *zfsDatasetInclude), *zfsDatasetMaxDepth, *zfsDatasetSnapshots, list, logger)
+	c.runner = runner
+	return c, nil
+}
+
+func newZFSDatasetCollector(filter deviceFilter, maxDepth int, snapshots bool, list func(ctx context.Context, args ...string) (io.Reader, error), logger log.Logger) *zfsDatasetCollector {
+	const subsystem = "zfs_dataset"
+	labels := []string{"dataset", "type"}
+	c := &zfsDatasetCollector{
+		filter:    filter,
+		maxDepth:  maxDepth,
+		snapshots: snapshots,
+		snapCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "snapshots"),
+			"Number of snapshots of the dataset.",
+			labels, nil,
+		),
+		list:   list,
+		logger: logger,
+	}
+	for _, p := range zfsDatasetProperties {
+		c.descs = append(c.descs, prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, p.metric), p.help, labels, nil,
+		))
+	}
+	return c
+}
+
+func (c *zfsDatasetCollector) Update(ch chan<- prometheus.Metric) error {
+	return c.UpdateContext(context.Background(), ch)
+}
+
+func (c *zfsDatasetCollector) UpdateContext(ctx context.Context, ch chan<- prometheus.Metric) error {
+	if c.runner != nil {
+		defer c.runner.collect(ch)
+	}
+	properties := []string{"name", "type"}
+	for _, p := range zfsDatasetProperties {
+		properties = append(properties, p.property)
+	}
+	out, err := c.list(ctx, "-t", "filesystem,volume", "-o", strings.Join(properties, ","))
+	if err != nil {
+		return err
+	}
+	datasets, err := parseZFSList(out, len(properties))
+	if err != nil {
+		return err
+	}
+
+	var snapshots map[string]int
+	if c.snapshots {
+		out, err := c.list(ctx, "-t", "snapshot", "-o", "name")
+		if err != nil {
+			return err
+		}
+		if snapshots, err = countZFSSnapshots(out); err != nil {
+			return err
+		}
+	}
+
+	for _, ds := range datasets {
+		if c.filter.ignored(ds.name) || (c.maxDepth > 0 && strings.Count(ds.name, "/") > c.maxDepth) {
+			continue
+		}
+		for i, value := range ds.values {
+			// Volumes have no quotas.
+			if value == "-" {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s of ZFS dataset %s: %w", zfsDatasetProperties[i].property, ds.name, err)
+			}
+			ch <- prometheus.MustNewConstMetric(c.descs[i], prometheus.GaugeValue, v, ds.name, ds.typ)
+		}
+		if c.snapshots {
+			ch <- prometheus.MustNewConstMetric(c.snapCount, prometheus.GaugeValue, float64(snapshots[ds.name]), ds.name, ds.typ)
+		}
+	}
+	return nil
+}
+
+// parseZFSList parses the tab separated output of `zfs list -H` with the
+// given number of columns, name and type first.
+func parseZFSList(r io.Reader, columns int) ([]zfsDataset, error) {
+	var datasets []zfsDataset
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != columns {
+			return nil, fmt.Errorf("invalid zfs list line %q: %d columns, want %d", scanner.Text(), len(fields), columns)
+		}
+		datasets = append(datasets, zfsDataset{name: fields[0], typ: fields[1], values: fields[2:]})
+	}
+	return datasets, scanner.Err()
+}
+
+// countZFSSnapshots counts the snapshots listed by `zfs list -H -o name`
+// by dataset.
+func countZFSSnapshots(r io.Reader) (map[string]int, error) {
+	counts := map[string]int{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if dataset, _, ok := strings.Cut(scanner.Text(), "@"); ok {
+			counts[dataset]++
+		}
+	}
+	return counts, scanner.Err()
+}
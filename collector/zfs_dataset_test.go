@@ -0,0 +1,99 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nozfsdataset
+// +build !nozfsdataset
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// zfsListFixture returns the zfs list output of fixtures/zfs_dataset for
+// datasets, or snapshots if listed.
+func zfsListFixture(_ context.Context, args ...string) (io.Reader, error) {
+	name := "fixtures/zfs_dataset/zfs-list.txt"
+	if args[1] == "snapshot" {
+		name = "fixtures/zfs_dataset/zfs-list-snapshots.txt"
+	}
+	b, err := os.ReadFile(name)
+	return bytes.NewReader(b), err
+}
+
+func TestZFSDatasetCollector(t *testing.T) {
+	c := newZFSDatasetCollector(newDeviceFilter("", ""), 0, true, zfsListFixture, log.NewNopLogger())
+	want, err := os.Open("fixtures/zfs_dataset/zfs_dataset.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, want); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestZFSDatasetFilters(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		exclude, include string
+		maxDepth         int
+		want             string
+	}{
+		{
+			name:    "exclude",
+			exclude: "^zones/",
+			want: `node_zfs_dataset_used_bytes{dataset="data",type="filesystem"} 1.2884901888e+12
+			node_zfs_dataset_used_bytes{dataset="data/backup",type="filesystem"} 6.442450944e+11
+			node_zfs_dataset_used_bytes{dataset="data/backup/db",type="filesystem"} 3.221225472e+11
+			node_zfs_dataset_used_bytes{dataset="data/vm",type="volume"} 5.36870912e+10
+			node_zfs_dataset_used_bytes{dataset="zones",type="filesystem"} 1.073741824e+11
+			`,
+		},
+		{
+			name:    "include",
+			include: "^zones/",
+			want: `node_zfs_dataset_used_bytes{dataset="zones/8ee6e5a4-33f1-4a7b-9b8a-6b1d5c8c1e0f",type="filesystem"} 5.36870912e+10
+			node_zfs_dataset_used_bytes{dataset="zones/8ee6e5a4-33f1-4a7b-9b8a-6b1d5c8c1e0f/data",type="filesystem"} 2.147483648e+10
+			`,
+		},
+		{
+			name:     "depth",
+			exclude:  "^zones/",
+			maxDepth: 1,
+			want: `node_zfs_dataset_used_bytes{dataset="data",type="filesystem"} 1.2884901888e+12
+			node_zfs_dataset_used_bytes{dataset="data/backup",type="filesystem"} 6.442450944e+11
+			node_zfs_dataset_used_bytes{dataset="data/vm",type="volume"} 5.36870912e+10
+			node_zfs_dataset_used_bytes{dataset="zones",type="filesystem"} 1.073741824e+11
+			`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newZFSDatasetCollector(newDeviceFilter(tc.exclude, tc.include), tc.maxDepth, false, zfsListFixture, log.NewNopLogger())
+			want := `# HELP node_zfs_dataset_used_bytes Space used by the dataset and its descendants.
+			# TYPE node_zfs_dataset_used_bytes gauge
+			` + tc.want
+			if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, strings.NewReader(want), "node_zfs_dataset_used_bytes", "node_zfs_dataset_snapshots"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -45,12 +45,12 @@ const (
 var zfsPoolStatesName = []string{"online", "degraded", "faulted", "offline", "removed", "unavail", "suspended"}
 
 func (c *zfsCollector) openProcFile(path string) (*os.File, error) {
-	file, err := os.Open(procFilePath(path))
+	file, err := os.Open(c.paths.procFilePath(path))
 	if err != nil {
 		// file not found error can occur if:
 		// 1. zfs module is not loaded
 		// 2. zfs version does not have the feature with metrics -- ok to ignore
-		level.Debug(c.logger).Log("msg", "Cannot open file for reading", "path", procFilePath(path))
+		level.Debug(c.logger).Log("msg", "Cannot open file for reading", "path", c.paths.procFilePath(path))
 		return nil, errZFSNotAvailable
 	}
 	return file, nil
@@ -69,7 +69,7 @@ func (c *zfsCollector) updateZfsStats(subsystem string, ch chan<- prometheus.Met
 }
 
 func (c *zfsCollector) updatePoolStats(ch chan<- prometheus.Metric) error {
-	zpoolPaths, err := filepath.Glob(procFilePath(filepath.Join(c.linuxProcpathBase, c.linuxZpoolIoPath)))
+	zpoolPaths, err := filepath.Glob(c.paths.procFilePath(filepath.Join(c.linuxProcpathBase, c.linuxZpoolIoPath)))
 	if err != nil {
 		return err
 	}
@@ -91,7 +91,7 @@ func (c *zfsCollector) updatePoolStats(ch chan<- prometheus.Metric) error {
 		}
 	}
 
-	zpoolObjsetPaths, err := filepath.Glob(procFilePath(filepath.Join(c.linuxProcpathBase, c.linuxZpoolObjsetPath)))
+	zpoolObjsetPaths, err := filepath.Glob(c.paths.procFilePath(filepath.Join(c.linuxProcpathBase, c.linuxZpoolObjsetPath)))
 	if err != nil {
 		return err
 	}
@@ -113,7 +113,7 @@ func (c *zfsCollector) updatePoolStats(ch chan<- prometheus.Metric) error {
 		}
 	}
 
-	zpoolStatePaths, err := filepath.Glob(procFilePath(filepath.Join(c.linuxProcpathBase, c.linuxZpoolStatePath)))
+	zpoolStatePaths, err := filepath.Glob(c.paths.procFilePath(filepath.Join(c.linuxProcpathBase, c.linuxZpoolStatePath)))
 	if err != nil {
 		return err
 	}
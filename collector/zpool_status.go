@@ -0,0 +1,341 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// zpoolVdevStates are the states of vdevs, and of spares, in `zpool status`.
+var zpoolVdevStates = []string{"ONLINE", "DEGRADED", "FAULTED", "OFFLINE", "UNAVAIL", "REMOVED", "AVAIL", "INUSE"}
+
+// zpoolVdevRoles are the headers of the vdev sections of `zpool status`.
+var zpoolVdevRoles = map[string]string{
+	"logs":    "log",
+	"cache":   "cache",
+	"spares":  "spare",
+	"special": "special",
+	"dedup":   "dedup",
+}
+
+// zpoolStatusTimeLayout is the layout of times in `zpool status`, which
+// are in local time.
+const zpoolStatusTimeLayout = "Mon Jan _2 15:04:05 2006"
+
+var (
+	zpoolScanDoneRE     = regexp.MustCompile(`^(scrub repaired|resilvered) (\S+) in .* with (\d+) errors on (.*)$`)
+	zpoolScanActiveRE   = regexp.MustCompile(`^(scrub|resilver) (in progress|paused) since (.*)$`)
+	zpoolScanCanceledRE = regexp.MustCompile(`^(scrub|resilver) canceled on (.*)$`)
+	zpoolScanBytesRE    = regexp.MustCompile(`^(\S+) scanned(?: at \S+)?, (\S+) issued(?: at \S+)?, (\S+) total`)
+	zpoolScanDoneBytes  = regexp.MustCompile(`^(\S+) (?:repaired|resilvered), ([\d.]+)% done`)
+	zpoolDataErrorsRE   = regexp.MustCompile(`^(\d+) data errors`)
+)
+
+// zpoolStatus is a pool in the output of `zpool status -p`.
+type zpoolStatus struct {
+	name       string
+	state      string
+	scan       *zpoolScan
+	vdevs      []zpoolVdev
+	dataErrors float64
+}
+
+// zpoolVdev is a vdev in the configuration of a pool. The pool itself is
+// the root vdev.
+type zpoolVdev struct {
+	name  string
+	role  string
+	state string
+	// hasErrors is false for spares, which have no error counters.
+	hasErrors               bool
+	readErrors, writeErrors float64
+	checksumErrors          float64
+}
+
+// zpoolScan is the last or current scrub or resilver of a pool.
+type zpoolScan struct {
+	function string
+	// state is in_progress, paused, finished or canceled.
+	state                  string
+	end                    time.Time
+	scanned, issued, total float64
+	processed              float64
+	progress               float64
+	errors                 float64
+}
+
+// parseZpoolStatus parses the output of `zpool status -p`, with times in
+// loc.
+func parseZpoolStatus(r io.Reader, loc *time.Location) ([]zpoolStatus, error) {
+	var (
+		pools   []zpoolStatus
+		pool    *zpoolStatus
+		section string
+		role    string
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if key, value, ok := strings.Cut(trimmed, ": "); ok && !strings.HasPrefix(line, "\t") {
+			if key == "pool" {
+				pools = append(pools, zpoolStatus{name: value})
+				pool = &pools[len(pools)-1]
+				section, role = "", "data"
+				continue
+			}
+			if pool == nil {
+				return nil, fmt.Errorf("%s outside of pool", key)
+			}
+			section = key
+			switch key {
+			case "state":
+				pool.state = value
+			case "scan":
+				scan, err := parseZpoolScan(value, loc)
+				if err != nil {
+					return nil, fmt.Errorf("invalid scan of pool %s: %w", pool.name, err)
+				}
+				pool.scan = scan
+			case "errors":
+				if m := zpoolDataErrorsRE.FindStringSubmatch(value); m != nil {
+					pool.dataErrors, _ = strconv.ParseFloat(m[1], 64)
+				}
+			}
+			continue
+		}
+		if trimmed == "config:" {
+			section = "config"
+			continue
+		}
+		if pool == nil || trimmed == "" || !strings.HasPrefix(line, "\t") {
+			continue
+		}
+
+		switch section {
+		case "scan":
+			if err := pool.scan.parseProgress(trimmed); err != nil {
+				return nil, fmt.Errorf("invalid scan of pool %s: %w", pool.name, err)
+			}
+		case "config":
+			fields := strings.Fields(trimmed)
+			if fields[0] == "NAME" {
+				continue
+			}
+			if r, ok := zpoolVdevRoles[fields[0]]; ok && len(fields) == 1 && !strings.HasPrefix(line, "\t ") {
+				role = r
+				continue
+			}
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("invalid vdev line %q of pool %s", trimmed, pool.name)
+			}
+			vdev := zpoolVdev{name: fields[0], role: role, state: fields[1]}
+			// Spares have no error counters, but may be described as
+			// "currently in use".
+			if len(fields) >= 5 && role != "spare" {
+				var err error
+				for i, v := range []*float64{&vdev.readErrors, &vdev.writeErrors, &vdev.checksumErrors} {
+					if *v, err = parseZpoolNumber(fields[2+i]); err != nil {
+						return nil, fmt.Errorf("invalid errors of vdev %s of pool %s: %w", vdev.name, pool.name, err)
+					}
+				}
+				vdev.hasErrors = true
+			}
+			pool.vdevs = append(pool.vdevs, vdev)
+		}
+	}
+	return pools, scanner.Err()
+}
+
+// parseZpoolScan parses the first line of the scan status of a pool, nil if
+// no scan was requested.
+func parseZpoolScan(s string, loc *time.Location) (*zpoolScan, error) {
+	var err error
+	scan := &zpoolScan{}
+	if m := zpoolScanDoneRE.FindStringSubmatch(s); m != nil {
+		scan.function, scan.state, scan.progress = "scrub", "finished", 1
+		if m[1] == "resilvered" {
+			scan.function = "resilver"
+		}
+		if scan.processed, err = parseZpoolNumber(m[2]); err != nil {
+			return nil, err
+		}
+		if scan.errors, err = strconv.ParseFloat(m[3], 64); err != nil {
+			return nil, err
+		}
+		if scan.end, err = time.ParseInLocation(zpoolStatusTimeLayout, m[4], loc); err != nil {
+			return nil, err
+		}
+		return scan, nil
+	}
+	if m := zpoolScanActiveRE.FindStringSubmatch(s); m != nil {
+		scan.function, scan.state = m[1], strings.ReplaceAll(m[2], " ", "_")
+		return scan, nil
+	}
+	if m := zpoolScanCanceledRE.FindStringSubmatch(s); m != nil {
+		scan.function, scan.state = m[1], "canceled"
+		if scan.end, err = time.ParseInLocation(zpoolStatusTimeLayout, m[2], loc); err != nil {
+			return nil, err
+		}
+		return scan, nil
+	}
+	return nil, nil
+}
+
+// parseProgress parses the lines following the first line of the scan
+// status.
+func (scan *zpoolScan) parseProgress(s string) error {
+	if scan == nil {
+		return nil
+	}
+	var err error
+	if m := zpoolScanBytesRE.FindStringSubmatch(s); m != nil {
+		for i, v := range []*float64{&scan.scanned, &scan.issued, &scan.total} {
+			if *v, err = parseZpoolNumber(m[1+i]); err != nil {
+				return err
+			}
+		}
+	}
+	if m := zpoolScanDoneBytes.FindStringSubmatch(s); m != nil {
+		if scan.processed, err = parseZpoolNumber(m[1]); err != nil {
+			return err
+		}
+		if scan.progress, err = strconv.ParseFloat(m[2], 64); err != nil {
+			return err
+		}
+		scan.progress /= 100
+	}
+	return nil
+}
+
+// parseZpoolNumber parses an exact number, or a number abbreviated with a
+// binary suffix, as printed without -p.
+func parseZpoolNumber(s string) (float64, error) {
+	s = strings.TrimSuffix(s, "B")
+	scale := 1.0
+	if i := strings.IndexAny(s, "KMGTPE"); i >= 0 && i == len(s)-1 {
+		scale = float64(uint64(1) << (10 * (strings.IndexByte("KMGTPE", s[i]) + 1)))
+		s = s[:i]
+	}
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v * scale, err
+}
+
+// zpoolStatusDescs are the metrics of `zpool status`.
+type zpoolStatusDescs struct {
+	vdevState, readErrors, writeErrors, checksumErrors typedDesc
+	dataErrors                                         typedDesc
+	scanState, scanProgress, scanEnd                   typedDesc
+	scanScanned, scanIssued, scanTotal, scanProcessed  typedDesc
+	scanErrors                                         typedDesc
+}
+
+func newZpoolStatusDescs() zpoolStatusDescs {
+	const subsystem = "zpool"
+	vdevLabels := []string{"pool", "vdev", "role"}
+	scanLabels := []string{"pool", "function"}
+	desc := func(name, help string, valueType prometheus.ValueType, labels ...string) typedDesc {
+		return typedDesc{prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, labels, nil), valueType}
+	}
+	return zpoolStatusDescs{
+		vdevState:      desc("vdev_state", "State of the vdev, the pool itself being the root vdev.", prometheus.GaugeValue, append(vdevLabels, "state")...),
+		readErrors:     desc("vdev_read_errors_total", "Read errors of the vdev since the last zpool clear.", prometheus.CounterValue, vdevLabels...),
+		writeErrors:    desc("vdev_write_errors_total", "Write errors of the vdev since the last zpool clear.", prometheus.CounterValue, vdevLabels...),
+		checksumErrors: desc("vdev_checksum_errors_total", "Checksum errors of the vdev since the last zpool clear.", prometheus.CounterValue, vdevLabels...),
+		dataErrors:     desc("data_errors", "Number of known permanent data errors of the pool.", prometheus.GaugeValue, "pool"),
+		scanState:      desc("scan_state", "State of the last scrub or resilver of the pool.", prometheus.GaugeValue, append(scanLabels, "state")...),
+		scanProgress:   desc("scan_progress_ratio", "Progress of the last scrub or resilver of the pool.", prometheus.GaugeValue, scanLabels...),
+		scanEnd:        desc("scan_end_time_seconds", "Time the last scrub or resilver of the pool finished or was canceled.", prometheus.GaugeValue, scanLabels...),
+		scanScanned:    desc("scan_scanned_bytes", "Bytes scanned by the scrub or resilver in progress.", prometheus.GaugeValue, scanLabels...),
+		scanIssued:     desc("scan_issued_bytes", "Bytes issued by the scrub or resilver in progress.", prometheus.GaugeValue, scanLabels...),
+		scanTotal:      desc("scan_total_bytes", "Bytes to scan by the scrub or resilver in progress.", prometheus.GaugeValue, scanLabels...),
+		scanProcessed:  desc("scan_processed_bytes", "Bytes repaired or resilvered by the last scrub or resilver.", prometheus.GaugeValue, scanLabels...),
+		scanErrors:     desc("scan_errors", "Errors found by the last finished scrub or resilver.", prometheus.GaugeValue, scanLabels...),
+	}
+}
+
+// zpoolScanStates are the states of scrubs and resilvers.
+var zpoolScanStates = []string{"in_progress", "paused", "finished", "canceled"}
+
+// collect sends the metrics of pools to ch.
+func (d *zpoolStatusDescs) collect(ch chan<- prometheus.Metric, pools []zpoolStatus) {
+	for _, pool := range pools {
+		ch <- d.dataErrors.mustNewConstMetric(pool.dataErrors, pool.name)
+
+		seen := map[[2]string]bool{}
+		for _, vdev := range pool.vdevs {
+			// A spare in use appears both in its data vdev and among the
+			// spares, a vdev name only once per role.
+			key := [2]string{vdev.role, vdev.name}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			states := zpoolVdevStates
+			if !slices.Contains(states, vdev.state) {
+				states = append(states[:len(states):len(states)], vdev.state)
+			}
+			for _, state := range states {
+				isState := 0.0
+				if state == vdev.state {
+					isState = 1.0
+				}
+				ch <- d.vdevState.mustNewConstMetric(isState, pool.name, vdev.name, vdev.role, state)
+			}
+			if vdev.hasErrors {
+				ch <- d.readErrors.mustNewConstMetric(vdev.readErrors, pool.name, vdev.name, vdev.role)
+				ch <- d.writeErrors.mustNewConstMetric(vdev.writeErrors, pool.name, vdev.name, vdev.role)
+				ch <- d.checksumErrors.mustNewConstMetric(vdev.checksumErrors, pool.name, vdev.name, vdev.role)
+			}
+		}
+
+		scan := pool.scan
+		if scan == nil {
+			continue
+		}
+		for _, state := range zpoolScanStates {
+			isState := 0.0
+			if state == scan.state {
+				isState = 1.0
+			}
+			ch <- d.scanState.mustNewConstMetric(isState, pool.name, scan.function, state)
+		}
+		ch <- d.scanProgress.mustNewConstMetric(scan.progress, pool.name, scan.function)
+		ch <- d.scanProcessed.mustNewConstMetric(scan.processed, pool.name, scan.function)
+		switch scan.state {
+		case "finished":
+			ch <- d.scanEnd.mustNewConstMetric(float64(scan.end.Unix()), pool.name, scan.function)
+			ch <- d.scanErrors.mustNewConstMetric(scan.errors, pool.name, scan.function)
+		case "canceled":
+			ch <- d.scanEnd.mustNewConstMetric(float64(scan.end.Unix()), pool.name, scan.function)
+		default:
+			ch <- d.scanScanned.mustNewConstMetric(scan.scanned, pool.name, scan.function)
+			ch <- d.scanIssued.mustNewConstMetric(scan.issued, pool.name, scan.function)
+			ch <- d.scanTotal.mustNewConstMetric(scan.total, pool.name, scan.function)
+		}
+	}
+}
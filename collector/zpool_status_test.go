@@ -0,0 +1,109 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testZpoolStatusCollector struct {
+	descs zpoolStatusDescs
+	pools []zpoolStatus
+}
+
+func (c testZpoolStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.descs.collect(ch, c.pools)
+}
+
+func (c testZpoolStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func TestZpoolStatus(t *testing.T) {
+	for _, name := range []string{"illumos", "openzfs"} {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open("fixtures/zpool/status-" + name + ".txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			pools, err := parseZpoolStatus(f, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := os.Open("fixtures/zpool/status-" + name + ".out")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer want.Close()
+			c := testZpoolStatusCollector{newZpoolStatusDescs(), pools}
+			if err := testutil.CollectAndCompare(c, want); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestParseZpoolStatusScan(t *testing.T) {
+	for line, want := range map[string]*zpoolScan{
+		"none requested": nil,
+		"scrub canceled on Fri Oct 18 10:00:00 2024": {
+			function: "scrub", state: "canceled", end: time.Date(2024, 10, 18, 10, 0, 0, 0, time.UTC),
+		},
+		"resilvered 1.50G in 00:03:10 with 0 errors on Sat Oct  5 01:02:03 2024": {
+			function: "resilver", state: "finished", end: time.Date(2024, 10, 5, 1, 2, 3, 0, time.UTC),
+			processed: 1.5 * (1 << 30), progress: 1,
+		},
+		"scrub paused since Fri Oct 18 09:00:00 2024": {function: "scrub", state: "paused"},
+	} {
+		got, err := parseZpoolScan(line, time.UTC)
+		if err != nil {
+			t.Errorf("%s: %s", line, err)
+			continue
+		}
+		if (got == nil) != (want == nil) || got != nil && *got != *want {
+			t.Errorf("%s: want %+v, got %+v", line, want, got)
+		}
+	}
+}
+
+func TestParseZpoolStatusSpareInUse(t *testing.T) {
+	status := "  pool: tank\n state: ONLINE\nconfig:\n\n" +
+		"\tNAME        STATE     READ WRITE CKSUM\n" +
+		"\ttank        ONLINE       0     0     0\n" +
+		"\t  mirror-0  ONLINE       0     0     0\n" +
+		"\t    spare-0 ONLINE       0     0     0\n" +
+		"\t      sda   ONLINE       0     0     0\n" +
+		"\t      sdc   ONLINE       0     0     0\n" +
+		"\t    sdb     ONLINE       0     0     0\n" +
+		"\tspares\n" +
+		"\t  sdc       INUSE     currently in use\n\n" +
+		"errors: No known data errors\n"
+	pools, err := parseZpoolStatus(strings.NewReader(status), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 1 || len(pools[0].vdevs) != 7 {
+		t.Fatalf("unexpected pools %+v", pools)
+	}
+	if spare := pools[0].vdevs[6]; spare.role != "spare" || spare.state != "INUSE" || spare.hasErrors {
+		t.Errorf("unexpected spare %+v", spare)
+	}
+}
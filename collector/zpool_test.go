@@ -0,0 +1,86 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// zpoolFixtures runs the zpool and zfs commands of the zpool collector by
+// reading fixtures/zpool, with the given suffix once pools are exported.
+type zpoolFixtures struct {
+	suffix string
+}
+
+func (f *zpoolFixtures) run(_ context.Context, name string, args ...string) ([]byte, error) {
+	var file string
+	switch name + " " + args[0] {
+	case "zpool get":
+		file = "get"
+	case "zpool iostat":
+		file = "iostat"
+	case "zpool status":
+		file = "status-illumos"
+	case "zfs get":
+		file = "zfs-get"
+	default:
+		return nil, fmt.Errorf("unexpected command %s %v", name, args)
+	}
+	if _, err := os.Stat("fixtures/zpool/" + file + f.suffix + ".txt"); err == nil {
+		file += f.suffix
+	}
+	return os.ReadFile("fixtures/zpool/" + file + ".txt")
+}
+
+func TestZpool(t *testing.T) {
+	fixtures := &zpoolFixtures{}
+	c := newZpoolCollector(fixtures.run, time.UTC, log.NewNopLogger())
+	// zpool status is tested by TestZpoolStatus.
+	var names []string
+	for _, desc := range []typedDesc{c.frag, c.health, c.guid, c.logicalUsed} {
+		names = append(names, zpoolDescName(desc))
+	}
+	for _, desc := range c.sizes {
+		names = append(names, zpoolDescName(desc))
+	}
+	for _, desc := range c.iostat {
+		names = append(names, zpoolDescName(desc))
+	}
+
+	for _, suffix := range []string{"", "-exported"} {
+		fixtures.suffix = suffix
+		want, err := os.Open("fixtures/zpool/zpool" + suffix + ".out")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer want.Close()
+		if err := testutil.CollectAndCompare(testUpdateCollector{t, c}, want, names...); err != nil {
+			t.Errorf("scrape with fixtures%s: %s", suffix, err)
+		}
+	}
+}
+
+func zpoolDescName(d typedDesc) string {
+	s := d.desc.String()
+	s = s[strings.Index(s, `"`)+1:]
+	return s[:strings.Index(s, `"`)]
+}
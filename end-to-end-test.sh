@@ -69,13 +69,23 @@ cd "$(dirname $0)"
 port="$((10000 + (RANDOM % 10000)))"
 tmpdir=$(mktemp -d /tmp/node_exporter_e2e_test.XXXXXX)
 
-skip_re="^(go_|node_exporter_build_info|node_scrape_collector_duration_seconds|process_|node_textfile_mtime_seconds|node_time_(zone|seconds)|node_network_(receive|transmit)_(bytes|packets)_total)"
+skip_re="^(go_|node_exporter_build_info|node_exporter_config_last_reload_success_timestamp_seconds|node_scrape_collector_duration_seconds|process_|node_textfile_mtime_seconds|node_time_(zone|seconds)|node_network_(receive|transmit)_(bytes|packets)_total)"
+
+# Created timestamps of the exporter's own counters depend on its start.
+openmetrics_skip_re="${skip_re}|^promhttp_metric_handler_.*_created"
 
 arch="$(uname -m)"
 
 case "${arch}" in
-  aarch64|ppc64le) fixture='collector/fixtures/e2e-64k-page-output.txt' ;;
-  *) fixture='collector/fixtures/e2e-output.txt' ;;
+  aarch64|ppc64le)
+    fixture='collector/fixtures/e2e-64k-page-output.txt'
+    # The OpenMetrics exposition is only compared on 4k page systems.
+    openmetrics_fixture=''
+    ;;
+  *)
+    fixture='collector/fixtures/e2e-output.txt'
+    openmetrics_fixture='collector/fixtures/e2e-openmetrics-output.txt'
+    ;;
 esac
 
 # Only test CPU info collection on x86_64.
@@ -109,7 +119,7 @@ do
     *)
       echo "Usage: $0 [-k] [-u] [-v]"
       echo "  -k: keep temporary files and leave node_exporter running"
-      echo "  -u: update fixture"
+      echo "  -u: update fixtures"
       echo "  -v: verbose output"
       exit 1
       ;;
@@ -166,6 +176,10 @@ EOF
   if [ ${update} -ne 0 ]
   then
     cp "${tmpdir}/e2e-output.txt" "${fixture}"
+    if [ -n "${openmetrics_fixture}" ]
+    then
+      cp "${tmpdir}/e2e-openmetrics-output.txt" "${openmetrics_fixture}"
+    fi
   fi
 
   if [ ${keep} -eq 0 ]
@@ -180,13 +194,14 @@ EOF
 
 trap finish EXIT
 
+# get URL [ACCEPT]
 get() {
   if command -v curl > /dev/null 2>&1
   then
-    curl -s -f "$@"
+    curl -s -f ${2:+-H "Accept: $2"} "$1"
   elif command -v wget > /dev/null 2>&1
   then
-    wget -O - "$@"
+    wget -O - ${2:+--header "Accept: $2"} "$1"
   else
     echo "Neither curl nor wget found"
     exit 1
@@ -196,7 +211,18 @@ get() {
 sleep 1
 
 get "127.0.0.1:${port}/metrics" | grep -E -v "${skip_re}" > "${tmpdir}/e2e-output.txt"
+if [ -n "${openmetrics_fixture}" ]
+then
+  get "127.0.0.1:${port}/metrics" "application/openmetrics-text;version=1.0.0" | grep -E -v "${openmetrics_skip_re}" > "${tmpdir}/e2e-openmetrics-output.txt"
+fi
 
 diff -u \
   "${fixture}" \
   "${tmpdir}/e2e-output.txt"
+
+if [ -n "${openmetrics_fixture}" ]
+then
+  diff -u \
+    "${openmetrics_fixture}" \
+    "${tmpdir}/e2e-openmetrics-output.txt"
+fi
@@ -14,14 +14,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	stdlog "log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"os/user"
 	"runtime"
 	"sort"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
@@ -33,31 +38,65 @@ import (
 	promcollectors "github.com/prometheus/client_golang/prometheus/collectors"
 	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/prometheus/exporter-toolkit/web/kingpinflag"
 	"github.com/prometheus/node_exporter/collector"
 )
 
+var (
+	configSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "node_exporter",
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload attempt was successful.",
+	})
+	configSuccessTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "node_exporter",
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload.",
+	})
+)
+
+// maxFilteredHandlers limits the number of cached filtered handlers.
+const maxFilteredHandlers = 64
+
 // handler wraps an unfiltered http.Handler but uses a filtered handler,
-// created on the fly, if filtering is requested. Create instances with
-// newHandler.
+// created on first use and cached, if filtering is requested. Create
+// instances with newHandler.
 type handler struct {
-	unfilteredHandler http.Handler
+	// mtx protects unfilteredGatherer, unfilteredHandler and
+	// filteredHandlers, which are replaced on reload.
+	mtx                sync.RWMutex
+	unfilteredGatherer prometheus.Gatherer
+	unfilteredHandler  http.Handler
+	// filteredHandlers maps the probe target and the sorted,
+	// comma-separated names of the selected collectors to their handler.
+	filteredHandlers map[string]http.Handler
+	// generation is increased on every reload, so that handlers created
+	// concurrently with a reload are not cached.
+	generation int
+	// reloadMtx serializes configuration reloads.
+	reloadMtx sync.Mutex
 	// exporterMetricsRegistry is a separate registry for the metrics about
 	// the exporter itself.
 	exporterMetricsRegistry *prometheus.Registry
 	includeExporterMetrics  bool
-	maxRequests             int
-	logger                  log.Logger
+	// includeRemoteWriteMetrics adds the metrics about remote write to the
+	// unfiltered handler.
+	includeRemoteWriteMetrics bool
+	maxRequests               int
+	logger                    log.Logger
 }
 
-func newHandler(includeExporterMetrics bool, maxRequests int, logger log.Logger) *handler {
+func newHandler(includeExporterMetrics, includeRemoteWriteMetrics bool, maxRequests int, logger log.Logger) *handler {
 	h := &handler{
-		exporterMetricsRegistry: prometheus.NewRegistry(),
-		includeExporterMetrics:  includeExporterMetrics,
-		maxRequests:             maxRequests,
-		logger:                  logger,
+		filteredHandlers:          map[string]http.Handler{},
+		exporterMetricsRegistry:   prometheus.NewRegistry(),
+		includeExporterMetrics:    includeExporterMetrics,
+		includeRemoteWriteMetrics: includeRemoteWriteMetrics,
+		maxRequests:               maxRequests,
+		logger:                    logger,
 	}
 	if h.includeExporterMetrics {
 		h.exporterMetricsRegistry.MustRegister(
@@ -65,26 +104,64 @@ func newHandler(includeExporterMetrics bool, maxRequests int, logger log.Logger)
 			promcollectors.NewGoCollector(),
 		)
 	}
-	if innerHandler, err := h.innerHandler(); err != nil {
+	if gatherer, err := h.innerGatherer(""); err != nil {
 		panic(fmt.Sprintf("Couldn't create metrics handler: %s", err))
 	} else {
-		h.unfilteredHandler = innerHandler
+		h.unfilteredGatherer = gatherer
+		h.unfilteredHandler = h.handlerFor(gatherer)
 	}
 	return h
 }
 
+// Gather implements prometheus.Gatherer, gathering the metrics served by the
+// unfiltered handler.
+func (h *handler) Gather() ([]*dto.MetricFamily, error) {
+	h.mtx.RLock()
+	gatherer := h.unfilteredGatherer
+	h.mtx.RUnlock()
+	return gatherer.Gather()
+}
+
 // ServeHTTP implements http.Handler.
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	filters := r.URL.Query()["collect[]"]
-	level.Debug(h.logger).Log("msg", "collect query:", "filters", filters)
+	h.serve(w, r, "")
+}
+
+// probeHandler serves the metrics of the probe target given by the target
+// URL parameter, read from the paths configured for it.
+func (h *handler) probeHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	h.serve(w, r, target)
+}
+
+// serve serves the metrics of the given probe target, or of the paths given
+// by the flags if target is empty.
+func (h *handler) serve(w http.ResponseWriter, r *http.Request, target string) {
+	query := r.URL.Query()
+	profile, collect, exclude := query.Get("profile"), query["collect[]"], query["exclude[]"]
+	level.Debug(h.logger).Log("msg", "collect query:", "profile", profile, "filters", collect, "excludes", exclude)
 
-	if len(filters) == 0 {
+	filters, err := collector.SelectCollectors(profile, collect, exclude)
+	if err != nil {
+		level.Warn(h.logger).Log("msg", "Couldn't select collectors:", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("Couldn't create filtered metrics handler: %s", err)))
+		return
+	}
+
+	if target == "" && len(filters) == 0 {
 		// No filters, use the prepared unfiltered handler.
-		h.unfilteredHandler.ServeHTTP(w, r)
+		h.mtx.RLock()
+		unfilteredHandler := h.unfilteredHandler
+		h.mtx.RUnlock()
+		unfilteredHandler.ServeHTTP(w, r)
 		return
 	}
-	// To serve filtered metrics, we create a filtering handler on the fly.
-	filteredHandler, err := h.innerHandler(filters...)
+	filteredHandler, err := h.filteredHandler(target, filters)
 	if err != nil {
 		level.Warn(h.logger).Log("msg", "Couldn't create filtered metrics handler:", "err", err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -94,20 +171,127 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	filteredHandler.ServeHTTP(w, r)
 }
 
-// innerHandler is used to create both the one unfiltered http.Handler to be
-// wrapped by the outer handler and also the filtered handlers created on the
-// fly. The former is accomplished by calling innerHandler without any arguments
-// (in which case it will log all the collectors enabled via command-line
-// flags).
-func (h *handler) innerHandler(filters ...string) (http.Handler, error) {
-	nc, err := collector.NewNodeCollector(h.logger, filters...)
+// filteredHandler returns the cached handler for the given probe target and
+// collectors, creating it if needed.
+func (h *handler) filteredHandler(target string, filters []string) (http.Handler, error) {
+	key := target + "/" + strings.Join(filters, ",")
+	h.mtx.RLock()
+	filteredHandler, ok := h.filteredHandlers[key]
+	generation := h.generation
+	h.mtx.RUnlock()
+	if ok {
+		return filteredHandler, nil
+	}
+
+	filteredHandler, err := h.innerHandler(target, filters...)
+	if err != nil {
+		return nil, err
+	}
+	h.mtx.Lock()
+	if h.generation == generation && len(h.filteredHandlers) < maxFilteredHandlers {
+		h.filteredHandlers[key] = filteredHandler
+	}
+	h.mtx.Unlock()
+	return filteredHandler, nil
+}
+
+// reload re-reads the configuration file, if any, recreates the collectors
+// and replaces the unfiltered handler. Flags given in args take precedence
+// over the configuration file. On failure the previous configuration and
+// handler stay in use.
+func (h *handler) reload(configFile string, args []string) (err error) {
+	h.reloadMtx.Lock()
+	defer h.reloadMtx.Unlock()
+
+	defer func() {
+		if err != nil {
+			configSuccess.Set(0)
+			return
+		}
+		configSuccess.Set(1)
+		configSuccessTime.SetToCurrentTime()
+	}()
+
+	var cfg *collector.Config
+	if configFile != "" {
+		if cfg, err = collector.LoadConfig(configFile); err != nil {
+			return err
+		}
+	}
+	// The gatherer is created before the new collectors replace the
+	// previous ones, so that a failure keeps serving the previous ones.
+	var gatherer prometheus.Gatherer
+	err = collector.Reload(cfg, args, h.logger, func(nc *collector.NodeCollector) error {
+		var err error
+		gatherer, err = h.gathererFor(nc, "")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	h.mtx.Lock()
+	h.unfilteredGatherer = gatherer
+	h.unfilteredHandler = h.handlerFor(gatherer)
+	h.filteredHandlers = map[string]http.Handler{}
+	h.generation++
+	h.mtx.Unlock()
+	return nil
+}
+
+// reloadHandler triggers a configuration reload via HTTP.
+func (h *handler) reloadHandler(configFile string, args []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			http.Error(w, "Only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := h.reload(configFile, args); err != nil {
+			level.Error(h.logger).Log("msg", "Error reloading configuration", "err", err)
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+			return
+		}
+		level.Info(h.logger).Log("msg", "Reloaded configuration")
+	}
+}
+
+// innerHandler creates the filtered and probe target handlers on the fly.
+func (h *handler) innerHandler(target string, filters ...string) (http.Handler, error) {
+	gatherer, err := h.innerGatherer(target, filters...)
+	if err != nil {
+		return nil, err
+	}
+	return h.handlerFor(gatherer), nil
+}
+
+// innerGatherer is used to create both the one unfiltered gatherer to be
+// served by the outer handler and pushed via remote write, and also the
+// gatherers of the filtered and probe target handlers. The former is
+// accomplished by calling innerGatherer without a target or filters (in
+// which case it will log all the collectors enabled via command-line flags).
+func (h *handler) innerGatherer(target string, filters ...string) (prometheus.Gatherer, error) {
+	var (
+		nc  *collector.NodeCollector
+		err error
+	)
+	if target == "" {
+		nc, err = collector.NewNodeCollector(h.logger, filters...)
+	} else {
+		nc, err = collector.NewTargetCollector(target, h.logger, filters...)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create collector: %s", err)
 	}
+	return h.gathererFor(nc, target, filters...)
+}
 
+// gathererFor returns the gatherer of nc, which collects the metrics of the
+// given probe target and collectors.
+func (h *handler) gathererFor(nc *collector.NodeCollector, target string, filters ...string) (prometheus.Gatherer, error) {
+	unfiltered := target == "" && len(filters) == 0
 	// Only log the creation of an unfiltered handler, which should happen
 	// only once upon startup.
-	if len(filters) == 0 {
+	if unfiltered {
 		level.Info(h.logger).Log("msg", "Enabled collectors")
 		collectors := []string{}
 		for n := range nc.Collectors {
@@ -121,21 +305,38 @@ func (h *handler) innerHandler(filters ...string) (http.Handler, error) {
 
 	r := prometheus.NewRegistry()
 	r.MustRegister(versioncollector.NewCollector("node_exporter"))
+	// The metrics about the exporter's own operation are served once, by the
+	// unfiltered handler.
+	if unfiltered {
+		r.MustRegister(configSuccess, configSuccessTime)
+		if h.includeRemoteWriteMetrics {
+			r.MustRegister(remoteWriteSamplesSent, remoteWriteSamplesFailed, remoteWriteSamplesDropped, remoteWriteSamplesQueued)
+		}
+	}
 	if err := r.Register(nc); err != nil {
 		return nil, fmt.Errorf("couldn't register node collector: %s", err)
 	}
+	if h.includeExporterMetrics {
+		return prometheus.Gatherers{h.exporterMetricsRegistry, r}, nil
+	}
+	return r, nil
+}
 
+// handlerFor returns the http.Handler serving the metrics of gatherer. The
+// OpenMetrics handler enforces h.maxRequests for all formats.
+func (h *handler) handlerFor(gatherer prometheus.Gatherer) http.Handler {
 	var handler http.Handler
 	if h.includeExporterMetrics {
 		handler = promhttp.HandlerFor(
-			prometheus.Gatherers{h.exporterMetricsRegistry, r},
+			gatherer,
 			promhttp.HandlerOpts{
-				ErrorLog:            stdlog.New(log.NewStdlibAdapter(level.Error(h.logger)), "", 0),
-				ErrorHandling:       promhttp.ContinueOnError,
-				MaxRequestsInFlight: h.maxRequests,
-				Registry:            h.exporterMetricsRegistry,
+				ErrorLog:          stdlog.New(log.NewStdlibAdapter(level.Error(h.logger)), "", 0),
+				ErrorHandling:     promhttp.ContinueOnError,
+				Registry:          h.exporterMetricsRegistry,
+				EnableOpenMetrics: true,
 			},
 		)
+		handler = newOpenMetricsHandler(gatherer, handler, h.maxRequests, h.logger)
 		// Note that we have to use h.exporterMetricsRegistry here to
 		// use the same promhttp metrics for all expositions.
 		handler = promhttp.InstrumentMetricHandler(
@@ -143,16 +344,17 @@ func (h *handler) innerHandler(filters ...string) (http.Handler, error) {
 		)
 	} else {
 		handler = promhttp.HandlerFor(
-			r,
+			gatherer,
 			promhttp.HandlerOpts{
-				ErrorLog:            stdlog.New(log.NewStdlibAdapter(level.Error(h.logger)), "", 0),
-				ErrorHandling:       promhttp.ContinueOnError,
-				MaxRequestsInFlight: h.maxRequests,
+				ErrorLog:          stdlog.New(log.NewStdlibAdapter(level.Error(h.logger)), "", 0),
+				ErrorHandling:     promhttp.ContinueOnError,
+				EnableOpenMetrics: true,
 			},
 		)
+		handler = newOpenMetricsHandler(gatherer, handler, h.maxRequests, h.logger)
 	}
 
-	return handler, nil
+	return handler
 }
 
 func main() {
@@ -169,14 +371,24 @@ func main() {
 			"web.max-requests",
 			"Maximum number of parallel scrape requests. Use 0 to disable.",
 		).Default("40").Int()
+		enableLifecycle = kingpin.Flag(
+			"web.enable-lifecycle",
+			"Enable reloading the configuration via HTTP POST to /-/reload. Use --web.config.file to require authentication.",
+		).Default("false").Bool()
 		disableDefaultCollectors = kingpin.Flag(
 			"collector.disable-defaults",
 			"Set all collectors to disabled by default.",
 		).Default("false").Bool()
+		configFile = kingpin.Flag(
+			"config.file",
+			"Path to a YAML file configuring the collectors. Command line flags take precedence over it.",
+		).Default("").String()
 		maxProcs = kingpin.Flag(
 			"runtime.gomaxprocs", "The target number of CPUs Go will run on (GOMAXPROCS)",
 		).Envar("GOMAXPROCS").Default("1").Int()
-		toolkitFlags = kingpinflag.AddFlags(kingpin.CommandLine, ":9100")
+		toolkitFlags      = kingpinflag.AddFlags(kingpin.CommandLine, ":9100")
+		remoteWriteConfig = addRemoteWriteFlags(kingpin.CommandLine)
+		oneshotConfig     = addOneshotFlags(kingpin.CommandLine)
 	)
 
 	promlogConfig := &promlog.Config{}
@@ -187,9 +399,28 @@ func main() {
 	kingpin.Parse()
 	logger := promlog.New(promlogConfig)
 
+	if *configFile != "" {
+		cfg, err := collector.LoadConfig(*configFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error loading configuration file", "err", err)
+			os.Exit(1)
+		}
+		if err := collector.ApplyConfig(cfg, os.Args[1:]); err != nil {
+			level.Error(logger).Log("msg", "Error applying configuration file", "file", *configFile, "err", err)
+			os.Exit(1)
+		}
+	}
 	if *disableDefaultCollectors {
 		collector.DisableDefaultCollectors()
 	}
+	if oneshotConfig.enabled {
+		runtime.GOMAXPROCS(*maxProcs)
+		if err := runOneshot(oneshotConfig, os.Stdout, logger); err != nil {
+			level.Error(logger).Log("msg", "One-shot collection failed", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
 	level.Info(logger).Log("msg", "Starting node_exporter", "version", version.Info())
 	level.Info(logger).Log("msg", "Build context", "build_context", version.BuildContext())
 	if user, err := user.Current(); err == nil && user.Uid == "0" {
@@ -198,7 +429,35 @@ func main() {
 	runtime.GOMAXPROCS(*maxProcs)
 	level.Debug(logger).Log("msg", "Go MAXPROCS", "procs", runtime.GOMAXPROCS(0))
 
-	http.Handle(*metricsPath, newHandler(!*disableExporterMetrics, *maxRequests, logger))
+	configSuccess.Set(1)
+	configSuccessTime.SetToCurrentTime()
+	metricsHandler := newHandler(!*disableExporterMetrics, remoteWriteConfig.url != "", *maxRequests, logger)
+	http.Handle(*metricsPath, metricsHandler)
+	http.HandleFunc("/probe", metricsHandler.probeHandler)
+	if *enableLifecycle {
+		http.Handle("/-/reload", metricsHandler.reloadHandler(*configFile, os.Args[1:]))
+	}
+	if remoteWriteConfig.url != "" {
+		writer, err := newRemoteWriter(remoteWriteConfig, metricsHandler, logger)
+		if err != nil {
+			level.Error(logger).Log("msg", "Error configuring remote write", "err", err)
+			os.Exit(1)
+		}
+		level.Info(writer.logger).Log("msg", "Pushing metrics via remote write", "interval", remoteWriteConfig.interval)
+		go writer.run(context.Background())
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := metricsHandler.reload(*configFile, os.Args[1:]); err != nil {
+				level.Error(logger).Log("msg", "Error reloading configuration", "err", err)
+				continue
+			}
+			level.Info(logger).Log("msg", "Reloaded configuration")
+		}
+	}()
 	if *metricsPath != "/" {
 		landingConfig := web.LandingConfig{
 			Name:        "Node Exporter",
@@ -17,12 +17,17 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/node_exporter/collector"
 	"github.com/prometheus/procfs"
 )
 
@@ -152,3 +157,93 @@ func runCommandAndTests(cmd *exec.Cmd, address string, fn func(pid int) error) e
 	}
 	return err
 }
+
+func TestReloadHandler(t *testing.T) {
+	h := newHandler(false, false, 0, log.NewNopLogger())
+	reload := h.reloadHandler("", nil)
+
+	rw := httptest.NewRecorder()
+	reload(rw, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	if want, have := http.StatusMethodNotAllowed, rw.Code; want != have {
+		t.Errorf("want status code %d for GET, have %d", want, have)
+	}
+
+	rw = httptest.NewRecorder()
+	reload(rw, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	if want, have := http.StatusOK, rw.Code; want != have {
+		t.Errorf("want status code %d for POST, have %d: %s", want, have, rw.Body)
+	}
+
+	rw = httptest.NewRecorder()
+	h.reloadHandler("/nonexistent/config.yml", nil)(rw, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	if want, have := http.StatusInternalServerError, rw.Code; want != have {
+		t.Errorf("want status code %d for missing configuration file, have %d", want, have)
+	}
+
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rw.Body.String(), "node_exporter_config_last_reload_successful 0") {
+		t.Errorf("expected failed reload to be exposed, got:\n%s", rw.Body)
+	}
+}
+
+func TestFilteredHandlerCache(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.loadavg", "--collector.meminfo"}); err != nil {
+		t.Fatal(err)
+	}
+	collector.DisableDefaultCollectors()
+	h := newHandler(false, false, 0, log.NewNopLogger())
+
+	for _, query := range []string{"exclude[]=meminfo", "exclude[]=meminfo", "collect[]=loadavg"} {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics?"+query, nil))
+		if want, have := http.StatusOK, rw.Code; want != have {
+			t.Fatalf("%s: want status code %d, have %d: %s", query, want, have, rw.Body)
+		}
+		body := rw.Body.String()
+		if !strings.Contains(body, `node_scrape_collector_success{collector="loadavg"}`) ||
+			strings.Contains(body, `node_scrape_collector_success{collector="meminfo"}`) {
+			t.Errorf("%s: expected only the loadavg collector, got:\n%s", query, body)
+		}
+	}
+	if want, have := 1, len(h.filteredHandlers); want != have {
+		t.Errorf("want %d cached filtered handler, have %d", want, have)
+	}
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics?profile=doesnotexist", nil))
+	if want, have := http.StatusBadRequest, rw.Code; want != have {
+		t.Errorf("want status code %d for unknown profile, have %d", want, have)
+	}
+}
+
+func TestProbeHandler(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	config := "targets:\n  fixtures:\n    procfs: collector/fixtures/proc\n"
+	if err := os.WriteFile(configFile, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h := newHandler(false, false, 0, log.NewNopLogger())
+	if err := h.reload(configFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer h.reload("", nil)
+
+	for query, code := range map[string]int{
+		"":                                  http.StatusBadRequest,
+		"target=doesnotexist":               http.StatusBadRequest,
+		"target=fixtures&collect[]=loadavg": http.StatusOK,
+	} {
+		rw := httptest.NewRecorder()
+		h.probeHandler(rw, httptest.NewRequest(http.MethodGet, "/probe?"+query, nil))
+		if want, have := code, rw.Code; want != have {
+			t.Errorf("%q: want status code %d, have %d: %s", query, want, have, rw.Body)
+		}
+		if code == http.StatusOK && !strings.Contains(rw.Body.String(), "\nnode_load1 0.21\n") {
+			t.Errorf("%q: expected load average of the target, got:\n%s", query, rw.Body)
+		}
+		if strings.Contains(rw.Body.String(), "node_exporter_config_last_reload") {
+			t.Errorf("%q: expected no metrics about the exporter itself, got:\n%s", query, rw.Body)
+		}
+	}
+}
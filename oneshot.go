@@ -0,0 +1,223 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/node_exporter/collector"
+)
+
+// oneshotConfig holds the settings of the one-shot mode.
+type oneshotConfig struct {
+	enabled        bool
+	output         string
+	file           string
+	format         string
+	pushgatewayURL string
+	job            string
+	grouping       []string
+}
+
+// addOneshotFlags adds the flags configuring the one-shot mode to app.
+func addOneshotFlags(app *kingpin.Application) *oneshotConfig {
+	c := &oneshotConfig{}
+	app.Flag(
+		"oneshot",
+		"Run the enabled collectors once, write their metrics to --output and exit instead of serving them. Exits with 1 if a collector failed.",
+	).Default("false").BoolVar(&c.enabled)
+	app.Flag(
+		"output",
+		"Output of the one-shot mode: stdout, file or pushgateway.",
+	).Default("stdout").EnumVar(&c.output, "stdout", "file", "pushgateway")
+	app.Flag(
+		"output.file",
+		"File the one-shot mode writes the metrics to, replacing it atomically.",
+	).Default("").StringVar(&c.file)
+	app.Flag(
+		"output.format",
+		"Exposition format of the stdout and file outputs: text or openmetrics.",
+	).Default("text").EnumVar(&c.format, "text", "openmetrics")
+	app.Flag(
+		"pushgateway.url",
+		"URL of the Pushgateway the one-shot mode pushes the metrics to.",
+	).Default("").StringVar(&c.pushgatewayURL)
+	app.Flag(
+		"pushgateway.job",
+		"Job name of the metrics pushed to the Pushgateway.",
+	).Default("node").StringVar(&c.job)
+	app.Flag(
+		"pushgateway.grouping",
+		"Grouping key label in the form name=value of the metrics pushed to the Pushgateway, such as instance. Repeatable.",
+	).StringsVar(&c.grouping)
+	return c
+}
+
+// validate checks that the settings of the selected output are complete.
+func (c *oneshotConfig) validate() error {
+	switch c.output {
+	case "file":
+		if c.file == "" {
+			return fmt.Errorf("--output=file requires --output.file")
+		}
+	case "pushgateway":
+		if c.pushgatewayURL == "" {
+			return fmt.Errorf("--output=pushgateway requires --pushgateway.url")
+		}
+		if c.job == "" {
+			return fmt.Errorf("--pushgateway.job must not be empty")
+		}
+		for _, g := range c.grouping {
+			if name, _, ok := strings.Cut(g, "="); !ok || !model.LabelName(name).IsValid() {
+				return fmt.Errorf("invalid grouping key label %q", g)
+			}
+		}
+	}
+	return nil
+}
+
+// runOneshot runs the enabled collectors once and writes their metrics to
+// the configured output, stdout being the standard output. It returns an
+// error if the metrics couldn't be gathered or written, or if any collector
+// failed, in which case the metrics are written nevertheless.
+func runOneshot(c *oneshotConfig, stdout io.Writer, logger log.Logger) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	nc, err := collector.NewNodeCollector(logger)
+	if err != nil {
+		return fmt.Errorf("couldn't create collector: %w", err)
+	}
+	r := prometheus.NewRegistry()
+	r.MustRegister(versioncollector.NewCollector("node_exporter"))
+	if err := r.Register(nc); err != nil {
+		return fmt.Errorf("couldn't register node collector: %w", err)
+	}
+
+	mfs, gatherErr := unitGatherer{r}.Gather()
+	if gatherErr != nil {
+		// Like the metrics handler, write what was gathered.
+		level.Error(logger).Log("msg", "Error gathering metrics", "err", gatherErr)
+	}
+
+	switch c.output {
+	case "stdout":
+		err = writeMetrics(stdout, mfs, c.format)
+	case "file":
+		err = writeFileAtomic(c.file, func(w io.Writer) error {
+			return writeMetrics(w, mfs, c.format)
+		})
+	case "pushgateway":
+		pusher := push.New(c.pushgatewayURL, c.job).Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return mfs, nil
+		}))
+		for _, g := range c.grouping {
+			name, value, _ := strings.Cut(g, "=")
+			pusher = pusher.Grouping(name, value)
+		}
+		err = pusher.Push()
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't write metrics to %s: %w", c.output, err)
+	}
+
+	if failed := failedCollectors(mfs); len(failed) > 0 {
+		return fmt.Errorf("collectors failed: %s", strings.Join(failed, ", "))
+	}
+	if gatherErr != nil {
+		return fmt.Errorf("error gathering metrics: %w", gatherErr)
+	}
+	return nil
+}
+
+// failedCollectors returns the sorted names of the collectors reported as
+// failed by node_scrape_collector_success.
+func failedCollectors(mfs []*dto.MetricFamily) []string {
+	var failed []string
+	for _, mf := range mfs {
+		if mf.GetName() != "node_scrape_collector_success" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			if m.GetGauge().GetValue() != 0 {
+				continue
+			}
+			for _, lp := range m.Label {
+				if lp.GetName() == "collector" {
+					failed = append(failed, lp.GetValue())
+				}
+			}
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// writeMetrics writes mfs to w in the text or OpenMetrics format.
+func writeMetrics(w io.Writer, mfs []*dto.MetricFamily, format string) error {
+	f := expfmt.NewFormat(expfmt.TypeTextPlain)
+	if format == "openmetrics" {
+		f = expfmt.NewFormat(expfmt.TypeOpenMetrics)
+	}
+	enc := expfmt.NewEncoder(w, f, openMetricsEncoderOptions...)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with the output of write, so
+// that readers such as the textfile collector never see partial content.
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
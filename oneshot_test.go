@@ -0,0 +1,119 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noloadavg
+// +build !noloadavg
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/node_exporter/collector"
+)
+
+// enableLoadavg enables only the loadavg collector, reading from procfs.
+func enableLoadavg(t *testing.T, procfs string) {
+	t.Helper()
+	if _, err := kingpin.CommandLine.Parse([]string{"--collector.loadavg", "--path.procfs=" + procfs}); err != nil {
+		t.Fatal(err)
+	}
+	collector.DisableDefaultCollectors()
+	// Recreate the collectors with the new paths.
+	if err := collector.Reload(nil, nil, log.NewNopLogger(), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOneshot(t *testing.T) {
+	defer func() {
+		kingpin.CommandLine.Parse(nil)
+		collector.Reload(nil, nil, log.NewNopLogger(), nil)
+	}()
+	enableLoadavg(t, "collector/fixtures/proc")
+
+	var stdout bytes.Buffer
+	c := &oneshotConfig{output: "stdout", format: "openmetrics"}
+	if err := runOneshot(c, &stdout, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if out := stdout.String(); !strings.Contains(out, "\nnode_load1 0.21\n") || !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("unexpected OpenMetrics output:\n%s", out)
+	}
+
+	file := filepath.Join(t.TempDir(), "node.prom")
+	c = &oneshotConfig{output: "file", file: file, format: "text"}
+	if err := runOneshot(c, io.Discard, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "\nnode_load1 0.21\n") {
+		t.Errorf("unexpected file content:\n%s", out)
+	}
+	if files, _ := filepath.Glob(filepath.Join(filepath.Dir(file), ".*")); len(files) != 0 {
+		t.Errorf("expected no temporary files to be left, got %v", files)
+	}
+
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+	c = &oneshotConfig{output: "pushgateway", pushgatewayURL: server.URL, job: "node", grouping: []string{"instance=host1"}}
+	if err := runOneshot(c, io.Discard, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/node/instance/host1" || !strings.Contains(body, "node_load1") {
+		t.Errorf("unexpected push %s %s", method, path)
+	}
+
+	// A failing collector fails the run, but its metrics are written.
+	enableLoadavg(t, "/nonexistent")
+	c = &oneshotConfig{output: "file", file: file, format: "text"}
+	err = runOneshot(c, io.Discard, log.NewNopLogger())
+	if err == nil || !strings.HasPrefix(err.Error(), "collectors failed: ") || !strings.Contains(err.Error(), "loadavg") {
+		t.Errorf("expected loadavg collector to fail, got %v", err)
+	}
+	if out, _ := os.ReadFile(file); !strings.Contains(string(out), `node_scrape_collector_success{collector="loadavg"} 0`) {
+		t.Errorf("expected failure to be written, got:\n%s", out)
+	}
+}
+
+func TestOneshotConfigErrors(t *testing.T) {
+	for _, test := range []struct {
+		config oneshotConfig
+		err    string
+	}{
+		{config: oneshotConfig{output: "file"}, err: "--output=file requires --output.file"},
+		{config: oneshotConfig{output: "pushgateway", job: "node"}, err: "--output=pushgateway requires --pushgateway.url"},
+		{config: oneshotConfig{output: "pushgateway", pushgatewayURL: "http://localhost", job: "node", grouping: []string{"instance"}}, err: `invalid grouping key label "instance"`},
+	} {
+		if err := test.config.validate(); err == nil || err.Error() != test.err {
+			t.Errorf("%+v: expected error %q, got %v", test.config, test.err, err)
+		}
+	}
+}
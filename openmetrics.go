@@ -0,0 +1,147 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+// metricUnits are the base units announced in the OpenMetrics format when a
+// metric name ends with them.
+var metricUnits = []string{
+	"seconds", "bytes", "celsius", "joules", "volts", "amperes", "watts",
+	"hertz", "meters", "grams",
+}
+
+// unitGatherer sets the unit of the gathered metric families whose name
+// ends with a base unit, the _total suffix of counters aside.
+type unitGatherer struct {
+	prometheus.Gatherer
+}
+
+func (g unitGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	for _, mf := range mfs {
+		if mf.Unit != nil {
+			continue
+		}
+		name := mf.GetName()
+		if mf.GetType() == dto.MetricType_COUNTER {
+			name = strings.TrimSuffix(name, "_total")
+		}
+		for _, unit := range metricUnits {
+			if strings.HasSuffix(name, "_"+unit) {
+				mf.Unit = proto.String(unit)
+				break
+			}
+		}
+	}
+	return mfs, err
+}
+
+// openMetricsEncoderOptions enables the OpenMetrics features promhttp does
+// not: created timestamps of counters, summaries and histograms, and units.
+var openMetricsEncoderOptions = []expfmt.EncoderOption{expfmt.WithCreatedLines(), expfmt.WithUnit()}
+
+// openMetricsHandler serves the metrics of gatherer to scrapers negotiating
+// the OpenMetrics format and passes other requests on to next. It encodes
+// OpenMetrics itself as promhttp, even with EnableOpenMetrics, offers no way
+// to pass openMetricsEncoderOptions. It limits the concurrent requests of
+// both, so next should not limit them again.
+type openMetricsHandler struct {
+	gatherer prometheus.Gatherer
+	next     http.Handler
+	inFlight chan struct{}
+	logger   log.Logger
+}
+
+func newOpenMetricsHandler(gatherer prometheus.Gatherer, next http.Handler, maxRequests int, logger log.Logger) *openMetricsHandler {
+	h := &openMetricsHandler{
+		gatherer: unitGatherer{gatherer},
+		next:     next,
+		logger:   logger,
+	}
+	if maxRequests > 0 {
+		h.inFlight = make(chan struct{}, maxRequests)
+	}
+	return h
+}
+
+func (h *openMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.inFlight != nil {
+		select {
+		case h.inFlight <- struct{}{}:
+			defer func() { <-h.inFlight }()
+		default:
+			http.Error(w, "Limit of concurrent requests reached, try again later.", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	if format.FormatType() != expfmt.TypeOpenMetrics {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	mfs, err := h.gatherer.Gather()
+	if err != nil {
+		// Like promhttp.ContinueOnError, serve what was gathered.
+		level.Error(h.logger).Log("msg", "Error gathering metrics", "err", err)
+		if len(mfs) == 0 {
+			http.Error(w, "An error has occurred while gathering metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", string(format))
+	var out io.Writer = w
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	enc := expfmt.NewEncoder(out, format, openMetricsEncoderOptions...)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			level.Error(h.logger).Log("msg", "Error encoding metric family", "name", mf.GetName(), "err", err)
+			return
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			level.Error(h.logger).Log("msg", "Error finishing OpenMetrics exposition", "err", err)
+		}
+	}
+}
+
+// acceptsGzip reports whether the client accepts gzip encoded responses.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if enc, _, _ := strings.Cut(strings.TrimSpace(part), ";"); enc == "gzip" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type createdCollector struct{}
+
+var (
+	testCPUDesc    = prometheus.NewDesc("node_cpu_seconds_total", "Seconds the CPUs spent in each mode.", []string{"cpu"}, nil)
+	testMemoryDesc = prometheus.NewDesc("node_memory_MemFree_bytes", "Memory information field MemFree_bytes.", nil, nil)
+	testBootTime   = time.Unix(1418183276, 0)
+)
+
+func (createdCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- testCPUDesc
+	ch <- testMemoryDesc
+}
+
+func (createdCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetricWithCreatedTimestamp(testCPUDesc, prometheus.CounterValue, 1.5, testBootTime, "0")
+	ch <- prometheus.MustNewConstMetric(testMemoryDesc, prometheus.GaugeValue, 1024)
+}
+
+func TestOpenMetricsHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(createdCollector{})
+	h := newOpenMetricsHandler(reg, http.NotFoundHandler(), 0, log.NewNopLogger())
+
+	get := func(accept, encoding string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		req.Header.Set("Accept-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	resp := get("application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5", "gzip")
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text; version=1.0.0") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(gz)
+	want := `# HELP node_cpu_seconds Seconds the CPUs spent in each mode.
+# TYPE node_cpu_seconds counter
+# UNIT node_cpu_seconds seconds
+node_cpu_seconds_total{cpu="0"} 1.5
+node_cpu_seconds_created{cpu="0"} 1.418183276e+09
+# HELP node_memory_MemFree_bytes Memory information field MemFree_bytes.
+# TYPE node_memory_MemFree_bytes gauge
+# UNIT node_memory_MemFree_bytes bytes
+node_memory_MemFree_bytes 1024.0
+# EOF
+`
+	if string(body) != want {
+		t.Errorf("want OpenMetrics exposition:\n%s\ngot:\n%s", want, body)
+	}
+
+	// Other formats are served by the next handler.
+	if resp := get("text/plain;version=0.0.4", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected text format to be passed on, got status %d", resp.StatusCode)
+	}
+}
+
+func TestOpenMetricsHandlerMaxRequests(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	})
+	h := newOpenMetricsHandler(prometheus.NewRegistry(), next, 1, log.NewNopLogger())
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		close(done)
+	}()
+	<-entered
+
+	// A text format request in flight counts against the limit of
+	// OpenMetrics requests, too.
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if want, have := http.StatusServiceUnavailable, rec.Code; want != have {
+		t.Errorf("want status code %d above the limit, have %d", want, have)
+	}
+	close(release)
+	<-done
+}
@@ -0,0 +1,552 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/version"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	remoteWriteSamplesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "node_exporter",
+		Subsystem: "remote_write",
+		Name:      "samples_sent_total",
+		Help:      "Total number of samples successfully sent via remote write.",
+	}, []string{"url"})
+	remoteWriteSamplesFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "node_exporter",
+		Subsystem: "remote_write",
+		Name:      "samples_failed_total",
+		Help:      "Total number of samples in failed remote write requests, including those retried later.",
+	}, []string{"url"})
+	remoteWriteSamplesDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "node_exporter",
+		Subsystem: "remote_write",
+		Name:      "samples_dropped_total",
+		Help:      "Total number of samples dropped because the queue was full or the receiver rejected them.",
+	}, []string{"url"})
+	remoteWriteSamplesQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "node_exporter",
+		Subsystem: "remote_write",
+		Name:      "samples_queued",
+		Help:      "Number of samples waiting to be sent via remote write.",
+	}, []string{"url"})
+)
+
+// remoteWriteConfig holds the settings of the remote write push mode.
+type remoteWriteConfig struct {
+	url                string
+	interval           time.Duration
+	timeout            time.Duration
+	queueMaxSamples    int
+	queueDirectory     string
+	labels             []string
+	username           string
+	passwordFile       string
+	bearerTokenFile    string
+	caFile             string
+	certFile           string
+	keyFile            string
+	serverName         string
+	insecureSkipVerify bool
+}
+
+// addRemoteWriteFlags adds the flags configuring the remote write push mode
+// to app.
+func addRemoteWriteFlags(app *kingpin.Application) *remoteWriteConfig {
+	c := &remoteWriteConfig{}
+	app.Flag(
+		"remote-write.url",
+		"URL of a Prometheus remote write receiver to push the metrics to. Push mode is disabled if empty.",
+	).Default("").StringVar(&c.url)
+	app.Flag(
+		"remote-write.interval",
+		"Interval of gathering and pushing the metrics.",
+	).Default("1m").DurationVar(&c.interval)
+	app.Flag(
+		"remote-write.timeout",
+		"Timeout of a single remote write request.",
+	).Default("30s").DurationVar(&c.timeout)
+	app.Flag(
+		"remote-write.queue.max-samples",
+		"Maximum number of samples kept for retrying failed pushes. The oldest are dropped first.",
+	).Default("500000").IntVar(&c.queueMaxSamples)
+	app.Flag(
+		"remote-write.queue.directory",
+		"Directory persisting the retry queue across restarts. The queue is kept in memory only if empty.",
+	).Default("").StringVar(&c.queueDirectory)
+	app.Flag(
+		"remote-write.label",
+		"Label in the form name=value added to all pushed series, such as instance or job. Repeatable.",
+	).StringsVar(&c.labels)
+	app.Flag(
+		"remote-write.basic-auth.username",
+		"Username for basic authentication with the remote write receiver.",
+	).Default("").StringVar(&c.username)
+	app.Flag(
+		"remote-write.basic-auth.password-file",
+		"File holding the password for basic authentication with the remote write receiver.",
+	).Default("").StringVar(&c.passwordFile)
+	app.Flag(
+		"remote-write.bearer-token-file",
+		"File holding the bearer token for the remote write receiver.",
+	).Default("").StringVar(&c.bearerTokenFile)
+	app.Flag(
+		"remote-write.tls.ca-file",
+		"CA certificate file to verify the remote write receiver with.",
+	).Default("").StringVar(&c.caFile)
+	app.Flag(
+		"remote-write.tls.cert-file",
+		"Client certificate file for the remote write receiver.",
+	).Default("").StringVar(&c.certFile)
+	app.Flag(
+		"remote-write.tls.key-file",
+		"Client key file for the remote write receiver.",
+	).Default("").StringVar(&c.keyFile)
+	app.Flag(
+		"remote-write.tls.server-name",
+		"Server name to verify the certificate of the remote write receiver with.",
+	).Default("").StringVar(&c.serverName)
+	app.Flag(
+		"remote-write.tls.insecure-skip-verify",
+		"Disable verification of the certificate of the remote write receiver.",
+	).Default("false").BoolVar(&c.insecureSkipVerify)
+	return c
+}
+
+// httpClientConfig returns the HTTP client configuration given by c.
+func (c *remoteWriteConfig) httpClientConfig() config.HTTPClientConfig {
+	cfg := config.DefaultHTTPClientConfig
+	if c.username != "" || c.passwordFile != "" {
+		cfg.BasicAuth = &config.BasicAuth{
+			Username:     c.username,
+			PasswordFile: c.passwordFile,
+		}
+	}
+	cfg.BearerTokenFile = c.bearerTokenFile
+	cfg.TLSConfig = config.TLSConfig{
+		CAFile:             c.caFile,
+		CertFile:           c.certFile,
+		KeyFile:            c.keyFile,
+		ServerName:         c.serverName,
+		InsecureSkipVerify: c.insecureSkipVerify,
+	}
+	return cfg
+}
+
+// remoteWriter periodically pushes the metrics of a gatherer to a remote
+// write receiver. Pushes failing with a retryable error are queued and
+// retried on the next interval.
+type remoteWriter struct {
+	url      string
+	client   *http.Client
+	gatherer prometheus.Gatherer
+	interval time.Duration
+	timeout  time.Duration
+	labels   map[string]string
+	queue    *writeQueue
+	logger   log.Logger
+
+	sent, failed, dropped prometheus.Counter
+	queued                prometheus.Gauge
+}
+
+func newRemoteWriter(c *remoteWriteConfig, gatherer prometheus.Gatherer, logger log.Logger) (*remoteWriter, error) {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote write URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid remote write URL %q: scheme must be http or https", u.Redacted())
+	}
+	if c.interval <= 0 {
+		return nil, fmt.Errorf("remote write interval must be positive, got %s", c.interval)
+	}
+	labels := map[string]string{}
+	for _, l := range c.labels {
+		name, value, ok := strings.Cut(l, "=")
+		if !ok || !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("invalid remote write label %q", l)
+		}
+		labels[name] = value
+	}
+
+	httpConfig := c.httpClientConfig()
+	if err := httpConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid remote write HTTP settings: %w", err)
+	}
+	client, err := config.NewClientFromConfig(httpConfig, "remote_write")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create remote write client: %w", err)
+	}
+	client.Timeout = c.timeout
+
+	queue, err := newWriteQueue(c.queueDirectory, c.queueMaxSamples)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open remote write queue: %w", err)
+	}
+
+	label := u.Redacted()
+	w := &remoteWriter{
+		url:      c.url,
+		client:   client,
+		gatherer: gatherer,
+		interval: c.interval,
+		timeout:  c.timeout,
+		labels:   labels,
+		queue:    queue,
+		logger:   log.With(logger, "url", label),
+		sent:     remoteWriteSamplesSent.WithLabelValues(label),
+		failed:   remoteWriteSamplesFailed.WithLabelValues(label),
+		dropped:  remoteWriteSamplesDropped.WithLabelValues(label),
+		queued:   remoteWriteSamplesQueued.WithLabelValues(label),
+	}
+	w.queued.Set(float64(queue.samples))
+	return w, nil
+}
+
+// run pushes the metrics every interval until ctx is canceled.
+func (w *remoteWriter) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.push(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// push gathers the metrics, queues them and sends everything queued.
+func (w *remoteWriter) push(ctx context.Context, now time.Time) {
+	mfs, err := w.gatherer.Gather()
+	if err != nil {
+		// Like the metrics handler, continue with what was gathered.
+		level.Warn(w.logger).Log("msg", "Error gathering metrics for remote write", "err", err)
+	}
+	if series := toTimeSeries(mfs, w.labels, now); len(series) > 0 {
+		b := &writeBatch{
+			samples: len(series),
+			data:    snappy.Encode(nil, encodeWriteRequest(series)),
+		}
+		dropped, err := w.queue.push(b)
+		if err != nil {
+			level.Error(w.logger).Log("msg", "Error queueing samples for remote write", "err", err)
+		}
+		if dropped > 0 {
+			level.Warn(w.logger).Log("msg", "Remote write queue is full, dropped oldest samples", "samples", dropped)
+			w.dropped.Add(float64(dropped))
+		}
+	}
+	w.flush(ctx)
+	w.queued.Set(float64(w.queue.samples))
+}
+
+// flush sends the queued batches in order, stopping at the first one
+// failing with a retryable error.
+func (w *remoteWriter) flush(ctx context.Context) {
+	for b := w.queue.peek(); b != nil; b = w.queue.peek() {
+		err := w.send(ctx, b.data)
+		if err == nil {
+			w.sent.Add(float64(b.samples))
+			w.queue.pop()
+			continue
+		}
+		w.failed.Add(float64(b.samples))
+		if rerr, ok := err.(recoverableError); ok {
+			level.Warn(w.logger).Log("msg", "Remote write failed, retrying later", "err", rerr.error, "queued_samples", w.queue.samples)
+			return
+		}
+		level.Error(w.logger).Log("msg", "Remote write rejected, dropping samples", "err", err, "samples", b.samples)
+		w.dropped.Add(float64(b.samples))
+		w.queue.pop()
+	}
+}
+
+// recoverableError is an error of a remote write request which is worth
+// retrying.
+type recoverableError struct {
+	error
+}
+
+// send sends a snappy compressed write request.
+func (w *remoteWriter) send(ctx context.Context, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "node_exporter/"+version.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return recoverableError{err}
+	}
+	return err
+}
+
+type label struct {
+	name, value string
+}
+
+type sample struct {
+	value       float64
+	timestampMs int64
+}
+
+type timeSeries struct {
+	labels []label
+	sample sample
+}
+
+// toTimeSeries converts metric families to remote write series with the
+// given extra labels, which do not override labels of the metrics. Samples
+// without timestamp get now.
+func toTimeSeries(mfs []*dto.MetricFamily, extraLabels map[string]string, now time.Time) []timeSeries {
+	var series []timeSeries
+	nowMs := now.UnixMilli()
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			ts := nowMs
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			add := func(suffix string, value float64, extra ...label) {
+				labels := make([]label, 0, len(m.Label)+len(extra)+len(extraLabels)+1)
+				labels = append(labels, label{model.MetricNameLabel, mf.GetName() + suffix})
+				seen := map[string]bool{}
+				for _, lp := range m.Label {
+					labels = append(labels, label{lp.GetName(), lp.GetValue()})
+					seen[lp.GetName()] = true
+				}
+				for _, l := range extra {
+					labels = append(labels, l)
+					seen[l.name] = true
+				}
+				for name, value := range extraLabels {
+					if !seen[name] {
+						labels = append(labels, label{name, value})
+					}
+				}
+				sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+				series = append(series, timeSeries{labels: labels, sample: sample{value, ts}})
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.Quantile {
+					add("", q.GetValue(), label{model.QuantileLabel, formatFloat(q.GetQuantile())})
+				}
+				add("_sum", s.GetSampleSum())
+				add("_count", float64(s.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := m.GetHistogram()
+				infSeen := false
+				for _, b := range h.Bucket {
+					if math.IsInf(b.GetUpperBound(), +1) {
+						infSeen = true
+					}
+					add("_bucket", float64(b.GetCumulativeCount()), label{model.BucketLabel, formatFloat(b.GetUpperBound())})
+				}
+				if !infSeen {
+					add("_bucket", float64(h.GetSampleCount()), label{model.BucketLabel, "+Inf"})
+				}
+				add("_sum", h.GetSampleSum())
+				add("_count", float64(h.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes series as a remote write protobuf
+// prometheus.WriteRequest message.
+func encodeWriteRequest(series []timeSeries) []byte {
+	var buf, ts, l, s []byte
+	for _, t := range series {
+		ts = ts[:0]
+		for _, lbl := range t.labels {
+			l = l[:0]
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, lbl.name)
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, lbl.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, l)
+		}
+		s = s[:0]
+		s = protowire.AppendTag(s, 1, protowire.Fixed64Type)
+		s = protowire.AppendFixed64(s, math.Float64bits(t.sample.value))
+		s = protowire.AppendTag(s, 2, protowire.VarintType)
+		s = protowire.AppendVarint(s, uint64(t.sample.timestampMs))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, s)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+	return buf
+}
+
+// writeBatch is a snappy compressed write request waiting to be sent.
+type writeBatch struct {
+	samples int
+	data    []byte
+	// file persists the batch if the queue has a directory.
+	file string
+}
+
+// writeQueue is a queue of write requests bounded by their total number of
+// samples, optionally persisted to a directory. It is not safe for
+// concurrent use.
+type writeQueue struct {
+	dir        string
+	maxSamples int
+	batches    []*writeBatch
+	samples    int
+}
+
+// newWriteQueue returns a queue holding up to maxSamples samples, loading
+// the batches persisted in dir if it is not empty.
+func newWriteQueue(dir string, maxSamples int) (*writeQueue, error) {
+	q := &writeQueue{dir: dir, maxSamples: maxSamples}
+	if dir == "" {
+		return q, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	// Batch files are named <nanoseconds>-<samples>.snappy, so that
+	// sorting them by name yields the queue order.
+	files, err := filepath.Glob(filepath.Join(dir, "*.snappy"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".snappy")
+		_, samples, ok := strings.Cut(name, "-")
+		n, err := strconv.Atoi(samples)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("unexpected file in queue directory: %s", file)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		q.batches = append(q.batches, &writeBatch{samples: n, data: data, file: file})
+		q.samples += n
+	}
+	q.trim()
+	return q, nil
+}
+
+// push appends b, persisting it if the queue has a directory, and drops
+// the oldest batches beyond the size limit. It returns the number of
+// dropped samples. The newest batch is always kept.
+func (q *writeQueue) push(b *writeBatch) (int, error) {
+	var err error
+	if q.dir != "" {
+		b.file = filepath.Join(q.dir, fmt.Sprintf("%020d-%d.snappy", time.Now().UnixNano(), b.samples))
+		tmp := b.file + ".tmp"
+		if err = os.WriteFile(tmp, b.data, 0o600); err == nil {
+			err = os.Rename(tmp, b.file)
+		}
+		if err != nil {
+			// Keep the batch in memory only.
+			os.Remove(tmp)
+			b.file = ""
+		}
+	}
+	q.batches = append(q.batches, b)
+	q.samples += b.samples
+	return q.trim(), err
+}
+
+func (q *writeQueue) trim() int {
+	dropped := 0
+	for q.samples > q.maxSamples && len(q.batches) > 1 {
+		dropped += q.pop().samples
+	}
+	return dropped
+}
+
+// peek returns the oldest batch, nil if the queue is empty.
+func (q *writeQueue) peek() *writeBatch {
+	if len(q.batches) == 0 {
+		return nil
+	}
+	return q.batches[0]
+}
+
+// pop removes and returns the oldest batch.
+func (q *writeQueue) pop() *writeBatch {
+	b := q.batches[0]
+	q.batches[0] = nil
+	q.batches = q.batches[1:]
+	q.samples -= b.samples
+	if b.file != "" {
+		os.Remove(b.file)
+	}
+	return b
+}
@@ -0,0 +1,296 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// writeReceiver is a remote write receiver answering with the queued status
+// codes, 204 once they are used up.
+type writeReceiver struct {
+	mtx      sync.Mutex
+	statuses []int
+	series   []string
+	auth     string
+}
+
+func (r *writeReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.auth = req.Header.Get("Authorization")
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		http.Error(w, "injected failure", status)
+		return
+	}
+	if req.Header.Get("Content-Encoding") != "snappy" || req.Header.Get("Content-Type") != "application/x-protobuf" {
+		http.Error(w, "unexpected headers", http.StatusUnsupportedMediaType)
+		return
+	}
+	compressed, _ := io.ReadAll(req.Body)
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series, err := decodeWriteRequest(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.series = append(r.series, series...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *writeReceiver) received() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]string(nil), r.series...)
+}
+
+// decodeWriteRequest decodes a write request into one line per series in
+// the form name{labels} value timestamp.
+func decodeWriteRequest(b []byte) ([]string, error) {
+	var series []string
+	err := forEachField(b, func(num protowire.Number, ts []byte) error {
+		var name, labels, value string
+		err := forEachField(ts, func(num protowire.Number, b []byte) error {
+			switch num {
+			case 1:
+				var l [3]string
+				if err := forEachField(b, func(num protowire.Number, b []byte) error {
+					l[num] = string(b)
+					return nil
+				}); err != nil {
+					return err
+				}
+				if l[1] == "__name__" {
+					name = l[2]
+				} else {
+					labels += fmt.Sprintf("%s=%q,", l[1], l[2])
+				}
+			case 2:
+				var v, ts uint64
+				for len(b) > 0 {
+					num, typ, n := protowire.ConsumeTag(b)
+					if n < 0 {
+						return protowire.ParseError(n)
+					}
+					switch {
+					case num == 1 && typ == protowire.Fixed64Type:
+						v, n = protowire.ConsumeFixed64(b[n:])
+					case num == 2 && typ == protowire.VarintType:
+						ts, n = protowire.ConsumeVarint(b[n:])
+					default:
+						return fmt.Errorf("unexpected sample field %d", num)
+					}
+					if n < 0 {
+						return protowire.ParseError(n)
+					}
+					b = b[protowire.SizeTag(num)+n:]
+				}
+				value = fmt.Sprintf("%g %d", math.Float64frombits(v), int64(ts))
+			}
+			return nil
+		})
+		series = append(series, fmt.Sprintf("%s{%s} %s", name, strings.TrimSuffix(labels, ","), value))
+		return err
+	})
+	return series, err
+}
+
+// forEachField calls f with the number and content of each length
+// delimited field of a message.
+func forEachField(b []byte, f func(protowire.Number, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || typ != protowire.BytesType {
+			return fmt.Errorf("unexpected field")
+		}
+		v, m := protowire.ConsumeBytes(b[n:])
+		if m < 0 {
+			return protowire.ParseError(m)
+		}
+		if err := f(num, v); err != nil {
+			return err
+		}
+		b = b[n+m:]
+	}
+	return nil
+}
+
+func newTestRemoteWriter(t *testing.T, url string, c remoteWriteConfig) *remoteWriter {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "node_test", Help: "Test."}, []string{"mode"})
+	gauge.WithLabelValues("a").Set(1.5)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "node_test_seconds", Help: "Test.", Buckets: []float64{1}})
+	histogram.Observe(0.5)
+	reg.MustRegister(gauge, histogram)
+
+	c.url = url
+	if c.interval == 0 {
+		c.interval = time.Minute
+	}
+	c.timeout = 5 * time.Second
+	if c.queueMaxSamples == 0 {
+		c.queueMaxSamples = 100
+	}
+	w, err := newRemoteWriter(&c, reg, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestRemoteWrite(t *testing.T) {
+	receiver := &writeReceiver{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w := newTestRemoteWriter(t, server.URL+"/api/v1/write", remoteWriteConfig{
+		// Labels of the series take precedence.
+		labels:       []string{"instance=host1", "mode=ignored"},
+		username:     "node",
+		passwordFile: passwordFile,
+	})
+
+	// The first push fails and is retried with the second one.
+	w.push(context.Background(), time.UnixMilli(1000))
+	if got := testutil.ToFloat64(w.queued); got != 5 {
+		t.Errorf("want 5 queued samples, got %v", got)
+	}
+	if got := testutil.ToFloat64(w.failed); got != 5 {
+		t.Errorf("want 5 failed samples, got %v", got)
+	}
+	w.push(context.Background(), time.UnixMilli(2000))
+
+	want := []string{
+		`node_test{instance="host1",mode="a"} 1.5 1000`,
+		`node_test_seconds_bucket{instance="host1",le="1",mode="ignored"} 1 1000`,
+		`node_test_seconds_bucket{instance="host1",le="+Inf",mode="ignored"} 1 1000`,
+		`node_test_seconds_sum{instance="host1",mode="ignored"} 0.5 1000`,
+		`node_test_seconds_count{instance="host1",mode="ignored"} 1 1000`,
+	}
+	got := receiver.received()
+	if len(got) != 10 || !reflect.DeepEqual(want, got[:5]) {
+		t.Errorf("want series %q at both timestamps, got %q", want, got)
+	}
+	if got[5] != `node_test{instance="host1",mode="a"} 1.5 2000` {
+		t.Errorf("unexpected series of the second push: %q", got[5])
+	}
+	if got, want := receiver.auth, "Basic bm9kZTpzZWNyZXQ="; got != want {
+		t.Errorf("want authorization %q, got %q", want, got)
+	}
+	if got := testutil.ToFloat64(w.sent); got != 10 {
+		t.Errorf("want 10 sent samples, got %v", got)
+	}
+	if got := testutil.ToFloat64(w.queued); got != 0 {
+		t.Errorf("want empty queue, got %v queued samples", got)
+	}
+
+	// Rejected requests are not retried.
+	receiver.mtx.Lock()
+	receiver.statuses = []int{http.StatusBadRequest}
+	receiver.mtx.Unlock()
+	w.push(context.Background(), time.UnixMilli(3000))
+	if got := testutil.ToFloat64(w.dropped); got != 5 {
+		t.Errorf("want 5 dropped samples, got %v", got)
+	}
+	if len(receiver.received()) != 10 {
+		t.Error("expected rejected samples not to be retried")
+	}
+}
+
+func TestRemoteWriteQueue(t *testing.T) {
+	receiver := &writeReceiver{statuses: []int{500, 500, 500}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "queue")
+	c := remoteWriteConfig{queueDirectory: dir, queueMaxSamples: 10}
+	w := newTestRemoteWriter(t, server.URL, c)
+	for i := 1; i <= 3; i++ {
+		w.push(context.Background(), time.UnixMilli(int64(i)))
+	}
+	if got := testutil.ToFloat64(w.queued); got != 10 {
+		t.Errorf("want 10 queued samples, got %v", got)
+	}
+	if got := testutil.ToFloat64(w.dropped); got != 5 {
+		t.Errorf("want the oldest 5 samples dropped, got %v", got)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.snappy"))
+	if len(files) != 2 {
+		t.Fatalf("want 2 persisted batches, got %v", files)
+	}
+
+	// The persisted queue is sent after a restart.
+	server.Close()
+	receiver = &writeReceiver{}
+	server = httptest.NewServer(receiver)
+	defer server.Close()
+	w = newTestRemoteWriter(t, server.URL, c)
+	if got := testutil.ToFloat64(w.queued); got != 10 {
+		t.Errorf("want 10 samples loaded from the queue directory, got %v", got)
+	}
+	w.flush(context.Background())
+	got := receiver.received()
+	if len(got) != 10 || !strings.HasSuffix(got[0], " 2") || !strings.HasSuffix(got[5], " 3") {
+		t.Errorf("want the queued batches in order, got %q", got)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.snappy")); len(files) != 0 {
+		t.Errorf("expected sent batches to be removed, got %v", files)
+	}
+}
+
+func TestRemoteWriteConfigErrors(t *testing.T) {
+	for _, test := range []struct {
+		config remoteWriteConfig
+		err    string
+	}{
+		{config: remoteWriteConfig{url: "localhost:9090", interval: time.Minute}, err: "scheme must be http or https"},
+		{config: remoteWriteConfig{url: "http://localhost", interval: time.Minute, labels: []string{"instance"}}, err: `invalid remote write label "instance"`},
+		{config: remoteWriteConfig{url: "http://localhost", interval: time.Minute, bearerTokenFile: "a", username: "b"}, err: "invalid remote write HTTP settings"},
+		{config: remoteWriteConfig{url: "http://localhost"}, err: "interval must be positive"},
+	} {
+		_, err := newRemoteWriter(&test.config, prometheus.NewRegistry(), log.NewNopLogger())
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%+v: expected error containing %q, got %v", test.config, test.err, err)
+		}
+	}
+}